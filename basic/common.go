@@ -1,8 +1,6 @@
 package basic
 
 import (
-	"fmt"
-
 	"github.com/pkg/errors"
 )
 
@@ -13,6 +11,11 @@ type TransferType int          //转移类型 增加物品或减少物品
 type StateStatus int           //转移状态
 type ItemType int              //物品类型
 type OfficialAccountType int64 //官方账户类型
+type LegStatus int             //转移中单个账户操作的状态
+type InconsistentReason int    //转移状态与记录不一致的原因
+type RepairType int            //不一致的修复方式
+type ChainBreakReason int      //记录哈希链断裂的原因
+type OutboxStatus int          //转移状态事件的投递状态
 
 const (
 	DefaultOfficialAccountStep = 10000000    //官方账户类型步长 默认1千万
@@ -23,26 +26,45 @@ const (
 	DefaultAccountSplitNum     = 1           //账户分表数量 默认1单表
 )
 
-var (
-	officialAccountStep int64 //官方账户类型步长
-	officialAccountMin  int64 //官方账户最小值
-	officialAccountMax  int64 //官方账户最大值
-
-	stateSplitNum   int64 //转移状态分表数量
-	recordSplitNum  int64 //转移记录分表数量
-	accountSplitNum int64 //账户分表数量
-	dbNum           int64 //数据库数量
-)
-
 const (
 	RecordStatusNormal        RecordStatus = 1 //正常
 	RecordStatusRollback      RecordStatus = 2 //回滚
 	RecordStatusEmptyRollback RecordStatus = 3 //空回滚
+	RecordStatusCaptured      RecordStatus = 4 //已扣款 仅冻结记录使用，冻结已转为扣减
+)
+
+const (
+	LegStatusPending       LegStatus = 1 //未执行 还没有记录
+	LegStatusDone          LegStatus = 2 //已完成
+	LegStatusRolledBack    LegStatus = 3 //已回滚
+	LegStatusEmptyRollback LegStatus = 4 //空回滚 回滚早于操作到达
+)
+
+const (
+	InconsistentReasonLegMissing        InconsistentReason = 1 //转移已成功，操作没有记录
+	InconsistentReasonLegRolledBack     InconsistentReason = 2 //转移已成功，操作已回滚或空回滚
+	InconsistentReasonNotCompensated    InconsistentReason = 3 //转移已回滚，操作仍是正常记录
+	InconsistentReasonNoEmptyRollback   InconsistentReason = 4 //转移已回滚，操作没有空回滚记录，后到的操作会正常执行
+	InconsistentReasonFreezeNotCaptured InconsistentReason = 5 //从冻结中扣减已完成，冻结记录不是已扣款
+)
+
+const (
+	RepairTypeForward  RepairType = 1 //补执行正向操作，使用正常状态
+	RepairTypeRollback RepairType = 2 //执行回滚操作，已执行的冲正，未执行的记录空回滚
+	RepairTypeManual   RepairType = 3 //无法自动修复，需人工处理
+)
+
+const (
+	ChainBreakReasonSeqGap   ChainBreakReason = 1 //链上序号不连续，链上的环被删除或序号被修改
+	ChainBreakReasonPrevHash ChainBreakReason = 2 //上一环哈希与链上前一环的哈希不一致
+	ChainBreakReasonHash     ChainBreakReason = 3 //哈希与本环内容不一致，链被修改
+	ChainBreakReasonRecord   ChainBreakReason = 4 //记录内容与链上该记录最新一环的摘要不一致，记录被修改或删除
 )
 
 const (
 	RecordTypeAdd    TransferType = 1 //增加
 	RecordTypeDeduct TransferType = 2 //减少
+	RecordTypeFreeze TransferType = 3 //冻结 解冻时记录状态变为回滚
 )
 
 const (
@@ -53,87 +75,116 @@ const (
 	StateStatusRollbackDone  StateStatus = 5 //回滚完成
 )
 
-func initOfficialAccount(officialAccountStepVal, officialAccountMinVal, officialAccountMaxVal int64) error {
+const (
+	OutboxStatusPending   OutboxStatus = 1 //待投递
+	OutboxStatusPublished OutboxStatus = 2 //已投递
+)
+
+// IsOutboxStateStatus 转移变为该状态时是否写入事件，只通知半成功、成功和回滚完成
+func IsOutboxStateStatus(status StateStatus) bool {
+	return status == StateStatusHalfSuccess || status == StateStatusSuccess || status == StateStatusRollbackDone
+}
+
+// OfficialAccount 官方账户区间配置
+// 官方账户按步长划分类型，转移时使用类型账户ID，实际按第一个非官方账户的余数分散到类型内的子账户，避免热点
+type OfficialAccount struct {
+	step int64 //官方账户类型步长
+	min  int64 //官方账户最小值
+	max  int64 //官方账户最大值
+}
+
+// NewOfficialAccount 创建官方账户配置，小于等于0的值使用默认值
+func NewOfficialAccount(officialAccountStepVal, officialAccountMinVal, officialAccountMaxVal int64) (*OfficialAccount, error) {
 	if officialAccountMaxVal < officialAccountStepVal {
-		return errors.New("official account max is less than official account step")
+		return nil, errors.New("official account max is less than official account step")
 	}
-
-	if officialAccountStepVal <= 0 {
-		officialAccountStep = DefaultOfficialAccountStep
-	} else {
-		officialAccountStep = officialAccountStepVal
+	o := &OfficialAccount{step: officialAccountStepVal, min: officialAccountMinVal, max: officialAccountMaxVal}
+	if o.step <= 0 {
+		o.step = DefaultOfficialAccountStep
 	}
-
-	if officialAccountMinVal <= 0 {
-		officialAccountMin = DefaultOfficialAccountMin
-	} else {
-		officialAccountMin = officialAccountMinVal
+	if o.min <= 0 {
+		o.min = DefaultOfficialAccountMin
+	}
+	if o.max <= 0 {
+		o.max = DefaultOfficialAccountMax
 	}
+	return o, nil
+}
+
+func (o *OfficialAccount) IsOfficialAccount(accountId int64) bool {
+	return accountId >= o.min && accountId <= o.max
+}
 
-	if officialAccountMaxVal <= 0 {
-		officialAccountMax = DefaultOfficialAccountMax
-	} else {
-		officialAccountMax = officialAccountMaxVal
+func (o *OfficialAccount) GetRemain(accountId int64) int64 {
+	return accountId % o.step
+}
+
+func (o *OfficialAccount) GetMixOfficialAccountId(officialAccountId, remain int64) int64 {
+	if remain == 0 {
+		return officialAccountId
 	}
-	return nil
+	return officialAccountId - o.step + remain
 }
 
-func initStateSplitNum(num int64) {
-	stateSplitNum = num
+func (o *OfficialAccount) CheckTransferOfficialAccount(accountId int64) bool {
+	return accountId%o.step == 0
 }
 
-func initRecordSplitNum(num int64) {
-	recordSplitNum = num
+// defaultOfficialAccount 包级初始化和包级函数使用的官方账户配置
+var defaultOfficialAccount, _ = NewOfficialAccount(0, 0, 0)
+
+func initOfficialAccount(officialAccountStepVal, officialAccountMinVal, officialAccountMaxVal int64) error {
+	o, err := NewOfficialAccount(officialAccountStepVal, officialAccountMinVal, officialAccountMaxVal)
+	if err != nil {
+		return err
+	}
+	defaultOfficialAccount = o
+	return nil
 }
 
-func initAccountSplitNum(num int64) {
-	accountSplitNum = num
+// GetDefaultOfficialAccount 获取包级初始化的官方账户配置
+func GetDefaultOfficialAccount() *OfficialAccount {
+	return defaultOfficialAccount
 }
 
 func IsOfficialAccount(accountId int64) bool {
-	return accountId >= officialAccountMin && accountId <= officialAccountMax
+	return defaultOfficialAccount.IsOfficialAccount(accountId)
 }
 
 func GetRemain(accountId int64) int64 {
-	return accountId % officialAccountStep
+	return defaultOfficialAccount.GetRemain(accountId)
 }
 
 func GetMixOfficialAccountId(officialAccountId, remain int64) int64 {
-	if remain == 0 {
-		return officialAccountId
-	}
-	return officialAccountId - officialAccountStep + remain
+	return defaultOfficialAccount.GetMixOfficialAccountId(officialAccountId, remain)
 }
 
 func CheckTransferOfficialAccount(accountId int64) bool {
-	return accountId%officialAccountStep == 0
+	return defaultOfficialAccount.CheckTransferOfficialAccount(accountId)
 }
 
-func GetStateTableSuffix(fromAccountId int64) string {
-	if stateSplitNum <= 1 {
-		return ""
-	}
-	return fmt.Sprintf("_%d", fromAccountId%stateSplitNum)
+func GetStateTableSuffix(transferId int64) string {
+	return GetLayout().GetStateTableSuffix(transferId)
 }
 
 func GetRecordTableSuffix(accountId int64) string {
-	if recordSplitNum <= 1 {
-		return ""
-	}
-	return fmt.Sprintf("_%d", accountId%recordSplitNum)
+	return GetLayout().GetRecordTableSuffix(accountId)
 }
 
 func GetAccountTableSuffix(accountId int64) string {
-	if accountSplitNum <= 1 {
-		return ""
-	}
-	return fmt.Sprintf("_%d", accountId%accountSplitNum)
+	return GetLayout().GetAccountTableSuffix(accountId)
 }
 
 func GetStateTableSplitNum() int64 {
-	return stateSplitNum
+	return GetLayout().stateSplitNum
 }
 
+// GetDBNum 记录和账户库的数量
 func GetDBNum() int64 {
-	return dbNum
+	return GetLayout().dbNum
+}
+
+// GetStateDBNum 转移状态库的数量
+func GetStateDBNum() int64 {
+	return GetLayout().stateDBNum
 }
@@ -16,31 +16,90 @@ CREATE TABLE `state`
 
 CREATE TABLE `record`
 (
-    `id`              bigint unsigned NOT NULL AUTO_INCREMENT COMMENT 'ID',
-    `account_id`      bigint        NOT NULL COMMENT '账户ID',
-    `transfer_id`     bigint        NOT NULL COMMENT '转移ID',
-    `transfer_scene`  int           NOT NULL COMMENT '转移场景',
-    `transfer_type`   int           NOT NULL COMMENT '转移类型',
-    `transfer_status` int           NOT NULL COMMENT '转移状态 1-正常 2-已回滚 3-空回滚',
-    `amount`          bigint        NOT NULL COMMENT '变动金额',
-    `item_type`       int           NOT NULL COMMENT '物品类型',
-    `change_type`     int           NOT NULL COMMENT '变动类型',
-    `comment`         varchar(1000) NOT NULL COMMENT '备注',
-    `created_at`      bigint        NOT NULL COMMENT '创建时间',
-    `updated_at`      bigint        NOT NULL COMMENT '更新时间',
+    `id`                     bigint unsigned NOT NULL AUTO_INCREMENT COMMENT 'ID',
+    `account_id`             bigint        NOT NULL COMMENT '账户ID',
+    `transfer_id`            bigint        NOT NULL COMMENT '转移ID',
+    `transfer_scene`         int           NOT NULL COMMENT '转移场景',
+    `transfer_type`          int           NOT NULL COMMENT '转移类型',
+    `transfer_status`        int           NOT NULL COMMENT '转移状态 1-正常 2-已回滚 3-空回滚 4-已扣款',
+    `amount`                 bigint        NOT NULL COMMENT '变动金额',
+    `refunded_amount`        bigint        NOT NULL COMMENT '已退款金额',
+    `item_type`              int           NOT NULL COMMENT '物品类型',
+    `change_type`            int           NOT NULL COMMENT '变动类型',
+    `comment`                varchar(1000) NOT NULL COMMENT '备注',
+    `expire_at`              bigint        NOT NULL COMMENT '冻结过期时间 0-不过期',
+    `balance_after`          bigint        NOT NULL COMMENT '操作后账户数量',
+    `sequence`               bigint        NOT NULL COMMENT '操作后账户序号 0-未变更数量',
+    `rollback_balance_after` bigint        NOT NULL COMMENT '回滚后账户数量',
+    `rollback_sequence`      bigint        NOT NULL COMMENT '回滚后账户序号 0-未回滚或未变更数量',
+    `created_at`             bigint        NOT NULL COMMENT '创建时间',
+    `updated_at`             bigint        NOT NULL COMMENT '更新时间',
     PRIMARY KEY (`id`),
     unique index uk_record (account_id, transfer_id, item_type, transfer_scene, transfer_type, change_type),
-    KEY idx_account (account_id, transfer_scene, item_type, transfer_type, change_type)
+    KEY idx_account (account_id, transfer_scene, item_type, transfer_type, change_type),
+    KEY idx_expire (transfer_type, transfer_status, expire_at)
 ) COMMENT '记录表';
 
+CREATE TABLE `record_chain`
+(
+    `id`             bigint unsigned NOT NULL AUTO_INCREMENT COMMENT 'ID',
+    `account_id`     bigint      NOT NULL COMMENT '账户ID',
+    `item_type`      int         NOT NULL COMMENT '物品类型',
+    `chain_seq`      bigint      NOT NULL COMMENT '哈希链序号',
+    `transfer_id`    bigint      NOT NULL COMMENT '记录的转移ID',
+    `transfer_scene` int         NOT NULL COMMENT '记录的转移场景',
+    `transfer_type`  int         NOT NULL COMMENT '记录的转移类型',
+    `change_type`    int         NOT NULL COMMENT '记录的变动类型',
+    `digest`         varchar(64) NOT NULL COMMENT '写入后记录内容的摘要',
+    `prev_hash`      varchar(64) NOT NULL COMMENT '哈希链上一环的哈希',
+    `hash`           varchar(64) NOT NULL COMMENT '本环哈希',
+    `created_at`     bigint      NOT NULL COMMENT '创建时间',
+    `updated_at`     bigint      NOT NULL COMMENT '更新时间',
+    PRIMARY KEY (`id`),
+    unique index uk_record_chain (account_id, item_type, chain_seq)
+) COMMENT '记录哈希链表';
+
 CREATE TABLE `account`
+(
+    `id`            bigint unsigned NOT NULL AUTO_INCREMENT COMMENT 'ID',
+    `account_id`    bigint NOT NULL COMMENT '账户ID',
+    `amount`        bigint NOT NULL COMMENT '物品数量',
+    `frozen_amount` bigint NOT NULL COMMENT '冻结数量',
+    `sequence`      bigint NOT NULL COMMENT '数量变更序号',
+    `item_type`     int    NOT NULL COMMENT '物品类型',
+    `created_at`    bigint NOT NULL COMMENT '创建时间',
+    `updated_at`    bigint NOT NULL COMMENT '更新时间',
+    PRIMARY KEY (`id`),
+    unique index uk_account (account_id, item_type)
+) COMMENT '账户表';
+
+CREATE TABLE `account_snapshot`
 (
     `id`         bigint unsigned NOT NULL AUTO_INCREMENT COMMENT 'ID',
     `account_id` bigint NOT NULL COMMENT '账户ID',
-    `amount`     bigint NOT NULL COMMENT '物品数量',
     `item_type`  int    NOT NULL COMMENT '物品类型',
+    `cut_off`    bigint NOT NULL COMMENT '截止时间',
+    `amount`     bigint NOT NULL COMMENT '截止时的物品数量',
+    `sequence`   bigint NOT NULL COMMENT '截止时的数量变更序号',
     `created_at` bigint NOT NULL COMMENT '创建时间',
     `updated_at` bigint NOT NULL COMMENT '更新时间',
     PRIMARY KEY (`id`),
-    unique index uk_account (account_id, item_type)
-) COMMENT '账户表';
\ No newline at end of file
+    unique index uk_snapshot (account_id, item_type, cut_off)
+) COMMENT '账户快照表';
+
+CREATE TABLE `outbox`
+(
+    `id`             bigint unsigned NOT NULL AUTO_INCREMENT COMMENT 'ID',
+    `transfer_id`    bigint        NOT NULL COMMENT '转移ID',
+    `transfer_scene` bigint        NOT NULL COMMENT '转移场景',
+    `from_status`    int           NOT NULL COMMENT '变更前的转移状态 0-创建',
+    `to_status`      int           NOT NULL COMMENT '变更后的转移状态 3-半成功 4-成功 5-已回滚',
+    `status`         int           NOT NULL COMMENT '投递状态 1-待投递 2-已投递',
+    `attempts`       int           NOT NULL COMMENT '投递失败次数',
+    `last_error`     varchar(1000) NOT NULL COMMENT '最近一次投递失败的原因',
+    `created_at`     bigint        NOT NULL COMMENT '创建时间',
+    `updated_at`     bigint        NOT NULL COMMENT '更新时间',
+    PRIMARY KEY (`id`),
+    unique index uk_outbox (transfer_id, transfer_scene, to_status),
+    KEY              `idx_outbox_status` (`status`, `id`)
+) COMMENT '转移状态事件表';
@@ -0,0 +1,117 @@
+-- PostgreSQL表结构，分表时表名追加分表后缀(如state_0)，索引名在同一schema下需唯一，同样追加后缀
+CREATE TABLE state
+(
+    id             bigserial     NOT NULL,
+    transfer_id    bigint        NOT NULL,
+    transfer_scene bigint        NOT NULL,
+    from_accounts  jsonb         NOT NULL,
+    to_accounts    jsonb         NOT NULL,
+    status         int           NOT NULL,
+    comment        varchar(1000) NOT NULL,
+    created_at     bigint        NOT NULL,
+    updated_at     bigint        NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT uk_state UNIQUE (transfer_id, transfer_scene)
+);
+CREATE INDEX status_updated_at_index ON state (status, updated_at);
+COMMENT ON TABLE state IS '转移状态表';
+COMMENT ON COLUMN state.status IS '状态 1-进行中 2-回滚中 3-半成功 4-成功 5-已回滚';
+
+CREATE TABLE record
+(
+    id                     bigserial     NOT NULL,
+    account_id             bigint        NOT NULL,
+    transfer_id            bigint        NOT NULL,
+    transfer_scene         int           NOT NULL,
+    transfer_type          int           NOT NULL,
+    transfer_status        int           NOT NULL,
+    amount                 bigint        NOT NULL,
+    refunded_amount        bigint        NOT NULL,
+    item_type              int           NOT NULL,
+    change_type            int           NOT NULL,
+    comment                varchar(1000) NOT NULL,
+    expire_at              bigint        NOT NULL,
+    balance_after          bigint        NOT NULL,
+    sequence               bigint        NOT NULL,
+    rollback_balance_after bigint        NOT NULL,
+    rollback_sequence      bigint        NOT NULL,
+    created_at             bigint        NOT NULL,
+    updated_at             bigint        NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT uk_record UNIQUE (account_id, transfer_id, item_type, transfer_scene, transfer_type, change_type)
+);
+CREATE INDEX idx_account ON record (account_id, transfer_scene, item_type, transfer_type, change_type);
+CREATE INDEX idx_expire ON record (transfer_type, transfer_status, expire_at);
+COMMENT ON TABLE record IS '记录表';
+COMMENT ON COLUMN record.transfer_status IS '转移状态 1-正常 2-已回滚 3-空回滚 4-已扣款';
+COMMENT ON COLUMN record.sequence IS '操作后账户序号 0-未变更数量';
+COMMENT ON COLUMN record.rollback_sequence IS '回滚后账户序号 0-未回滚或未变更数量';
+
+CREATE TABLE record_chain
+(
+    id             bigserial   NOT NULL,
+    account_id     bigint      NOT NULL,
+    item_type      int         NOT NULL,
+    chain_seq      bigint      NOT NULL,
+    transfer_id    bigint      NOT NULL,
+    transfer_scene int         NOT NULL,
+    transfer_type  int         NOT NULL,
+    change_type    int         NOT NULL,
+    digest         varchar(64) NOT NULL,
+    prev_hash      varchar(64) NOT NULL,
+    hash           varchar(64) NOT NULL,
+    created_at     bigint      NOT NULL,
+    updated_at     bigint      NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT uk_record_chain UNIQUE (account_id, item_type, chain_seq)
+);
+COMMENT ON TABLE record_chain IS '记录哈希链表';
+
+CREATE TABLE account
+(
+    id            bigserial NOT NULL,
+    account_id    bigint    NOT NULL,
+    amount        bigint    NOT NULL,
+    frozen_amount bigint    NOT NULL,
+    sequence      bigint    NOT NULL,
+    item_type     int       NOT NULL,
+    created_at    bigint    NOT NULL,
+    updated_at    bigint    NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT uk_account UNIQUE (account_id, item_type)
+);
+COMMENT ON TABLE account IS '账户表';
+
+CREATE TABLE account_snapshot
+(
+    id         bigserial NOT NULL,
+    account_id bigint    NOT NULL,
+    item_type  int       NOT NULL,
+    cut_off    bigint    NOT NULL,
+    amount     bigint    NOT NULL,
+    sequence   bigint    NOT NULL,
+    created_at bigint    NOT NULL,
+    updated_at bigint    NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT uk_snapshot UNIQUE (account_id, item_type, cut_off)
+);
+COMMENT ON TABLE account_snapshot IS '账户快照表';
+
+CREATE TABLE outbox
+(
+    id             bigserial     NOT NULL,
+    transfer_id    bigint        NOT NULL,
+    transfer_scene bigint        NOT NULL,
+    from_status    int           NOT NULL,
+    to_status      int           NOT NULL,
+    status         int           NOT NULL,
+    attempts       int           NOT NULL,
+    last_error     varchar(1000) NOT NULL,
+    created_at     bigint        NOT NULL,
+    updated_at     bigint        NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT uk_outbox UNIQUE (transfer_id, transfer_scene, to_status)
+);
+CREATE INDEX idx_outbox_status ON outbox (status, id);
+COMMENT ON TABLE outbox IS '转移状态事件表';
+COMMENT ON COLUMN outbox.status IS '投递状态 1-待投递 2-已投递';
@@ -0,0 +1,95 @@
+-- SQLite表结构，分表时表名和索引名追加分表后缀(如state_0)，可使用cmd/fisher-schema按配置生成
+CREATE TABLE IF NOT EXISTS state
+(
+    id integer PRIMARY KEY AUTOINCREMENT,
+    transfer_id bigint NOT NULL,
+    transfer_scene bigint NOT NULL,
+    from_accounts text NOT NULL,
+    to_accounts text NOT NULL,
+    status int NOT NULL,
+    comment text NOT NULL,
+    created_at bigint NOT NULL,
+    updated_at bigint NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_state ON state (transfer_id, transfer_scene);
+CREATE INDEX IF NOT EXISTS status_updated_at_index ON state (status, updated_at);
+CREATE TABLE IF NOT EXISTS record
+(
+    id integer PRIMARY KEY AUTOINCREMENT,
+    account_id bigint NOT NULL,
+    transfer_id bigint NOT NULL,
+    transfer_scene int NOT NULL,
+    transfer_type int NOT NULL,
+    transfer_status int NOT NULL,
+    amount bigint NOT NULL,
+    refunded_amount bigint NOT NULL,
+    item_type int NOT NULL,
+    change_type int NOT NULL,
+    comment text NOT NULL,
+    expire_at bigint NOT NULL,
+    balance_after bigint NOT NULL,
+    sequence bigint NOT NULL,
+    rollback_balance_after bigint NOT NULL,
+    rollback_sequence bigint NOT NULL,
+    created_at bigint NOT NULL,
+    updated_at bigint NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_record ON record (account_id, transfer_id, item_type, transfer_scene, transfer_type, change_type);
+CREATE INDEX IF NOT EXISTS idx_account ON record (account_id, transfer_scene, item_type, transfer_type, change_type);
+CREATE INDEX IF NOT EXISTS idx_expire ON record (transfer_type, transfer_status, expire_at);
+CREATE TABLE IF NOT EXISTS record_chain
+(
+    id integer PRIMARY KEY AUTOINCREMENT,
+    account_id bigint NOT NULL,
+    item_type int NOT NULL,
+    chain_seq bigint NOT NULL,
+    transfer_id bigint NOT NULL,
+    transfer_scene int NOT NULL,
+    transfer_type int NOT NULL,
+    change_type int NOT NULL,
+    digest text NOT NULL,
+    prev_hash text NOT NULL,
+    hash text NOT NULL,
+    created_at bigint NOT NULL,
+    updated_at bigint NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_record_chain ON record_chain (account_id, item_type, chain_seq);
+CREATE TABLE IF NOT EXISTS account
+(
+    id integer PRIMARY KEY AUTOINCREMENT,
+    account_id bigint NOT NULL,
+    amount bigint NOT NULL,
+    frozen_amount bigint NOT NULL,
+    sequence bigint NOT NULL,
+    item_type int NOT NULL,
+    created_at bigint NOT NULL,
+    updated_at bigint NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_account ON account (account_id, item_type);
+CREATE TABLE IF NOT EXISTS account_snapshot
+(
+    id integer PRIMARY KEY AUTOINCREMENT,
+    account_id bigint NOT NULL,
+    item_type int NOT NULL,
+    cut_off bigint NOT NULL,
+    amount bigint NOT NULL,
+    sequence bigint NOT NULL,
+    created_at bigint NOT NULL,
+    updated_at bigint NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_snapshot ON account_snapshot (account_id, item_type, cut_off);
+CREATE TABLE IF NOT EXISTS outbox
+(
+    id integer PRIMARY KEY AUTOINCREMENT,
+    transfer_id bigint NOT NULL,
+    transfer_scene bigint NOT NULL,
+    from_status int NOT NULL,
+    to_status int NOT NULL,
+    status int NOT NULL,
+    attempts int NOT NULL,
+    last_error text NOT NULL,
+    created_at bigint NOT NULL,
+    updated_at bigint NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uk_outbox ON outbox (transfer_id, transfer_scene, to_status);
+CREATE INDEX IF NOT EXISTS idx_outbox_status ON outbox (status, id);
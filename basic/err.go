@@ -3,24 +3,31 @@ package basic
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 type ErrCode int
 
 const (
-	ParamsErrCode             ErrCode = 1
-	AlreadyRolledBackErrCode  ErrCode = 2
-	StateMutationErrCode      ErrCode = 3
-	InsufficientAmountErrCode ErrCode = 4
-	DBFailedErrCode           ErrCode = 5
+	ParamsErrCode              ErrCode = 1
+	AlreadyRolledBackErrCode   ErrCode = 2
+	StateMutationErrCode       ErrCode = 3
+	InsufficientAmountErrCode  ErrCode = 4
+	DBFailedErrCode            ErrCode = 5
+	ExpiredErrCode             ErrCode = 6
+	RefundExceededErrCode      ErrCode = 7
+	IdempotencyConflictErrCode ErrCode = 8
 )
 
 var (
-	ParamsErr             = New(ParamsErrCode, "[fisher] params error")
-	AlreadyRolledBackErr  = New(AlreadyRolledBackErrCode, "[fisher] already rolled back")
-	StateMutationErr      = New(StateMutationErrCode, "[fisher] state mutation")
-	InsufficientAmountErr = New(InsufficientAmountErrCode, "[fisher] insufficient amount")
-	DBFailedErr           = New(DBFailedErrCode, "[fisher] db failed")
+	ParamsErr              = New(ParamsErrCode, "[fisher] params error")
+	AlreadyRolledBackErr   = New(AlreadyRolledBackErrCode, "[fisher] already rolled back")
+	StateMutationErr       = New(StateMutationErrCode, "[fisher] state mutation")
+	InsufficientAmountErr  = New(InsufficientAmountErrCode, "[fisher] insufficient amount")
+	DBFailedErr            = New(DBFailedErrCode, "[fisher] db failed")
+	ExpiredErr             = New(ExpiredErrCode, "[fisher] freeze expired")
+	RefundExceededErr      = New(RefundExceededErrCode, "[fisher] refund exceeds transferred amount")
+	IdempotencyConflictErr = New(IdempotencyConflictErrCode, "[fisher] idempotency conflict")
 )
 
 type FisherErr struct {
@@ -54,6 +61,24 @@ func NewParamsError(err error) error {
 	return New(ParamsErrCode, err.Error())
 }
 
+// IdempotencyConflictError 转移ID被不同内容的请求复用，Diff为已有转移与请求的差异，便于排查
+type IdempotencyConflictError struct {
+	Diff []string
+}
+
+// NewIdempotencyConflict 创建幂等冲突错误，通过Is(err, IdempotencyConflictErr)判断，errors.As获取差异
+func NewIdempotencyConflict(diff []string) error {
+	return &IdempotencyConflictError{Diff: diff}
+}
+
+func (e *IdempotencyConflictError) Error() string {
+	return e.Unwrap().Error()
+}
+
+func (e *IdempotencyConflictError) Unwrap() error {
+	return New(IdempotencyConflictErrCode, fmt.Sprintf("[fisher] idempotency conflict: %s", strings.Join(e.Diff, "; ")))
+}
+
 func Is(err, target error) bool {
 	if errors.Is(err, target) {
 		return true
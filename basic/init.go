@@ -6,13 +6,18 @@ import (
 )
 
 type TransferConf struct {
-	DBs                 []*gorm.DB `json:"-"`
-	StateSplitNum       int64      `json:"state_split_num"`       //转移状态分表数量 按转移ID取模分表
-	RecordSplitNum      int64      `json:"record_split_num"`      //转移记录分表数量 按账户ID取模分表
-	AccountSplitNum     int64      `json:"account_split_num"`     //账户分表数量 按账户ID取模分表
-	OfficialAccountStep int64      `json:"official_account_step"` //官方账户类型步长
-	OfficialAccountMin  int64      `json:"official_account_min"`  //官方账户最小值
-	OfficialAccountMax  int64      `json:"official_account_max"`  //官方账户最大值
+	DBs                 []*gorm.DB       `json:"-"`                     //记录和账户所在的库，未配置StateDBs时同时存放转移状态
+	StateDBs            []*gorm.DB       `json:"-"`                     //转移状态所在的库 为空时使用DBs
+	Router              ShardRouter      `json:"-"`                     //分片路由 为空时按ID取模
+	StateSplitNum       int64            `json:"state_split_num"`       //转移状态分表数量 按转移ID路由分表
+	RecordSplitNum      int64            `json:"record_split_num"`      //转移记录分表数量 按账户ID路由分表
+	AccountSplitNum     int64            `json:"account_split_num"`     //账户分表数量 按账户ID路由分表
+	OfficialAccountStep int64            `json:"official_account_step"` //官方账户类型步长
+	OfficialAccountMin  int64            `json:"official_account_min"`  //官方账户最小值
+	OfficialAccountMax  int64            `json:"official_account_max"`  //官方账户最大值
+	VerifySchema        bool             `json:"verify_schema"`         //初始化时校验每个库上的表、列和唯一索引，不通过则初始化失败
+	TablePrefix         string           `json:"table_prefix"`          //表名前缀 默认为空，用于在同一组库上放置多个账本
+	Namespaces          []*NamespaceConf `json:"namespaces"`            //命名空间 每个命名空间是一个独立的账本，通过service.NewLedgers使用
 }
 
 // InitWithDefault 使用默认配置初始化
@@ -36,13 +41,33 @@ func InitWithConf(conf *TransferConf) error {
 	if len(conf.DBs) == 0 {
 		return errors.New("db is nil")
 	}
-	initItemTransferDB(conf.DBs)
-	err := initOfficialAccount(conf.OfficialAccountStep, conf.OfficialAccountMin, conf.OfficialAccountMax)
+	if err := conf.CheckNamespaces(); err != nil {
+		return err
+	}
+	if conf.VerifySchema {
+		if err := VerifySchema(conf); err != nil {
+			return err
+		}
+	}
+	return InitWithoutDB(conf)
+}
+
+// InitWithoutDB 仅初始化官方账户与分表配置，不校验和初始化数据库，适用于内存存储等非gorm存储
+func InitWithoutDB(conf *TransferConf) error {
+	if conf == nil {
+		return errors.New("conf is nil")
+	}
+	if len(conf.Namespaces) != 0 {
+		return errors.New("conf with namespaces must be created by service.NewLedgers")
+	}
+	layout, err := NewLayout(conf)
+	if err != nil {
+		return err
+	}
+	err = initOfficialAccount(conf.OfficialAccountStep, conf.OfficialAccountMin, conf.OfficialAccountMax)
 	if err != nil {
 		return err
 	}
-	initStateSplitNum(conf.StateSplitNum)
-	initRecordSplitNum(conf.RecordSplitNum)
-	initAccountSplitNum(conf.AccountSplitNum)
+	initItemTransferDB(layout)
 	return nil
 }
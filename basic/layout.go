@@ -0,0 +1,290 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// Layout 分库分表布局，决定转移状态、记录和账户所在的库和表
+// 转移状态按转移ID路由，记录和账户按账户ID路由，同一账户的记录和账户始终在同一个库上，保证本地事务
+// 转移状态可以使用单独的一组库，未配置时与记录和账户共用
+type Layout struct {
+	router          ShardRouter
+	tablePrefix     string     //表名前缀，区分同一组库上的多个账本
+	dbs             []*gorm.DB //记录和账户所在的库
+	dbNum           int64
+	stateDBs        []*gorm.DB //转移状态所在的库
+	stateDBNum      int64
+	stateSplitNum   int64
+	recordSplitNum  int64
+	accountSplitNum int64
+}
+
+// NewLayout 根据配置创建布局，分表数量小于等于0时使用默认值，未配置路由时按ID取模
+// 路由实现ShardRangeChecker时校验其库和分表下标，超出范围返回错误，避免在请求中panic
+func NewLayout(conf *TransferConf) (*Layout, error) {
+	router := conf.Router
+	if router == nil {
+		router = ModuloRouter{}
+	}
+	stateDBs := conf.StateDBs
+	if len(stateDBs) == 0 {
+		stateDBs = conf.DBs
+	}
+	layout := &Layout{
+		router:          router,
+		tablePrefix:     conf.TablePrefix,
+		dbs:             conf.DBs,
+		dbNum:           int64(len(conf.DBs)),
+		stateDBs:        stateDBs,
+		stateDBNum:      int64(len(stateDBs)),
+		stateSplitNum:   splitNumOrDefault(conf.StateSplitNum, DefaultStateSplitNum),
+		recordSplitNum:  splitNumOrDefault(conf.RecordSplitNum, DefaultRecordSplitNum),
+		accountSplitNum: splitNumOrDefault(conf.AccountSplitNum, DefaultAccountSplitNum),
+	}
+	if checker, ok := router.(ShardRangeChecker); ok {
+		for _, kind := range []ShardKind{ShardKindState, ShardKindRecord, ShardKindAccount} {
+			if err := checker.CheckRange(kind, layout.GetShardDBNum(kind), layout.GetShardTableSplitNum(kind)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return layout, nil
+}
+
+func splitNumOrDefault(num, defaultNum int64) int64 {
+	if num <= 0 {
+		return defaultNum
+	}
+	return num
+}
+
+// route 经路由获取库下标和分表下标，超出范围说明路由实现错误，继续执行会写错库表，直接panic
+func (l *Layout) route(kind ShardKind, id, splitNum int64) (int64, int64) {
+	dbNum := l.GetShardDBNum(kind)
+	dbIdx, tableIdx := l.router.Route(kind, id, dbNum, splitNum)
+	if dbIdx < 0 || (dbNum > 0 && dbIdx >= dbNum) || tableIdx < 0 || tableIdx >= splitNum {
+		panic(fmt.Sprintf("[fisher] shard router routes kind %d id %d to db %d table %d, out of range db num %d split num %d",
+			kind, id, dbIdx, tableIdx, dbNum, splitNum))
+	}
+	return dbIdx, tableIdx
+}
+
+func (l *Layout) tableSuffix(kind ShardKind, id, splitNum int64) string {
+	if splitNum <= 1 {
+		return ""
+	}
+	_, tableIdx := l.route(kind, id, splitNum)
+	return fmt.Sprintf("_%d", tableIdx)
+}
+
+// GetTablePrefix 表名前缀
+func (l *Layout) GetTablePrefix() string {
+	return l.tablePrefix
+}
+
+// GetDB 获取下标对应的记录和账户库
+func (l *Layout) GetDB(idx int64) *gorm.DB {
+	return l.dbs[idx]
+}
+
+// GetDBNum 记录和账户库的数量
+func (l *Layout) GetDBNum() int64 {
+	return l.dbNum
+}
+
+// GetStateDB 获取下标对应的转移状态库
+func (l *Layout) GetStateDB(idx int64) *gorm.DB {
+	return l.stateDBs[idx]
+}
+
+// GetStateDBNum 转移状态库的数量
+func (l *Layout) GetStateDBNum() int64 {
+	return l.stateDBNum
+}
+
+// GetShardDB 获取该类数据下标对应的库
+func (l *Layout) GetShardDB(kind ShardKind, idx int64) *gorm.DB {
+	if kind == ShardKindState {
+		return l.stateDBs[idx]
+	}
+	return l.dbs[idx]
+}
+
+// GetShardDBNum 该类数据所在库的数量
+func (l *Layout) GetShardDBNum(kind ShardKind) int64 {
+	if kind == ShardKindState {
+		return l.stateDBNum
+	}
+	return l.dbNum
+}
+
+// GetShardTableSplitNum 该类数据的分表数量
+func (l *Layout) GetShardTableSplitNum(kind ShardKind) int64 {
+	switch kind {
+	case ShardKindState:
+		return l.stateSplitNum
+	case ShardKindRecord:
+		return l.recordSplitNum
+	}
+	return l.accountSplitNum
+}
+
+func (l *Layout) GetStateTableSplitNum() int64 {
+	return l.stateSplitNum
+}
+
+func (l *Layout) GetRecordTableSplitNum() int64 {
+	return l.recordSplitNum
+}
+
+func (l *Layout) GetAccountTableSplitNum() int64 {
+	return l.accountSplitNum
+}
+
+func (l *Layout) GetStateDBIndex(transferId int64) int64 {
+	dbIdx, _ := l.route(ShardKindState, transferId, l.stateSplitNum)
+	return dbIdx
+}
+
+// GetRecordAndAccountDBIndex 记录和账户所在的库，取账户的路由结果
+func (l *Layout) GetRecordAndAccountDBIndex(accountId int64) int64 {
+	dbIdx, _ := l.route(ShardKindAccount, accountId, l.accountSplitNum)
+	return dbIdx
+}
+
+func (l *Layout) GetStateTableSuffix(transferId int64) string {
+	return l.tableSuffix(ShardKindState, transferId, l.stateSplitNum)
+}
+
+func (l *Layout) GetRecordTableSuffix(accountId int64) string {
+	return l.tableSuffix(ShardKindRecord, accountId, l.recordSplitNum)
+}
+
+func (l *Layout) GetAccountTableSuffix(accountId int64) string {
+	return l.tableSuffix(ShardKindAccount, accountId, l.accountSplitNum)
+}
+
+func (l *Layout) GetStateTableName(transferId int64) string {
+	return l.tablePrefix + StateTablePrefix + l.GetStateTableSuffix(transferId)
+}
+
+func (l *Layout) GetRecordTableName(accountId int64) string {
+	return l.tablePrefix + RecordTablePrefix + l.GetRecordTableSuffix(accountId)
+}
+
+func (l *Layout) GetAccountTableName(accountId int64) string {
+	return l.tablePrefix + AccountTablePrefix + l.GetAccountTableSuffix(accountId)
+}
+
+// GetRecordChainTableName 记录哈希链表名，与记录表使用相同的分表后缀
+func (l *Layout) GetRecordChainTableName(accountId int64) string {
+	return l.tablePrefix + RecordChainTablePrefix + l.GetRecordTableSuffix(accountId)
+}
+
+// GetOutboxTableName 转移状态事件表名，与转移状态表使用相同的分表后缀
+func (l *Layout) GetOutboxTableName(transferId int64) string {
+	return l.tablePrefix + OutboxTablePrefix + l.GetStateTableSuffix(transferId)
+}
+
+// GetAccountSnapshotTableName 账户快照表名，与账户表使用相同的分表后缀
+func (l *Layout) GetAccountSnapshotTableName(accountId int64) string {
+	return l.tablePrefix + AccountSnapshotTablePrefix + l.GetAccountTableSuffix(accountId)
+}
+
+func (l *Layout) GetStateWriteDB(ctx context.Context, transferId int64) *gorm.DB {
+	return l.stateDBs[l.GetStateDBIndex(transferId)].Clauses(dbresolver.Write).WithContext(ctx)
+}
+
+func (l *Layout) GetStateReadDB(ctx context.Context, transferId int64) *gorm.DB {
+	return l.stateDBs[l.GetStateDBIndex(transferId)].Clauses(dbresolver.Read).WithContext(ctx)
+}
+
+func (l *Layout) GetRecordAndAccountWriteDB(ctx context.Context, accountId int64) *gorm.DB {
+	return l.dbs[l.GetRecordAndAccountDBIndex(accountId)].Clauses(dbresolver.Write).WithContext(ctx)
+}
+
+func (l *Layout) GetRecordAndAccountReadDB(ctx context.Context, accountId int64) *gorm.DB {
+	return l.dbs[l.GetRecordAndAccountDBIndex(accountId)].Clauses(dbresolver.Read).WithContext(ctx)
+}
+
+// LayoutManager 管理当前布局和重新分片期间的影子布局，每个客户端实例持有一个
+type LayoutManager struct {
+	current atomic.Pointer[Layout] //当前生效的布局
+	shadow  atomic.Pointer[Layout] //重新分片期间双写的影子布局，为空表示未在迁移
+	gate    sync.RWMutex           //切换布局时等待进行中的操作结束
+}
+
+// NewLayoutManager 创建布局管理，layout为初始生效的布局
+func NewLayoutManager(layout *Layout) *LayoutManager {
+	m := &LayoutManager{}
+	m.current.Store(layout)
+	return m
+}
+
+// GetLayout 获取当前生效的布局
+func (m *LayoutManager) GetLayout() *Layout {
+	return m.current.Load()
+}
+
+// GetShadowLayout 获取影子布局，未在迁移时为空
+func (m *LayoutManager) GetShadowLayout() *Layout {
+	return m.shadow.Load()
+}
+
+// AcquireLayout 获取当前布局和影子布局，操作结束后需调用release
+// 持有期间布局不会被切换，需要双写的操作应在release前完成对影子布局的同步
+func (m *LayoutManager) AcquireLayout() (layout, shadow *Layout, release func()) {
+	m.gate.RLock()
+	return m.current.Load(), m.shadow.Load(), m.gate.RUnlock
+}
+
+// FreezeLayout 阻塞新的操作并等待进行中的操作结束，返回解冻函数，冻结期间可调用SwitchLayout切换布局
+func (m *LayoutManager) FreezeLayout() (unfreeze func()) {
+	m.gate.Lock()
+	return m.gate.Unlock
+}
+
+// SwitchLayout 切换当前布局和影子布局，需在FreezeLayout冻结期间调用
+func (m *LayoutManager) SwitchLayout(layout, shadow *Layout) {
+	m.current.Store(layout)
+	m.shadow.Store(shadow)
+}
+
+// defaultLayoutManager 包级初始化和包级函数使用的布局管理
+var defaultLayoutManager = NewLayoutManager(&Layout{router: ModuloRouter{}, stateSplitNum: DefaultStateSplitNum, recordSplitNum: DefaultRecordSplitNum, accountSplitNum: DefaultAccountSplitNum})
+
+// GetDefaultLayoutManager 获取包级初始化使用的布局管理
+func GetDefaultLayoutManager() *LayoutManager {
+	return defaultLayoutManager
+}
+
+// GetLayout 获取包级初始化的当前布局
+func GetLayout() *Layout {
+	return defaultLayoutManager.GetLayout()
+}
+
+// GetShadowLayout 获取包级初始化的影子布局
+func GetShadowLayout() *Layout {
+	return defaultLayoutManager.GetShadowLayout()
+}
+
+// AcquireLayout 见LayoutManager.AcquireLayout
+func AcquireLayout() (layout, shadow *Layout, release func()) {
+	return defaultLayoutManager.AcquireLayout()
+}
+
+// FreezeLayout 见LayoutManager.FreezeLayout
+func FreezeLayout() (unfreeze func()) {
+	return defaultLayoutManager.FreezeLayout()
+}
+
+// SwitchLayout 见LayoutManager.SwitchLayout
+func SwitchLayout(layout, shadow *Layout) {
+	defaultLayoutManager.SwitchLayout(layout, shadow)
+}
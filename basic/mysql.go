@@ -3,63 +3,34 @@ package basic
 import (
 	"context"
 
-	"gorm.io/plugin/dbresolver"
-
 	"gorm.io/gorm"
 )
 
-var fisherDBs []*gorm.DB
-
-// initItemTransferDB 初始化物品转移数据库
-func initItemTransferDB(dbs []*gorm.DB) {
-	fisherDBs = dbs
-	dbNum = int64(len(dbs))
+// initItemTransferDB 初始化物品转移数据库及分表布局
+func initItemTransferDB(layout *Layout) {
+	defaultLayoutManager.current.Store(layout)
 }
 
 func GetStateWriteDB(ctx context.Context, transferId int64) *gorm.DB {
-	idx := 0
-	if dbNum >= 1 {
-		idx = int(transferId % dbNum)
-	}
-	return fisherDBs[idx].Clauses(dbresolver.Write).WithContext(ctx)
+	return GetLayout().GetStateWriteDB(ctx, transferId)
 }
 
 func GetRecordAndAccountWriteDB(ctx context.Context, accountId int64) *gorm.DB {
-	idx := 0
-	if dbNum >= 1 {
-		idx = int(accountId % dbNum)
-	}
-	return fisherDBs[idx].Clauses(dbresolver.Write).WithContext(ctx)
+	return GetLayout().GetRecordAndAccountWriteDB(ctx, accountId)
 }
 
 func GetAccountWriteDB(ctx context.Context, accountId int64) *gorm.DB {
-	idx := 0
-	if dbNum >= 1 {
-		idx = int(accountId % dbNum)
-	}
-	return fisherDBs[idx].Clauses(dbresolver.Write).WithContext(ctx)
+	return GetLayout().GetRecordAndAccountWriteDB(ctx, accountId)
 }
 
 func GetAccountReadDB(ctx context.Context, accountId int64) *gorm.DB {
-	idx := 0
-	if dbNum >= 1 {
-		idx = int(accountId % dbNum)
-	}
-	return fisherDBs[idx].Clauses(dbresolver.Read).WithContext(ctx)
+	return GetLayout().GetRecordAndAccountReadDB(ctx, accountId)
 }
 
 func GetStateReadDB(ctx context.Context, transferId int64) *gorm.DB {
-	idx := 0
-	if dbNum >= 1 {
-		idx = int(transferId % dbNum)
-	}
-	return fisherDBs[idx].Clauses(dbresolver.Read).WithContext(ctx)
+	return GetLayout().GetStateReadDB(ctx, transferId)
 }
 
 func GetRecordAndAccountReadDB(ctx context.Context, accountId int64) *gorm.DB {
-	idx := 0
-	if dbNum >= 1 {
-		idx = int(accountId % dbNum)
-	}
-	return fisherDBs[idx].Clauses(dbresolver.Read).WithContext(ctx)
+	return GetLayout().GetRecordAndAccountReadDB(ctx, accountId)
 }
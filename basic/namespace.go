@@ -0,0 +1,95 @@
+package basic
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// NamespaceConf 命名空间配置，同一组库上的每个命名空间是一个独立的账本
+// 各命名空间使用各自前缀的表，账户、记录和转移状态互不相通，官方账户区间也各自配置
+type NamespaceConf struct {
+	Name                string `json:"name"`                  //命名空间名称
+	TablePrefix         string `json:"table_prefix"`          //表名前缀 为空时使用名称加下划线
+	OfficialAccountStep int64  `json:"official_account_step"` //官方账户类型步长 为0时使用TransferConf中的配置
+	OfficialAccountMin  int64  `json:"official_account_min"`  //官方账户最小值 为0时使用TransferConf中的配置
+	OfficialAccountMax  int64  `json:"official_account_max"`  //官方账户最大值 为0时使用TransferConf中的配置
+}
+
+// GetTablePrefix 获取表名前缀
+func (n *NamespaceConf) GetTablePrefix() string {
+	if n.TablePrefix == "" {
+		return n.Name + "_"
+	}
+	return n.TablePrefix
+}
+
+// tablePrefixPattern 表名前缀只允许小写字母、数字和下划线，会直接拼接到建表语句中
+var tablePrefixPattern = regexp.MustCompile(`^[a-z0-9_]*$`)
+
+// CheckNamespaces 校验表名前缀和命名空间，名称和表名前缀均不能重复
+func (c *TransferConf) CheckNamespaces() error {
+	if !tablePrefixPattern.MatchString(c.TablePrefix) {
+		return errors.Errorf("table prefix %q contains characters other than [a-z0-9_]", c.TablePrefix)
+	}
+	names := make(map[string]bool, len(c.Namespaces))
+	prefixes := make(map[string]bool, len(c.Namespaces))
+	for _, ns := range c.Namespaces {
+		if ns == nil || ns.Name == "" {
+			return errors.New("namespace name is empty")
+		}
+		prefix := ns.GetTablePrefix()
+		if !tablePrefixPattern.MatchString(prefix) {
+			return errors.Errorf("table prefix %q of namespace %s contains characters other than [a-z0-9_]", prefix, ns.Name)
+		}
+		if names[ns.Name] {
+			return errors.Errorf("namespace %s is duplicated", ns.Name)
+		}
+		if prefixes[prefix] {
+			return errors.Errorf("table prefix %q of namespace %s is duplicated", prefix, ns.Name)
+		}
+		names[ns.Name] = true
+		prefixes[prefix] = true
+	}
+	return nil
+}
+
+// GetNamespaceConf 获取命名空间的账本配置，库、路由和分表数量与conf相同，表名前缀和官方账户区间取命名空间的配置
+func (c *TransferConf) GetNamespaceConf(name string) (*TransferConf, error) {
+	for _, ns := range c.Namespaces {
+		if ns != nil && ns.Name == name {
+			return c.namespaceConf(ns), nil
+		}
+	}
+	return nil, errors.Errorf("namespace %s not found", name)
+}
+
+func (c *TransferConf) namespaceConf(ns *NamespaceConf) *TransferConf {
+	conf := *c
+	conf.Namespaces = nil
+	conf.TablePrefix = ns.GetTablePrefix()
+	if ns.OfficialAccountStep != 0 {
+		conf.OfficialAccountStep = ns.OfficialAccountStep
+	}
+	if ns.OfficialAccountMin != 0 {
+		conf.OfficialAccountMin = ns.OfficialAccountMin
+	}
+	if ns.OfficialAccountMax != 0 {
+		conf.OfficialAccountMax = ns.OfficialAccountMax
+	}
+	return &conf
+}
+
+// GetLedgerConfs 获取配置下全部账本的配置，未配置命名空间时即为conf本身
+func (c *TransferConf) GetLedgerConfs() []*TransferConf {
+	if len(c.Namespaces) == 0 {
+		return []*TransferConf{c}
+	}
+	confs := make([]*TransferConf, 0, len(c.Namespaces))
+	for _, ns := range c.Namespaces {
+		if ns != nil {
+			confs = append(confs, c.namespaceConf(ns))
+		}
+	}
+	return confs
+}
@@ -0,0 +1,212 @@
+package basic
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+type ShardKind int //分片数据类型
+
+const (
+	ShardKindState   ShardKind = 1 //转移状态 按转移ID路由
+	ShardKindRecord  ShardKind = 2 //转移记录 按账户ID路由
+	ShardKindAccount ShardKind = 3 //账户 按账户ID路由
+)
+
+// ShardRouter 分片路由，将数据类型和ID映射到库下标和分表下标
+// dbNum为库数量，splitNum为该类数据的分表数量，返回值需分别在[0, dbNum)和[0, splitNum)内
+// 同一账户的记录和账户需在同一个库上以保证本地事务，记录所在的库始终取账户的路由结果，记录的路由只决定分表
+type ShardRouter interface {
+	Route(kind ShardKind, id, dbNum, splitNum int64) (dbIdx, tableIdx int64)
+}
+
+// ShardRangeChecker 路由结果由配置决定的路由需实现，创建布局时校验配置的库和分表下标是否在范围内
+// 未实现时认为路由结果始终在[0, dbNum)和[0, splitNum)内
+type ShardRangeChecker interface {
+	CheckRange(kind ShardKind, dbNum, splitNum int64) error
+}
+
+// ModuloRouter 按ID取模路由，默认路由
+type ModuloRouter struct{}
+
+func (ModuloRouter) Route(_ ShardKind, id, dbNum, splitNum int64) (int64, int64) {
+	return modulo(id, dbNum), modulo(id, splitNum)
+}
+
+func modulo(id, num int64) int64 {
+	if num <= 1 {
+		return 0
+	}
+	return id % num
+}
+
+// ConsistentHashRouter 带虚拟节点的一致性哈希路由，增加库或分表时只有少部分数据需要迁移
+type ConsistentHashRouter struct {
+	VirtualNodes int   //每个节点的虚拟节点数量
+	Weights      []int //库的权重，虚拟节点数量按权重放大，用于容量不同的库，未配置的库权重为1
+
+	mu    sync.RWMutex
+	rings map[ringKey]*hashRing
+}
+
+type ringKey struct {
+	num      int64
+	weighted bool
+}
+
+// NewConsistentHashRouter 创建一致性哈希路由，virtualNodes小于等于0时使用默认值160
+func NewConsistentHashRouter(virtualNodes int, weights ...int) *ConsistentHashRouter {
+	if virtualNodes <= 0 {
+		virtualNodes = 160
+	}
+	return &ConsistentHashRouter{VirtualNodes: virtualNodes, Weights: weights}
+}
+
+func (r *ConsistentHashRouter) Route(_ ShardKind, id, dbNum, splitNum int64) (int64, int64) {
+	h := hashId(id)
+	//分表使用与库不同的哈希，避免同一库上的数据集中在部分分表
+	return r.ring(dbNum, true).locate(h), r.ring(splitNum, false).locate(mix(h))
+}
+
+func (r *ConsistentHashRouter) ring(num int64, weighted bool) *hashRing {
+	key := ringKey{num: num, weighted: weighted}
+	r.mu.RLock()
+	ring, ok := r.rings[key]
+	r.mu.RUnlock()
+	if ok {
+		return ring
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ring, ok = r.rings[key]; ok {
+		return ring
+	}
+	ring = &hashRing{}
+	for node := int64(0); node < num; node++ {
+		weight := 1
+		if weighted && int(node) < len(r.Weights) && r.Weights[node] > 0 {
+			weight = r.Weights[node]
+		}
+		for i := 0; i < r.VirtualNodes*weight; i++ {
+			ring.points = append(ring.points, ringPoint{hash: hashString(fmt.Sprintf("node-%d#%d", node, i)), node: node})
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool { return ring.points[i].hash < ring.points[j].hash })
+	if r.rings == nil {
+		r.rings = make(map[ringKey]*hashRing)
+	}
+	r.rings[key] = ring
+	return ring
+}
+
+type ringPoint struct {
+	hash uint64
+	node int64
+}
+
+type hashRing struct {
+	points []ringPoint
+}
+
+// locate 顺时针找到第一个不小于h的虚拟节点
+func (r *hashRing) locate(h uint64) int64 {
+	if len(r.points) <= 1 {
+		return 0
+	}
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].node
+}
+
+func hashId(id int64) uint64 {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(id))
+	h := fnv.New64a()
+	_, _ = h.Write(b[:])
+	return mix(h.Sum64())
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	return mix(h.Sum64())
+}
+
+// mix splitmix64的混淆步骤，使fnv结果在环上分布均匀
+func mix(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// DirectoryEntry 目录路由条目，[MinId, MaxId]区间内的ID路由到指定的库和分表
+type DirectoryEntry struct {
+	Kind  ShardKind `json:"kind"`   //数据类型，账户条目同时决定记录所在的库
+	MinId int64     `json:"min_id"` //最小ID
+	MaxId int64     `json:"max_id"` //最大ID，单个ID时与MinId相同
+	DB    int64     `json:"db"`     //库下标
+	Table int64     `json:"table"`  //分表下标
+}
+
+// DirectoryRouter 按目录路由，用于将热点账户或ID区间放到指定的库和分表，目录未命中的ID使用Fallback路由
+type DirectoryRouter struct {
+	Fallback ShardRouter //未命中时的路由，为空时使用ModuloRouter
+	entries  map[ShardKind][]DirectoryEntry
+}
+
+// NewDirectoryRouter 创建目录路由，同一类数据的区间不能重叠
+func NewDirectoryRouter(entries []DirectoryEntry, fallback ShardRouter) (*DirectoryRouter, error) {
+	r := &DirectoryRouter{Fallback: fallback, entries: make(map[ShardKind][]DirectoryEntry)}
+	for _, entry := range entries {
+		if entry.MinId > entry.MaxId {
+			return nil, fmt.Errorf("directory entry min id %d is greater than max id %d", entry.MinId, entry.MaxId)
+		}
+		if entry.DB < 0 || entry.Table < 0 {
+			return nil, fmt.Errorf("directory entry of [%d, %d] has negative db or table", entry.MinId, entry.MaxId)
+		}
+		r.entries[entry.Kind] = append(r.entries[entry.Kind], entry)
+	}
+	for kind, list := range r.entries {
+		sort.Slice(list, func(i, j int) bool { return list[i].MinId < list[j].MinId })
+		for i := 1; i < len(list); i++ {
+			if list[i].MinId <= list[i-1].MaxId {
+				return nil, fmt.Errorf("directory entries of kind %d overlap at id %d", kind, list[i].MinId)
+			}
+		}
+	}
+	return r, nil
+}
+
+func (r *DirectoryRouter) Route(kind ShardKind, id, dbNum, splitNum int64) (int64, int64) {
+	list := r.entries[kind]
+	i := sort.Search(len(list), func(i int) bool { return list[i].MaxId >= id })
+	if i < len(list) && list[i].MinId <= id {
+		return list[i].DB, list[i].Table
+	}
+	if r.Fallback == nil {
+		return ModuloRouter{}.Route(kind, id, dbNum, splitNum)
+	}
+	return r.Fallback.Route(kind, id, dbNum, splitNum)
+}
+
+// CheckRange 校验该类数据的目录条目和Fallback，dbNum为0时不校验库下标
+func (r *DirectoryRouter) CheckRange(kind ShardKind, dbNum, splitNum int64) error {
+	for _, entry := range r.entries[kind] {
+		if (dbNum > 0 && entry.DB >= dbNum) || entry.Table >= splitNum {
+			return fmt.Errorf("directory entry of kind %d [%d, %d] routes to db %d table %d, out of range db num %d split num %d",
+				kind, entry.MinId, entry.MaxId, entry.DB, entry.Table, dbNum, splitNum)
+		}
+	}
+	if checker, ok := r.Fallback.(ShardRangeChecker); ok {
+		return checker.CheckRange(kind, dbNum, splitNum)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package basic
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func mustLayout(t *testing.T, conf *TransferConf) *Layout {
+	layout, err := NewLayout(conf)
+	if err != nil {
+		t.Fatalf("failed to create layout: %v", err)
+	}
+	return layout
+}
+
+func TestModuloRouter(t *testing.T) {
+	layout := mustLayout(t, &TransferConf{StateSplitNum: 3, RecordSplitNum: 4, AccountSplitNum: 5})
+	if name := layout.GetAccountTableName(12); name != "account_2" {
+		t.Fatalf("account table got %s want account_2", name)
+	}
+	if name := layout.GetRecordTableName(12); name != "record_0" {
+		t.Fatalf("record table got %s want record_0", name)
+	}
+	if name := mustLayout(t, &TransferConf{}).GetStateTableName(12); name != "state" {
+		t.Fatalf("single state table got %s want state", name)
+	}
+}
+
+func TestConsistentHashRouter(t *testing.T) {
+	router := NewConsistentHashRouter(0)
+	const total = 10000
+	counts := make([]int, 4)
+	moved := 0
+	for id := int64(0); id < total; id++ {
+		db, table := router.Route(ShardKindAccount, id, 4, 8)
+		if table < 0 || table >= 8 {
+			t.Fatalf("table %d out of range", table)
+		}
+		counts[db]++
+		//增加一个库后只有分配到新库的数据需要移动
+		newDB, _ := router.Route(ShardKindAccount, id, 5, 8)
+		if newDB != db {
+			if newDB != 4 {
+				t.Fatalf("id %d moved from db %d to old db %d", id, db, newDB)
+			}
+			moved++
+		}
+	}
+	for db, n := range counts {
+		if n < total/8 {
+			t.Fatalf("db %d got %d of %d ids, distribution is too uneven", db, n, total)
+		}
+	}
+	if moved > total/3 {
+		t.Fatalf("%d of %d ids moved after adding a db", moved, total)
+	}
+
+	//权重为3的库分到更多数据
+	weighted := NewConsistentHashRouter(0, 3, 1)
+	heavy := 0
+	for id := int64(0); id < total; id++ {
+		if db, _ := weighted.Route(ShardKindAccount, id, 2, 1); db == 0 {
+			heavy++
+		}
+	}
+	if heavy < total*6/10 {
+		t.Fatalf("weighted db got %d of %d ids", heavy, total)
+	}
+}
+
+func TestDirectoryRouter(t *testing.T) {
+	router, err := NewDirectoryRouter([]DirectoryEntry{
+		{Kind: ShardKindAccount, MinId: 100, MaxId: 100, DB: 1, Table: 0},
+		{Kind: ShardKindAccount, MinId: 1000, MaxId: 1999, DB: 0, Table: 1},
+	}, nil)
+	if err != nil {
+		t.Fatalf("failed to create directory router: %v", err)
+	}
+	layout := mustLayout(t, &TransferConf{Router: router, AccountSplitNum: 2, RecordSplitNum: 2})
+	layout.dbNum = 2
+	if db := layout.GetRecordAndAccountDBIndex(100); db != 1 {
+		t.Fatalf("hot account db got %d want 1", db)
+	}
+	if name := layout.GetAccountTableName(1500); name != "account_1" {
+		t.Fatalf("range account table got %s want account_1", name)
+	}
+	//未命中目录时按取模路由
+	if name := layout.GetAccountTableName(2000); name != "account_0" {
+		t.Fatalf("fallback account table got %s want account_0", name)
+	}
+
+	//目录条目超出库或分表数量时创建布局失败，不在请求时panic
+	if _, err = NewLayout(&TransferConf{Router: router, AccountSplitNum: 1, RecordSplitNum: 2}); err == nil {
+		t.Fatalf("expect table out of range error")
+	}
+	if _, err = NewLayout(&TransferConf{Router: router, DBs: []*gorm.DB{nil}, AccountSplitNum: 2, RecordSplitNum: 2}); err == nil {
+		t.Fatalf("expect db out of range error")
+	}
+	if _, err = NewLayout(&TransferConf{Router: router, DBs: []*gorm.DB{nil, nil}, AccountSplitNum: 2, RecordSplitNum: 2}); err != nil {
+		t.Fatalf("failed to create layout in range: %v", err)
+	}
+
+	if _, err = NewDirectoryRouter([]DirectoryEntry{
+		{Kind: ShardKindState, MinId: 1, MaxId: 10},
+		{Kind: ShardKindState, MinId: 10, MaxId: 20},
+	}, nil); err == nil {
+		t.Fatalf("expect overlap error")
+	}
+}
@@ -0,0 +1,281 @@
+package basic
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+const (
+	StateTablePrefix   = "state"   //转移状态表前缀
+	RecordTablePrefix  = "record"  //转移记录表前缀
+	AccountTablePrefix = "account" //账户表前缀
+
+	AccountSnapshotTablePrefix = "account_snapshot" //账户快照表前缀
+	OutboxTablePrefix          = "outbox"           //转移状态事件表前缀
+	RecordChainTablePrefix     = "record_chain"     //记录哈希链表前缀
+)
+
+type ColumnType int //列类型
+
+const (
+	ColumnTypeID     ColumnType = 1 //自增主键
+	ColumnTypeBigInt ColumnType = 2 //64位整数
+	ColumnTypeInt    ColumnType = 3 //32位整数
+	ColumnTypeString ColumnType = 4 //变长字符串，长度为Size
+	ColumnTypeJSON   ColumnType = 5 //JSON，MySQL使用长度为Size的变长字符串
+)
+
+// ColumnSpec 列定义
+type ColumnSpec struct {
+	Name    string
+	Type    ColumnType
+	Size    int
+	Comment string
+}
+
+// IndexSpec 索引定义
+type IndexSpec struct {
+	Name    string
+	Columns []string
+	Unique  bool
+}
+
+// TableSpec 表定义
+type TableSpec struct {
+	Kind    ShardKind
+	Prefix  string
+	Comment string
+	Columns []ColumnSpec
+	Indexes []IndexSpec
+}
+
+// Table 分表后的具体表
+type Table struct {
+	Name   string     //表名
+	Prefix string     //命名空间表前缀，默认为空
+	Suffix string     //分表后缀，单表时为空
+	Spec   *TableSpec //表定义
+}
+
+// IndexName 索引在库内唯一的名称，PostgreSQL和SQLite的索引名全库唯一，需带上命名空间前缀和分表后缀
+func (t *Table) IndexName(index IndexSpec) string {
+	return t.Prefix + index.Name + t.Suffix
+}
+
+var (
+	// StateTableSpec 转移状态表，uk_state保证同一转移只有一个状态
+	StateTableSpec = &TableSpec{
+		Kind:    ShardKindState,
+		Prefix:  StateTablePrefix,
+		Comment: "转移状态表",
+		Columns: []ColumnSpec{
+			{Name: "id", Type: ColumnTypeID, Comment: "ID"},
+			{Name: "transfer_id", Type: ColumnTypeBigInt, Comment: "转移ID"},
+			{Name: "transfer_scene", Type: ColumnTypeBigInt, Comment: "转移场景"},
+			{Name: "from_accounts", Type: ColumnTypeJSON, Size: 5000, Comment: "扣款账户信息列表"},
+			{Name: "to_accounts", Type: ColumnTypeJSON, Size: 5000, Comment: "收款账户信息列表"},
+			{Name: "status", Type: ColumnTypeInt, Comment: "状态 1-进行中 2-回滚中 3-半成功 4-成功 5-已回滚"},
+			{Name: "comment", Type: ColumnTypeString, Size: 1000, Comment: "备注"},
+			{Name: "created_at", Type: ColumnTypeBigInt, Comment: "创建时间"},
+			{Name: "updated_at", Type: ColumnTypeBigInt, Comment: "更新时间"},
+		},
+		Indexes: []IndexSpec{
+			{Name: "uk_state", Columns: []string{"transfer_id", "transfer_scene"}, Unique: true},
+			{Name: "status_updated_at_index", Columns: []string{"status", "updated_at"}},
+		},
+	}
+
+	// RecordTableSpec 转移记录表，uk_record是记录幂等的依据
+	RecordTableSpec = &TableSpec{
+		Kind:    ShardKindRecord,
+		Prefix:  RecordTablePrefix,
+		Comment: "记录表",
+		Columns: []ColumnSpec{
+			{Name: "id", Type: ColumnTypeID, Comment: "ID"},
+			{Name: "account_id", Type: ColumnTypeBigInt, Comment: "账户ID"},
+			{Name: "transfer_id", Type: ColumnTypeBigInt, Comment: "转移ID"},
+			{Name: "transfer_scene", Type: ColumnTypeInt, Comment: "转移场景"},
+			{Name: "transfer_type", Type: ColumnTypeInt, Comment: "转移类型"},
+			{Name: "transfer_status", Type: ColumnTypeInt, Comment: "转移状态 1-正常 2-已回滚 3-空回滚 4-已扣款"},
+			{Name: "amount", Type: ColumnTypeBigInt, Comment: "变动金额"},
+			{Name: "refunded_amount", Type: ColumnTypeBigInt, Comment: "已退款金额"},
+			{Name: "item_type", Type: ColumnTypeInt, Comment: "物品类型"},
+			{Name: "change_type", Type: ColumnTypeInt, Comment: "变动类型"},
+			{Name: "comment", Type: ColumnTypeString, Size: 1000, Comment: "备注"},
+			{Name: "expire_at", Type: ColumnTypeBigInt, Comment: "冻结过期时间 0-不过期"},
+			{Name: "balance_after", Type: ColumnTypeBigInt, Comment: "操作后账户数量"},
+			{Name: "sequence", Type: ColumnTypeBigInt, Comment: "操作后账户序号 0-未变更数量"},
+			{Name: "rollback_balance_after", Type: ColumnTypeBigInt, Comment: "回滚后账户数量"},
+			{Name: "rollback_sequence", Type: ColumnTypeBigInt, Comment: "回滚后账户序号 0-未回滚或未变更数量"},
+			{Name: "created_at", Type: ColumnTypeBigInt, Comment: "创建时间"},
+			{Name: "updated_at", Type: ColumnTypeBigInt, Comment: "更新时间"},
+		},
+		Indexes: []IndexSpec{
+			{Name: "uk_record", Columns: []string{"account_id", "transfer_id", "item_type", "transfer_scene", "transfer_type", "change_type"}, Unique: true},
+			{Name: "idx_account", Columns: []string{"account_id", "transfer_scene", "item_type", "transfer_type", "change_type"}},
+			{Name: "idx_expire", Columns: []string{"transfer_type", "transfer_status", "expire_at"}},
+		},
+	}
+
+	// RecordChainTableSpec 记录哈希链表，与记录表同库同分表后缀，记录每次写入追加一环，uk_record_chain保证链上序号不重复
+	RecordChainTableSpec = &TableSpec{
+		Kind:    ShardKindRecord,
+		Prefix:  RecordChainTablePrefix,
+		Comment: "记录哈希链表",
+		Columns: []ColumnSpec{
+			{Name: "id", Type: ColumnTypeID, Comment: "ID"},
+			{Name: "account_id", Type: ColumnTypeBigInt, Comment: "账户ID"},
+			{Name: "item_type", Type: ColumnTypeInt, Comment: "物品类型"},
+			{Name: "chain_seq", Type: ColumnTypeBigInt, Comment: "哈希链序号"},
+			{Name: "transfer_id", Type: ColumnTypeBigInt, Comment: "记录的转移ID"},
+			{Name: "transfer_scene", Type: ColumnTypeInt, Comment: "记录的转移场景"},
+			{Name: "transfer_type", Type: ColumnTypeInt, Comment: "记录的转移类型"},
+			{Name: "change_type", Type: ColumnTypeInt, Comment: "记录的变动类型"},
+			{Name: "digest", Type: ColumnTypeString, Size: 64, Comment: "写入后记录内容的摘要"},
+			{Name: "prev_hash", Type: ColumnTypeString, Size: 64, Comment: "哈希链上一环的哈希"},
+			{Name: "hash", Type: ColumnTypeString, Size: 64, Comment: "本环哈希"},
+			{Name: "created_at", Type: ColumnTypeBigInt, Comment: "创建时间"},
+			{Name: "updated_at", Type: ColumnTypeBigInt, Comment: "更新时间"},
+		},
+		Indexes: []IndexSpec{
+			{Name: "uk_record_chain", Columns: []string{"account_id", "item_type", "chain_seq"}, Unique: true},
+		},
+	}
+
+	// AccountTableSpec 账户表，uk_account保证账户每种物品只有一行
+	AccountTableSpec = &TableSpec{
+		Kind:    ShardKindAccount,
+		Prefix:  AccountTablePrefix,
+		Comment: "账户表",
+		Columns: []ColumnSpec{
+			{Name: "id", Type: ColumnTypeID, Comment: "ID"},
+			{Name: "account_id", Type: ColumnTypeBigInt, Comment: "账户ID"},
+			{Name: "amount", Type: ColumnTypeBigInt, Comment: "物品数量"},
+			{Name: "frozen_amount", Type: ColumnTypeBigInt, Comment: "冻结数量"},
+			{Name: "sequence", Type: ColumnTypeBigInt, Comment: "数量变更序号"},
+			{Name: "item_type", Type: ColumnTypeInt, Comment: "物品类型"},
+			{Name: "created_at", Type: ColumnTypeBigInt, Comment: "创建时间"},
+			{Name: "updated_at", Type: ColumnTypeBigInt, Comment: "更新时间"},
+		},
+		Indexes: []IndexSpec{
+			{Name: "uk_account", Columns: []string{"account_id", "item_type"}, Unique: true},
+		},
+	}
+
+	// AccountSnapshotTableSpec 账户快照表，与账户同库同分表后缀，uk_snapshot保证每个截止时间只有一份快照
+	AccountSnapshotTableSpec = &TableSpec{
+		Kind:    ShardKindAccount,
+		Prefix:  AccountSnapshotTablePrefix,
+		Comment: "账户快照表",
+		Columns: []ColumnSpec{
+			{Name: "id", Type: ColumnTypeID, Comment: "ID"},
+			{Name: "account_id", Type: ColumnTypeBigInt, Comment: "账户ID"},
+			{Name: "item_type", Type: ColumnTypeInt, Comment: "物品类型"},
+			{Name: "cut_off", Type: ColumnTypeBigInt, Comment: "截止时间"},
+			{Name: "amount", Type: ColumnTypeBigInt, Comment: "截止时的物品数量"},
+			{Name: "sequence", Type: ColumnTypeBigInt, Comment: "截止时的数量变更序号"},
+			{Name: "created_at", Type: ColumnTypeBigInt, Comment: "创建时间"},
+			{Name: "updated_at", Type: ColumnTypeBigInt, Comment: "更新时间"},
+		},
+		Indexes: []IndexSpec{
+			{Name: "uk_snapshot", Columns: []string{"account_id", "item_type", "cut_off"}, Unique: true},
+		},
+	}
+
+	// OutboxTableSpec 转移状态事件表，与转移状态同库同分表后缀，uk_outbox保证每个转移的每种状态只有一个事件
+	OutboxTableSpec = &TableSpec{
+		Kind:    ShardKindState,
+		Prefix:  OutboxTablePrefix,
+		Comment: "转移状态事件表",
+		Columns: []ColumnSpec{
+			{Name: "id", Type: ColumnTypeID, Comment: "ID"},
+			{Name: "transfer_id", Type: ColumnTypeBigInt, Comment: "转移ID"},
+			{Name: "transfer_scene", Type: ColumnTypeBigInt, Comment: "转移场景"},
+			{Name: "from_status", Type: ColumnTypeInt, Comment: "变更前的转移状态 0-创建"},
+			{Name: "to_status", Type: ColumnTypeInt, Comment: "变更后的转移状态 3-半成功 4-成功 5-已回滚"},
+			{Name: "status", Type: ColumnTypeInt, Comment: "投递状态 1-待投递 2-已投递"},
+			{Name: "attempts", Type: ColumnTypeInt, Comment: "投递失败次数"},
+			{Name: "last_error", Type: ColumnTypeString, Size: 1000, Comment: "最近一次投递失败的原因"},
+			{Name: "created_at", Type: ColumnTypeBigInt, Comment: "创建时间"},
+			{Name: "updated_at", Type: ColumnTypeBigInt, Comment: "更新时间"},
+		},
+		Indexes: []IndexSpec{
+			{Name: "uk_outbox", Columns: []string{"transfer_id", "transfer_scene", "to_status"}, Unique: true},
+			{Name: "idx_outbox_status", Columns: []string{"status", "id"}},
+		},
+	}
+)
+
+// GetSplitTables 获取表定义按分表数量展开后的全部表
+func GetSplitTables(spec *TableSpec, splitNum int64) []*Table {
+	return GetPrefixedSplitTables("", spec, splitNum)
+}
+
+// GetPrefixedSplitTables 获取命名空间下表定义按分表数量展开后的全部表
+func GetPrefixedSplitTables(prefix string, spec *TableSpec, splitNum int64) []*Table {
+	if splitNum <= 1 {
+		return []*Table{{Name: prefix + spec.Prefix, Prefix: prefix, Spec: spec}}
+	}
+	tables := make([]*Table, 0, splitNum)
+	for i := int64(0); i < splitNum; i++ {
+		suffix := fmt.Sprintf("_%d", i)
+		tables = append(tables, &Table{Name: prefix + spec.Prefix + suffix, Prefix: prefix, Suffix: suffix, Spec: spec})
+	}
+	return tables
+}
+
+// GetTables 获取配置下全部的表，包括各命名空间的表，转移状态与记录账户共用库时即为每个库上应存在的表
+func GetTables(conf *TransferConf) []*Table {
+	var tables []*Table
+	for _, nsConf := range conf.GetLedgerConfs() {
+		tables = append(tables, GetPrefixedSplitTables(nsConf.TablePrefix, StateTableSpec, nsConf.StateSplitNum)...)
+		tables = append(tables, GetPrefixedSplitTables(nsConf.TablePrefix, OutboxTableSpec, nsConf.StateSplitNum)...)
+		tables = append(tables, GetPrefixedSplitTables(nsConf.TablePrefix, RecordTableSpec, nsConf.RecordSplitNum)...)
+		tables = append(tables, GetPrefixedSplitTables(nsConf.TablePrefix, RecordChainTableSpec, nsConf.RecordSplitNum)...)
+		tables = append(tables, GetPrefixedSplitTables(nsConf.TablePrefix, AccountTableSpec, nsConf.AccountSplitNum)...)
+		tables = append(tables, GetPrefixedSplitTables(nsConf.TablePrefix, AccountSnapshotTableSpec, nsConf.AccountSplitNum)...)
+	}
+	return tables
+}
+
+// DBTables 库及其上应存在的表
+type DBTables struct {
+	DB     *gorm.DB
+	Tables []*Table
+}
+
+// GetDBTables 获取配置中的每个库及其上应存在的表，包括各命名空间的表，转移状态库与记录账户库是同一个连接时合并
+func GetDBTables(conf *TransferConf) []*DBTables {
+	var stateTables, tables []*Table
+	for _, nsConf := range conf.GetLedgerConfs() {
+		stateTables = append(stateTables, GetPrefixedSplitTables(nsConf.TablePrefix, StateTableSpec, nsConf.StateSplitNum)...)
+		stateTables = append(stateTables, GetPrefixedSplitTables(nsConf.TablePrefix, OutboxTableSpec, nsConf.StateSplitNum)...)
+		tables = append(tables, GetPrefixedSplitTables(nsConf.TablePrefix, RecordTableSpec, nsConf.RecordSplitNum)...)
+		tables = append(tables, GetPrefixedSplitTables(nsConf.TablePrefix, RecordChainTableSpec, nsConf.RecordSplitNum)...)
+		tables = append(tables, GetPrefixedSplitTables(nsConf.TablePrefix, AccountTableSpec, nsConf.AccountSplitNum)...)
+		tables = append(tables, GetPrefixedSplitTables(nsConf.TablePrefix, AccountSnapshotTableSpec, nsConf.AccountSplitNum)...)
+	}
+	stateDBs := conf.StateDBs
+	if len(stateDBs) == 0 {
+		stateDBs = conf.DBs
+	}
+	var dbTables []*DBTables
+	for _, db := range conf.DBs {
+		dbTables = append(dbTables, &DBTables{DB: db, Tables: tables})
+	}
+	for _, db := range stateDBs {
+		merged := false
+		for _, dt := range dbTables {
+			if dt.DB == db {
+				dt.Tables = append(append([]*Table(nil), stateTables...), dt.Tables...)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			dbTables = append(dbTables, &DBTables{DB: db, Tables: stateTables})
+		}
+	}
+	return dbTables
+}
@@ -0,0 +1,83 @@
+package basic
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// SchemaError 表结构校验失败，Problems为每个库上缺失的表、列和唯一索引
+type SchemaError struct {
+	Problems []string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("[fisher] schema verify failed:\n%s", strings.Join(e.Problems, "\n"))
+}
+
+// VerifySchema 校验配置的每个库上是否存在全部分表，以及表中必需的列和唯一索引
+// 分表数量配置错误或缺表在运行时只会表现为转移中途的DBFailedErr，启动时校验可以提前暴露问题
+// 库下标按GetDBTables的顺序，先记录和账户库，再单独的转移状态库
+func VerifySchema(conf *TransferConf) error {
+	var problems []string
+	for i, dt := range GetDBTables(conf) {
+		for _, table := range dt.Tables {
+			for _, problem := range verifyTable(dt.DB, table) {
+				problems = append(problems, fmt.Sprintf("db %d table %s: %s", i, table.Name, problem))
+			}
+		}
+	}
+	if len(problems) != 0 {
+		return &SchemaError{Problems: problems}
+	}
+	return nil
+}
+
+func verifyTable(db *gorm.DB, table *Table) []string {
+	migrator := db.Migrator()
+	if !migrator.HasTable(table.Name) {
+		return []string{"table not exists"}
+	}
+	var problems []string
+	columnTypes, err := migrator.ColumnTypes(table.Name)
+	if err != nil {
+		return []string{fmt.Sprintf("get columns failed: %v", err)}
+	}
+	columns := make(map[string]struct{}, len(columnTypes))
+	for _, columnType := range columnTypes {
+		columns[columnType.Name()] = struct{}{}
+	}
+	for _, column := range table.Spec.Columns {
+		if _, ok := columns[column.Name]; !ok {
+			problems = append(problems, fmt.Sprintf("missing column %s", column.Name))
+		}
+	}
+	indexes, err := migrator.GetIndexes(table.Name)
+	if err != nil {
+		return append(problems, fmt.Sprintf("get indexes failed: %v", err))
+	}
+	for _, index := range table.Spec.Indexes {
+		if !index.Unique {
+			//普通索引只影响性能，不做强制校验
+			continue
+		}
+		if !hasUniqueIndex(indexes, index.Columns) {
+			problems = append(problems, fmt.Sprintf("missing unique index %s(%s)", index.Name, strings.Join(index.Columns, ", ")))
+		}
+	}
+	return problems
+}
+
+// hasUniqueIndex 按列判断唯一索引是否存在，不同方言和分表下索引名可能不同
+func hasUniqueIndex(indexes []gorm.Index, columns []string) bool {
+	for _, index := range indexes {
+		if unique, ok := index.Unique(); !ok || !unique {
+			continue
+		}
+		if strings.Join(index.Columns(), ",") == strings.Join(columns, ",") {
+			return true
+		}
+	}
+	return false
+}
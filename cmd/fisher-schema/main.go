@@ -0,0 +1,113 @@
+// fisher-schema 生成或执行Fisher的分库分表建表语句
+//
+// 打印单库建表语句:
+//
+//	fisher-schema -dialect mysql -state-split 3 -record-split 3 -account-split 3
+//
+// 在每个库上执行建表(可重复执行，已存在的表会补齐缺失的列和索引):
+//
+//	fisher-schema -dialect mysql -dsn "user:pwd@tcp(127.0.0.1:3306)/db1" -dsn "user:pwd@tcp(127.0.0.1:3306)/db2" -apply
+//
+// 转移状态使用单独的库时，通过-state-dsn指定，状态表只在这些库上创建:
+//
+//	fisher-schema -dialect mysql -dsn "user:pwd@tcp(127.0.0.1:3306)/db1" -state-dsn "user:pwd@tcp(127.0.0.1:3306)/state1" -apply
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/schema"
+)
+
+type dsnList []string
+
+func (l *dsnList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *dsnList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func main() {
+	var dsns, stateDSNs dsnList
+	dialect := flag.String("dialect", string(schema.DialectMySQL), "database dialect: mysql, postgres or sqlite")
+	stateSplit := flag.Int64("state-split", basic.DefaultStateSplitNum, "state table split num")
+	recordSplit := flag.Int64("record-split", basic.DefaultRecordSplitNum, "record table split num")
+	accountSplit := flag.Int64("account-split", basic.DefaultAccountSplitNum, "account table split num")
+	tablePrefix := flag.String("table-prefix", "", "table name prefix, one ledger per prefix")
+	apply := flag.Bool("apply", false, "apply ddl to every dsn instead of printing it")
+	flag.Var(&dsns, "dsn", "database dsn, repeat in db index order")
+	flag.Var(&stateDSNs, "state-dsn", "state database dsn, repeat in db index order, defaults to -dsn")
+	flag.Parse()
+
+	conf := &basic.TransferConf{
+		StateSplitNum:   *stateSplit,
+		RecordSplitNum:  *recordSplit,
+		AccountSplitNum: *accountSplit,
+		TablePrefix:     *tablePrefix,
+	}
+	if err := conf.CheckNamespaces(); err != nil {
+		exit(err)
+	}
+	if !*apply {
+		stmts, err := schema.Generate(conf, schema.Dialect(*dialect))
+		if err != nil {
+			exit(err)
+		}
+		for _, stmt := range stmts {
+			fmt.Printf("%s;\n\n", stmt)
+		}
+		return
+	}
+	if len(dsns) == 0 {
+		exit(fmt.Errorf("-dsn is required with -apply"))
+	}
+	conf.DBs = openAll(schema.Dialect(*dialect), dsns)
+	conf.StateDBs = openAll(schema.Dialect(*dialect), stateDSNs)
+	if err := schema.Apply(context.Background(), conf); err != nil {
+		exit(err)
+	}
+	fmt.Printf("schema applied to %d db(s)\n", len(conf.DBs)+len(conf.StateDBs))
+}
+
+func openAll(dialect schema.Dialect, dsns []string) []*gorm.DB {
+	var dbs []*gorm.DB
+	for _, dsn := range dsns {
+		db, err := gorm.Open(open(dialect, dsn), &gorm.Config{})
+		if err != nil {
+			exit(err)
+		}
+		dbs = append(dbs, db)
+	}
+	return dbs
+}
+
+func open(dialect schema.Dialect, dsn string) gorm.Dialector {
+	switch dialect {
+	case schema.DialectPostgres:
+		return postgres.Open(dsn)
+	case schema.DialectSQLite:
+		return sqlite.Open(dsn)
+	case schema.DialectMySQL:
+		return mysql.Open(dsn)
+	}
+	exit(fmt.Errorf("unsupported dialect: %s", dialect))
+	return nil
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
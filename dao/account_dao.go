@@ -3,57 +3,95 @@ package dao
 import (
 	"context"
 
-	"github.com/go-sql-driver/mysql"
-
 	"github.com/zjn-zjn/fisher/basic"
 	"github.com/zjn-zjn/fisher/model"
 
-	"github.com/pkg/errors"
 	"gorm.io/gorm"
 )
 
-func GetAccountAmountByItemType(ctx context.Context, accountId int64, itemType basic.ItemType, db *gorm.DB) (int64, error) {
-	if db == nil {
-		db = basic.GetAccountReadDB(ctx, accountId)
-	}
-	var account model.Account
-	if err := db.Table(model.GetAccountTableName(accountId)).Where("account_id = ? and item_type = ?", accountId, itemType).First(&account).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return 0, nil
+func (s *gormStore) GetAccountAmountByItemType(ctx context.Context, accountId int64, itemType basic.ItemType, readOnly bool) (int64, error) {
+	var amount int64
+	err := s.scope(ctx, func(s *gormStore) error {
+		var accounts []model.Account
+		for _, db := range s.readTables(readOnly, func(s *gormStore) *gorm.DB { return s.accountTable(ctx, accountId, readOnly) }) {
+			if err := db.Where("account_id = ? and item_type = ?", accountId, itemType).Find(&accounts).Error; err != nil {
+				return err
+			}
+			if len(accounts) != 0 {
+				amount = accounts[0].Amount
+				return nil
+			}
 		}
-		return 0, err
-	}
-	return account.Amount, nil
+		return nil
+	})
+	return amount, err
 }
 
-func GetAccountAmount(ctx context.Context, accountId int64, db *gorm.DB) (map[basic.ItemType]int64, error) {
-	if db == nil {
-		db = basic.GetAccountReadDB(ctx, accountId)
-	}
-	var accounts []model.Account
-	if err := db.Table(model.GetAccountTableName(accountId)).Where("account_id = ?", accountId).Find(&accounts).Error; err != nil {
-		return nil, err
-	}
+func (s *gormStore) GetAccount(ctx context.Context, accountId int64, itemType basic.ItemType, readOnly bool) (*model.Account, error) {
+	var account *model.Account
+	err := s.scope(ctx, func(s *gormStore) error {
+		var accounts []model.Account
+		for _, db := range s.readTables(readOnly, func(s *gormStore) *gorm.DB { return s.accountTable(ctx, accountId, readOnly) }) {
+			if err := db.Where("account_id = ? and item_type = ?", accountId, itemType).Find(&accounts).Error; err != nil {
+				return basic.NewDBFailed(err)
+			}
+			if len(accounts) != 0 {
+				account = &accounts[0]
+				return nil
+			}
+		}
+		return nil
+	})
+	return account, err
+}
+
+func (s *gormStore) GetAccountAmount(ctx context.Context, accountId int64, readOnly bool) (map[basic.ItemType]int64, error) {
 	amountMap := make(map[basic.ItemType]int64)
-	for _, account := range accounts {
-		amountMap[account.ItemType] = account.Amount
+	err := s.scope(ctx, func(s *gormStore) error {
+		var accounts []model.Account
+		for _, db := range s.readTables(readOnly, func(s *gormStore) *gorm.DB { return s.accountTable(ctx, accountId, readOnly) }) {
+			if err := db.Where("account_id = ?", accountId).Find(&accounts).Error; err != nil {
+				return err
+			}
+			if len(accounts) != 0 {
+				break
+			}
+		}
+		for _, account := range accounts {
+			amountMap[account.ItemType] = account.Amount
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return amountMap, nil
 }
 
-func deductAccountAmount(ctx context.Context, accountId, amount int64, itemType basic.ItemType, transferStatus basic.RecordStatus, db *gorm.DB) error {
-	if db == nil {
-		db = basic.GetRecordAndAccountWriteDB(ctx, accountId)
-	}
-	var accountDB = db.Table(model.GetAccountTableName(accountId))
+func (s *gormStore) DeductAccountAmount(ctx context.Context, accountId, amount int64, itemType basic.ItemType, allowNegative bool) (*model.Account, error) {
+	var account *model.Account
+	err := s.scope(ctx, func(s *gormStore) error {
+		if err := s.deductAccountAmount(ctx, accountId, amount, itemType, allowNegative); err != nil {
+			return err
+		}
+		var err error
+		account, err = s.getChangedAccount(ctx, accountId, itemType)
+		return err
+	})
+	return account, err
+}
+
+func (s *gormStore) deductAccountAmount(ctx context.Context, accountId, amount int64, itemType basic.ItemType, allowNegative bool) error {
+	var accountDB = s.accountTable(ctx, accountId, false)
 	//这里采用update item = item - 1 where item - amount >= 0 的方式进行扣减，提高并发成功率
-	if transferStatus == basic.RecordStatusRollback || basic.IsOfficialAccount(accountId) {
+	if allowNegative {
 		//官方账号和回滚 不使用item - amount >= 0条件，直接扣减
 		accountDB = accountDB.Where("account_id = ? and item_type = ?", accountId, itemType)
 	} else {
-		accountDB = accountDB.Where("account_id = ?  and item_type = ? and amount - ? >= 0", accountId, itemType, amount)
+		//冻结的部分不可扣减
+		accountDB = accountDB.Where("account_id = ?  and item_type = ? and amount - frozen_amount - ? >= 0", accountId, itemType, amount)
 	}
-	res := accountDB.UpdateColumn("amount", gorm.Expr("amount - ?", amount))
+	res := accountDB.UpdateColumns(map[string]interface{}{"amount": gorm.Expr("amount - ?", amount), "sequence": gorm.Expr("sequence + 1")})
 	if res.Error != nil {
 		return basic.NewDBFailed(res.Error)
 	}
@@ -61,17 +99,28 @@ func deductAccountAmount(ctx context.Context, accountId, amount int64, itemType
 		//这里理论上只能是由于金额不足引起的，直接返回错误
 		return basic.InsufficientAmountErr
 	}
+	s.touch(accountKey(accountId, itemType))
 	return nil
 }
 
-func increaseAccountAmount(ctx context.Context, accountId, amount int64, itemType basic.ItemType, db *gorm.DB) error {
-	if db == nil {
-		db = basic.GetRecordAndAccountWriteDB(ctx, accountId)
-	}
+func (s *gormStore) IncreaseAccountAmount(ctx context.Context, accountId, amount int64, itemType basic.ItemType) (*model.Account, error) {
+	var account *model.Account
+	err := s.scope(ctx, func(s *gormStore) error {
+		if err := s.increaseAccountAmount(ctx, accountId, amount, itemType); err != nil {
+			return err
+		}
+		var err error
+		account, err = s.getChangedAccount(ctx, accountId, itemType)
+		return err
+	})
+	return account, err
+}
+
+func (s *gormStore) increaseAccountAmount(ctx context.Context, accountId, amount int64, itemType basic.ItemType) error {
 	//这里采用update item = item + amount 的方式进行增加，提高并发成功率
-	res := db.Table(model.GetAccountTableName(accountId)).
+	res := s.accountTable(ctx, accountId, false).
 		Where("account_id = ? and item_type = ?", accountId, itemType).
-		UpdateColumn("amount", gorm.Expr("amount + ?", amount))
+		UpdateColumns(map[string]interface{}{"amount": gorm.Expr("amount + ?", amount), "sequence": gorm.Expr("sequence + 1")})
 	if res.Error != nil {
 		return basic.NewDBFailed(res.Error)
 	}
@@ -79,14 +128,72 @@ func increaseAccountAmount(ctx context.Context, accountId, amount int64, itemTyp
 		//这里理论上不会发生，增加的金额>0，并且成功，理论上不会有0行影响，以防万一，还是加上
 		return basic.StateMutationErr
 	}
+	s.touch(accountKey(accountId, itemType))
 	return nil
 }
 
-func getAccountDefaultCreate(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.Account, error) {
+// getChangedAccount 读取刚变更的账户，事务内该行已被本次更新锁定，读到的即为本次变更后的结果
+func (s *gormStore) getChangedAccount(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.Account, error) {
+	var account model.Account
+	if err := s.accountTable(ctx, accountId, false).Where("account_id = ? and item_type = ?", accountId, itemType).Take(&account).Error; err != nil {
+		return nil, basic.NewDBFailed(err)
+	}
+	return &account, nil
+}
+
+func (s *gormStore) FreezeAccountAmount(ctx context.Context, accountId, amount int64, itemType basic.ItemType, allowNegative bool) error {
+	return s.scope(ctx, func(s *gormStore) error {
+		var accountDB = s.accountTable(ctx, accountId, false)
+		//与扣减相同，使用条件更新保证可用数量不为负
+		if allowNegative {
+			accountDB = accountDB.Where("account_id = ? and item_type = ?", accountId, itemType)
+		} else {
+			accountDB = accountDB.Where("account_id = ? and item_type = ? and amount - frozen_amount - ? >= 0", accountId, itemType, amount)
+		}
+		res := accountDB.UpdateColumn("frozen_amount", gorm.Expr("frozen_amount + ?", amount))
+		if res.Error != nil {
+			return basic.NewDBFailed(res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return basic.InsufficientAmountErr
+		}
+		s.touch(accountKey(accountId, itemType))
+		return nil
+	})
+}
+
+func (s *gormStore) UnfreezeAccountAmount(ctx context.Context, accountId, amount int64, itemType basic.ItemType) error {
+	return s.scope(ctx, func(s *gormStore) error {
+		res := s.accountTable(ctx, accountId, false).
+			Where("account_id = ? and item_type = ? and frozen_amount - ? >= 0", accountId, itemType, amount).
+			UpdateColumn("frozen_amount", gorm.Expr("frozen_amount - ?", amount))
+		if res.Error != nil {
+			return basic.NewDBFailed(res.Error)
+		}
+		if res.RowsAffected == 0 {
+			//解冻的数量来自冻结记录，理论上不会不足
+			return basic.StateMutationErr
+		}
+		s.touch(accountKey(accountId, itemType))
+		return nil
+	})
+}
+
+func (s *gormStore) GetOrCreateAccount(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.Account, error) {
+	var account *model.Account
+	err := s.scope(ctx, func(s *gormStore) error {
+		var err error
+		account, err = s.getOrCreateAccount(ctx, accountId, itemType)
+		return err
+	})
+	return account, err
+}
+
+func (s *gormStore) getOrCreateAccount(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.Account, error) {
 	var account *model.Account
 	var accounts []model.Account
 	//获取账户，不存在就创建
-	if err := basic.GetRecordAndAccountWriteDB(ctx, accountId).Table(model.GetAccountTableName(accountId)).
+	if err := s.accountTable(ctx, accountId, false).
 		Where("account_id = ? and item_type = ?", accountId, itemType).
 		Find(&accounts).Error; err != nil {
 		return nil, basic.NewDBFailed(err)
@@ -99,11 +206,10 @@ func getAccountDefaultCreate(ctx context.Context, accountId int64, itemType basi
 		Amount:    0,
 		ItemType:  itemType,
 	}
-	if err := basic.GetRecordAndAccountWriteDB(ctx, accountId).Table(model.GetAccountTableName(accountId)).Create(&account).Error; err != nil {
+	if err := s.accountTable(ctx, accountId, false).Create(&account).Error; err != nil {
 		//如果是唯一键冲突错误，则再次查询
-		var mysqlErr *mysql.MySQLError
-		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
-			if err = basic.GetRecordAndAccountWriteDB(ctx, accountId).Table(model.GetAccountTableName(accountId)).
+		if isDuplicateKeyErr(err) {
+			if err = s.accountTable(ctx, accountId, false).
 				Where("account_id = ? and item_type = ?", accountId, itemType).
 				Find(&accounts).Error; err != nil {
 				return nil, basic.NewDBFailed(err)
@@ -112,6 +218,7 @@ func getAccountDefaultCreate(ctx context.Context, accountId int64, itemType basi
 		}
 		return nil, basic.NewDBFailed(err)
 	}
+	s.touch(accountKey(accountId, itemType))
 	return account, nil
 }
 
@@ -0,0 +1,320 @@
+package dao
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// chainRecordKey 记录的唯一键
+type chainRecordKey struct {
+	accountId     int64
+	transferId    int64
+	itemType      basic.ItemType
+	transferScene basic.TransferScene
+	transferType  basic.TransferType
+	changeType    basic.ChangeType
+}
+
+func chainKeyOf(record *model.Record) chainRecordKey {
+	return chainRecordKey{record.AccountId, record.TransferId, record.ItemType, record.TransferScene, record.TransferType, record.ChangeType}
+}
+
+func chainKeyOfChain(chain *model.RecordChain) chainRecordKey {
+	return chainRecordKey{chain.AccountId, chain.TransferId, chain.ItemType, chain.TransferScene, chain.TransferType, chain.ChangeType}
+}
+
+// chainTX 记录本地事务内写入的记录，事务内的其他操作直接使用内层store
+type chainTX struct {
+	Store
+	written []chainRecordKey
+}
+
+func (t *chainTX) write(key chainRecordKey) {
+	for _, written := range t.written {
+		if written == key {
+			return
+		}
+	}
+	t.written = append(t.written, key)
+}
+
+func (t *chainTX) CreateRecord(ctx context.Context, record *model.Record) error {
+	if err := t.Store.CreateRecord(ctx, record); err != nil {
+		return err
+	}
+	t.write(chainKeyOf(record))
+	return nil
+}
+
+func (t *chainTX) UpdateRecord(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, transferType basic.TransferType, transferStatus, originTransferStatus basic.RecordStatus, changeType basic.ChangeType) (bool, error) {
+	affect, err := t.Store.UpdateRecord(ctx, accountId, transferId, itemType, transferScene, transferType, transferStatus, originTransferStatus, changeType)
+	if affect {
+		t.write(chainRecordKey{accountId, transferId, itemType, transferScene, transferType, changeType})
+	}
+	return affect, err
+}
+
+func (t *chainTX) UpdateRecordRefundedAmount(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, transferType basic.TransferType, changeType basic.ChangeType, delta int64) (bool, error) {
+	affect, err := t.Store.UpdateRecordRefundedAmount(ctx, accountId, transferId, itemType, transferScene, transferType, changeType, delta)
+	if affect {
+		t.write(chainRecordKey{accountId, transferId, itemType, transferScene, transferType, changeType})
+	}
+	return affect, err
+}
+
+func (t *chainTX) UpdateRecordBalance(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, transferType basic.TransferType, changeType basic.ChangeType, rollback bool, account *model.Account) error {
+	if err := t.Store.UpdateRecordBalance(ctx, accountId, transferId, itemType, transferScene, transferType, changeType, rollback, account); err != nil {
+		return err
+	}
+	t.write(chainRecordKey{accountId, transferId, itemType, transferScene, transferType, changeType})
+	return nil
+}
+
+// recordAndAccountTX 同Store.RecordAndAccountInstanceTX，fn成功后在同一本地事务内为每条写入过的记录向其账户物品的哈希链追加一环
+// 创建、回滚、扣款、解冻、退款累计等原地变更都会追加，记录与链同时提交或回滚，链上不会出现未生效的内容
+func (l *Ledger) recordAndAccountTX(ctx context.Context, accountId int64, fn func(ctx context.Context, tx Store) error) error {
+	return l.store.RecordAndAccountInstanceTX(ctx, accountId, func(ctx context.Context, tx Store) error {
+		chain := &chainTX{Store: tx}
+		if err := fn(ctx, chain); err != nil {
+			return err
+		}
+		for _, key := range chain.written {
+			if err := appendChain(ctx, tx, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// appendChain 锁定账户后读取记录写入后的内容，追加到链尾，同一账户物品的追加串行进行
+func appendChain(ctx context.Context, tx Store, key chainRecordKey) error {
+	if _, err := tx.LockAccount(ctx, key.accountId, key.itemType); err != nil {
+		return err
+	}
+	record, err := tx.GetRecord(ctx, key.accountId, key.transferId, key.itemType, key.transferScene, key.transferType, key.changeType)
+	if err != nil {
+		return err
+	}
+	last, err := tx.GetLastRecordChain(ctx, key.accountId, key.itemType)
+	if err != nil {
+		return err
+	}
+	chain := &model.RecordChain{
+		AccountId:     record.AccountId,
+		ItemType:      record.ItemType,
+		ChainSeq:      1,
+		TransferId:    record.TransferId,
+		TransferScene: record.TransferScene,
+		TransferType:  record.TransferType,
+		ChangeType:    record.ChangeType,
+		Digest:        recordDigest(record),
+	}
+	if last != nil {
+		chain.ChainSeq, chain.PrevHash = last.ChainSeq+1, last.Hash
+	}
+	chain.Hash = chainHash(chain)
+	return tx.CreateRecordChain(ctx, chain)
+}
+
+// recordContent 参与摘要的记录内容，除主键外的全部字段，主键在重新分片后会变化
+type recordContent struct {
+	AccountId            int64               `json:"account_id"`
+	TransferId           int64               `json:"transfer_id"`
+	TransferScene        basic.TransferScene `json:"transfer_scene"`
+	TransferType         basic.TransferType  `json:"transfer_type"`
+	TransferStatus       basic.RecordStatus  `json:"transfer_status"`
+	Amount               int64               `json:"amount"`
+	RefundedAmount       int64               `json:"refunded_amount"`
+	ItemType             basic.ItemType      `json:"item_type"`
+	ChangeType           basic.ChangeType    `json:"change_type"`
+	Comment              string              `json:"comment"`
+	ExpireAt             int64               `json:"expire_at"`
+	BalanceAfter         int64               `json:"balance_after"`
+	Sequence             int64               `json:"sequence"`
+	RollbackBalanceAfter int64               `json:"rollback_balance_after"`
+	RollbackSequence     int64               `json:"rollback_sequence"`
+	CreatedAt            int64               `json:"created_at"`
+	UpdatedAt            int64               `json:"updated_at"`
+}
+
+// recordDigest 计算记录当前内容的摘要，sha256后的十六进制
+func recordDigest(record *model.Record) string {
+	content, _ := json.Marshal(&recordContent{
+		AccountId:            record.AccountId,
+		TransferId:           record.TransferId,
+		TransferScene:        record.TransferScene,
+		TransferType:         record.TransferType,
+		TransferStatus:       record.TransferStatus,
+		Amount:               record.Amount,
+		RefundedAmount:       record.RefundedAmount,
+		ItemType:             record.ItemType,
+		ChangeType:           record.ChangeType,
+		Comment:              record.Comment,
+		ExpireAt:             record.ExpireAt,
+		BalanceAfter:         record.BalanceAfter,
+		Sequence:             record.Sequence,
+		RollbackBalanceAfter: record.RollbackBalanceAfter,
+		RollbackSequence:     record.RollbackSequence,
+		CreatedAt:            record.CreatedAt,
+		UpdatedAt:            record.UpdatedAt,
+	})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// chainContent 参与哈希的环内容
+type chainContent struct {
+	PrevHash      string              `json:"prev_hash"`
+	ChainSeq      int64               `json:"chain_seq"`
+	AccountId     int64               `json:"account_id"`
+	ItemType      basic.ItemType      `json:"item_type"`
+	TransferId    int64               `json:"transfer_id"`
+	TransferScene basic.TransferScene `json:"transfer_scene"`
+	TransferType  basic.TransferType  `json:"transfer_type"`
+	ChangeType    basic.ChangeType    `json:"change_type"`
+	Digest        string              `json:"digest"`
+}
+
+// chainHash 计算环的哈希，sha256后的十六进制
+func chainHash(chain *model.RecordChain) string {
+	content, _ := json.Marshal(&chainContent{
+		PrevHash:      chain.PrevHash,
+		ChainSeq:      chain.ChainSeq,
+		AccountId:     chain.AccountId,
+		ItemType:      chain.ItemType,
+		TransferId:    chain.TransferId,
+		TransferScene: chain.TransferScene,
+		TransferType:  chain.TransferType,
+		ChangeType:    chain.ChangeType,
+		Digest:        chain.Digest,
+	})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// chainVerifier 校验一个账户物品的哈希链，记录每条记录在链上的最新一环
+type chainVerifier struct {
+	store     Store
+	batchSize int
+	report    *model.ChainReport
+	latest    map[chainRecordKey]*model.RecordChain
+}
+
+// VerifyRecordChain 先按链上序号逐环校验，再逐条对比记录与其最新一环的摘要，遇到第一处断裂即停止
+func (l *Ledger) VerifyRecordChain(ctx context.Context, accountId int64, itemType basic.ItemType, batchSize int) (*model.ChainReport, error) {
+	v := &chainVerifier{
+		store:     l.store,
+		batchSize: batchSize,
+		report:    &model.ChainReport{AccountId: accountId, ItemType: itemType},
+		latest:    make(map[chainRecordKey]*model.RecordChain),
+	}
+	if err := v.walk(ctx); err != nil || v.report.Broken != nil {
+		return v.report, err
+	}
+	seen := make(map[chainRecordKey]bool)
+	var cursor int64
+	for {
+		records, err := l.store.ListRecordsById(ctx, accountId, itemType, cursor, batchSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			seen[chainKeyOf(record)] = true
+			if err = v.check(ctx, record); err != nil || v.report.Broken != nil {
+				return v.report, err
+			}
+		}
+		if len(records) < batchSize {
+			break
+		}
+		cursor = records[len(records)-1].ID
+	}
+	//链上有而记录表中没有，记录被删除
+	for key, chain := range v.latest {
+		if seen[key] {
+			continue
+		}
+		record, err := l.store.GetRecord(ctx, key.accountId, key.transferId, key.itemType, key.transferScene, key.transferType, key.changeType)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			v.report.Broken = &model.ChainBreak{Chain: chain, ChainSeq: chain.ChainSeq, Reason: basic.ChainBreakReasonRecord}
+			return v.report, nil
+		}
+		if err = v.check(ctx, record); err != nil || v.report.Broken != nil {
+			return v.report, err
+		}
+	}
+	return v.report, nil
+}
+
+// walk 从已校验的位置继续校验到链尾
+func (v *chainVerifier) walk(ctx context.Context) error {
+	for {
+		chains, err := v.store.ListRecordChain(ctx, v.report.AccountId, v.report.ItemType, v.report.Verified, v.batchSize)
+		if err != nil {
+			return err
+		}
+		for _, chain := range chains {
+			broken := &model.ChainBreak{Chain: chain, ChainSeq: v.report.Verified + 1}
+			switch {
+			case chain.ChainSeq != broken.ChainSeq:
+				broken.Reason = basic.ChainBreakReasonSeqGap
+			case chain.PrevHash != v.report.Head:
+				broken.Reason = basic.ChainBreakReasonPrevHash
+			case chain.Hash != chainHash(chain):
+				broken.Reason = basic.ChainBreakReasonHash
+			default:
+				v.report.Verified++
+				v.report.Head = chain.Hash
+				v.latest[chainKeyOfChain(chain)] = chain
+				continue
+			}
+			key := chainKeyOfChain(chain)
+			if broken.Record, err = v.store.GetRecord(ctx, key.accountId, key.transferId, key.itemType, key.transferScene, key.transferType, key.changeType); err != nil {
+				return err
+			}
+			v.report.Broken = broken
+			return nil
+		}
+		if len(chains) < v.batchSize {
+			return nil
+		}
+	}
+}
+
+// check 对比记录与链上该记录的最新一环，不一致时可能是校验期间有新的写入，继续校验到链尾并重新读取记录后再对比
+func (v *chainVerifier) check(ctx context.Context, record *model.Record) error {
+	key := chainKeyOf(record)
+	if chain := v.latest[key]; chain != nil && chain.Digest == recordDigest(record) {
+		v.report.Records++
+		return nil
+	}
+	if err := v.walk(ctx); err != nil || v.report.Broken != nil {
+		return err
+	}
+	current, err := v.store.GetRecord(ctx, key.accountId, key.transferId, key.itemType, key.transferScene, key.transferType, key.changeType)
+	if err != nil {
+		return err
+	}
+	if current != nil {
+		record = current
+	}
+	chain := v.latest[key]
+	switch {
+	case chain == nil:
+		v.report.Unchained++
+	case chain.Digest == recordDigest(record):
+		v.report.Records++
+	default:
+		v.report.Broken = &model.ChainBreak{Chain: chain, Record: record, ChainSeq: chain.ChainSeq, Reason: basic.ChainBreakReasonRecord}
+	}
+	return nil
+}
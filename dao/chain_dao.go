@@ -0,0 +1,79 @@
+package dao
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+func (s *gormStore) GetLastRecordChain(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.RecordChain, error) {
+	var chain *model.RecordChain
+	err := s.scope(ctx, func(s *gormStore) error {
+		var chains []*model.RecordChain
+		err := s.recordChainTable(ctx, accountId).
+			Where("account_id = ? and item_type = ?", accountId, itemType).
+			Order("chain_seq desc").Limit(1).Find(&chains).Error
+		if err != nil {
+			return basic.NewDBFailed(err)
+		}
+		if len(chains) != 0 {
+			chain = chains[0]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+func (s *gormStore) CreateRecordChain(ctx context.Context, chain *model.RecordChain) error {
+	return s.scope(ctx, func(s *gormStore) error {
+		if err := s.recordChainTable(ctx, chain.AccountId).Create(chain).Error; err != nil {
+			return basic.NewDBFailed(err)
+		}
+		s.touch(recordChainKey(chain.AccountId, chain.ItemType, chain.ChainSeq))
+		return nil
+	})
+}
+
+func (s *gormStore) ListRecordChain(ctx context.Context, accountId int64, itemType basic.ItemType, afterChainSeq int64, limit int) ([]*model.RecordChain, error) {
+	var chains []*model.RecordChain
+	err := s.scope(ctx, func(s *gormStore) error {
+		err := s.recordChainTable(ctx, accountId).
+			Where("account_id = ? and item_type = ? and chain_seq > ?", accountId, itemType, afterChainSeq).
+			Order("chain_seq").Limit(limit).Find(&chains).Error
+		if err != nil {
+			return basic.NewDBFailed(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chains, nil
+}
+
+func (s *gormStore) ListRecordsById(ctx context.Context, accountId int64, itemType basic.ItemType, afterId int64, limit int) ([]*model.Record, error) {
+	var records []*model.Record
+	err := s.scope(ctx, func(s *gormStore) error {
+		err := s.recordTable(ctx, accountId, false).
+			Where("account_id = ? and item_type = ? and id > ?", accountId, itemType, afterId).
+			Order("id").Limit(limit).Find(&records).Error
+		if err != nil {
+			return basic.NewDBFailed(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (s *gormStore) recordChainTable(ctx context.Context, accountId int64) *gorm.DB {
+	return s.recordAndAccountDB(ctx, accountId, false).Table(s.layout.GetRecordChainTableName(accountId))
+}
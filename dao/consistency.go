@@ -0,0 +1,85 @@
+package dao
+
+import (
+	"context"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// CheckConsistency 检查创建时间在[start, end)内的转移状态与各账户操作记录是否一致，只返回不一致的转移
+func (l *Ledger) CheckConsistency(ctx context.Context, start, end int64) (*model.ConsistencyReport, error) {
+	states, err := l.store.GetStateListByCreatedAt(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+	report := &model.ConsistencyReport{Start: start, End: end, Checked: len(states)}
+	for _, state := range states {
+		check, err := l.CheckTransfer(ctx, state)
+		if err != nil {
+			return nil, err
+		}
+		if !check.Consistent {
+			report.Inconsistent = append(report.Inconsistent, check)
+		}
+	}
+	return report, nil
+}
+
+// CheckTransfer 按转移状态逐个检查账户操作的记录，给出不一致的原因和修复时将执行的动作
+func (l *Ledger) CheckTransfer(ctx context.Context, state *model.State) (*model.TransferCheck, error) {
+	detail, err := l.GetTransferDetail(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	check := &model.TransferCheck{Detail: detail}
+	for _, leg := range detail.FromAccounts {
+		if issue := checkLeg(state.Status, leg, basic.RecordTypeDeduct); issue != nil {
+			check.Issues = append(check.Issues, issue)
+		}
+	}
+	for _, leg := range detail.ToAccounts {
+		if issue := checkLeg(state.Status, leg, basic.RecordTypeAdd); issue != nil {
+			check.Issues = append(check.Issues, issue)
+		}
+	}
+	check.Consistent = len(check.Issues) == 0
+	return check, nil
+}
+
+// checkLeg 检查单个操作与转移状态是否一致，一致返回nil
+func checkLeg(status basic.StateStatus, leg *model.TransferLeg, transferType basic.TransferType) *model.LegIssue {
+	issue := &model.LegIssue{Leg: leg, TransferType: transferType}
+	switch status {
+	case basic.StateStatusSuccess, basic.StateStatusHalfSuccess:
+		//半成功时付款方已全部完成，收款方还未执行的由Inspection推进
+		if status == basic.StateStatusHalfSuccess && transferType == basic.RecordTypeAdd && leg.Status == basic.LegStatusPending {
+			return nil
+		}
+		switch leg.Status {
+		case basic.LegStatusPending:
+			issue.Reason, issue.Repair = basic.InconsistentReasonLegMissing, basic.RepairTypeForward
+		case basic.LegStatusRolledBack, basic.LegStatusEmptyRollback:
+			//记录已回滚，幂等键已被占用无法再次执行
+			issue.Reason, issue.Repair = basic.InconsistentReasonLegRolledBack, basic.RepairTypeManual
+		default:
+			if !leg.Item.Frozen || (leg.FreezeRecord != nil && leg.FreezeRecord.TransferStatus == basic.RecordStatusCaptured) {
+				return nil
+			}
+			issue.Reason, issue.Repair = basic.InconsistentReasonFreezeNotCaptured, basic.RepairTypeManual
+		}
+	case basic.StateStatusRollbackDone:
+		switch leg.Status {
+		case basic.LegStatusDone:
+			issue.Reason, issue.Repair = basic.InconsistentReasonNotCompensated, basic.RepairTypeRollback
+		case basic.LegStatusPending:
+			issue.Reason, issue.Repair = basic.InconsistentReasonNoEmptyRollback, basic.RepairTypeRollback
+		default:
+			return nil
+		}
+	default:
+		//转移中和回滚中的操作可能只执行了一部分
+		return nil
+	}
+	return issue
+}
@@ -3,8 +3,6 @@ package dao
 import (
 	"context"
 
-	"gorm.io/gorm"
-
 	"github.com/zjn-zjn/fisher/basic"
 	"github.com/zjn-zjn/fisher/model"
 )
@@ -31,19 +29,31 @@ import (
 // 2.2 如果是回滚操作，支持将物品回滚到负数
 // 3 进行扣减数量操作
 func DeductionAccount(ctx context.Context, accountId, transferId, amount int64, itemType basic.ItemType, transferScene basic.TransferScene, transferStatus basic.RecordStatus, changeType basic.ChangeType, comment string) error {
+	return defaultLedger().DeductionAccount(ctx, accountId, transferId, amount, itemType, transferScene, transferStatus, changeType, comment)
+}
+
+// DeductionAccount 见包级函数DeductionAccount
+func (l *Ledger) DeductionAccount(ctx context.Context, accountId, transferId, amount int64, itemType basic.ItemType, transferScene basic.TransferScene, transferStatus basic.RecordStatus, changeType basic.ChangeType, comment string) error {
+	return l.deductionAccount(ctx, accountId, transferId, amount, itemType, transferScene, transferStatus, changeType, comment, nil)
+}
+
+// onChange 记录写入或更新成功后、变更账户前在同一本地事务内执行，用于退款等需要同时更新其他记录的操作
+type onChange func(ctx context.Context, tx Store, transferStatus basic.RecordStatus) error
+
+func (l *Ledger) deductionAccount(ctx context.Context, accountId, transferId, amount int64, itemType basic.ItemType, transferScene basic.TransferScene, transferStatus basic.RecordStatus, changeType basic.ChangeType, comment string, change onChange) error {
 	transferType := getRecordTypeWithStatus(basic.RecordTypeDeduct, transferStatus)
 	//账户查询和创建放在最外面，提高并发性能
-	account, err := getAccountDefaultCreate(ctx, accountId, itemType)
+	account, err := l.store.GetOrCreateAccount(ctx, accountId, itemType)
 	if err != nil {
 		return err
 	}
-	//如果是正常操作，需要校验是否有足够的金额进行扣减，官方账户账号除外，如果是回滚操作，支持扣减到负数
-	if transferStatus == basic.RecordStatusNormal && !basic.IsOfficialAccount(accountId) {
-		if account.Amount < amount {
+	//如果是正常操作，需要校验是否有足够的可用金额(数量减去冻结数量)进行扣减，官方账户账号除外，如果是回滚操作，支持扣减到负数
+	if transferStatus == basic.RecordStatusNormal && !l.official.IsOfficialAccount(accountId) {
+		if account.GetAvailableAmount() < amount {
 			return basic.InsufficientAmountErr
 		}
 	}
-	originRecord, err := GetRecord(ctx, accountId, transferId, itemType, transferScene, transferType, changeType)
+	originRecord, err := l.store.GetRecord(ctx, accountId, transferId, itemType, transferScene, transferType, changeType)
 	if err != nil {
 		return err
 	}
@@ -51,19 +61,19 @@ func DeductionAccount(ctx context.Context, accountId, transferId, amount int64,
 		//该操作已完成，直接幂等结束
 		return nil
 	}
-	err = RecordAndAccountInstanceTX(ctx, accountId, func(ctx context.Context, db *gorm.DB) error {
+	err = l.recordAndAccountTX(ctx, accountId, func(ctx context.Context, tx Store) error {
 		if originRecord == nil {
 			if transferStatus == basic.RecordStatusRollback {
 				//如果是回滚操作，需要确认之前是否执行过加的操作，未执行过加直接结束
 				record := assembleRecord(transferId, accountId, amount, transferScene, basic.RecordStatusEmptyRollback, transferType, changeType, itemType, comment)
-				if err = CreateRecord(ctx, &record, db); err != nil {
+				if err = tx.CreateRecord(ctx, &record); err != nil {
 					return err
 				}
 				return nil
 			}
 			//写订单记录
 			record := assembleRecord(transferId, accountId, amount, transferScene, transferStatus, transferType, changeType, itemType, comment)
-			if err = CreateRecord(ctx, &record, db); err != nil {
+			if err = tx.CreateRecord(ctx, &record); err != nil {
 				return err
 			}
 		}
@@ -76,13 +86,18 @@ func DeductionAccount(ctx context.Context, accountId, transferId, amount int64,
 		}
 		//更新订单
 		if originRecord != nil {
-			affect, err := UpdateRecord(ctx, accountId, transferId, itemType, transferScene, transferType, transferStatus, basic.RecordStatusNormal, changeType, db)
+			affect, err := tx.UpdateRecord(ctx, accountId, transferId, itemType, transferScene, transferType, transferStatus, basic.RecordStatusNormal, changeType)
 			if err != nil {
 				return err
 			}
 			if !affect {
-				//该操作已完成，直接结束
-				return nil
+				//该操作已完成，直接结束，已有退款而不能回滚时报错
+				return checkRefundedRollback(ctx, tx, accountId, transferId, itemType, transferScene, transferType, transferStatus, changeType)
+			}
+		}
+		if change != nil {
+			if err = change(ctx, tx, transferStatus); err != nil {
+				return err
 			}
 		}
 		//订单写入/更新成功，对账户进行操作
@@ -90,7 +105,13 @@ func DeductionAccount(ctx context.Context, accountId, transferId, amount int64,
 			//如果操作的是0元，直接结束(一般用于某些官方账号加0操作，只记录转移不加钱)
 			return nil
 		}
-		return deductAccountAmount(ctx, accountId, amount, itemType, transferStatus, db)
+		//官方账号和回滚允许扣减到负数
+		account, err := tx.DeductAccountAmount(ctx, accountId, amount, itemType, transferStatus == basic.RecordStatusRollback || l.official.IsOfficialAccount(accountId))
+		if err != nil {
+			return err
+		}
+		//在同一本地事务内记录操作后的数量和序号
+		return tx.UpdateRecordBalance(ctx, accountId, transferId, itemType, transferScene, transferType, changeType, transferStatus == basic.RecordStatusRollback, account)
 	})
 	if err != nil {
 		return err
@@ -107,13 +128,22 @@ func DeductionAccount(ctx context.Context, accountId, transferId, amount int64,
 // 2 获取账户物品数量信息
 // 3 进行增加数量操作
 func IncreaseAccount(ctx context.Context, accountId, transferId, amount int64, itemType basic.ItemType, transferScene basic.TransferScene, transferStatus basic.RecordStatus, changeType basic.ChangeType, comment string) error {
+	return defaultLedger().IncreaseAccount(ctx, accountId, transferId, amount, itemType, transferScene, transferStatus, changeType, comment)
+}
+
+// IncreaseAccount 见包级函数IncreaseAccount
+func (l *Ledger) IncreaseAccount(ctx context.Context, accountId, transferId, amount int64, itemType basic.ItemType, transferScene basic.TransferScene, transferStatus basic.RecordStatus, changeType basic.ChangeType, comment string) error {
+	return l.increaseAccount(ctx, accountId, transferId, amount, itemType, transferScene, transferStatus, changeType, comment, nil)
+}
+
+func (l *Ledger) increaseAccount(ctx context.Context, accountId, transferId, amount int64, itemType basic.ItemType, transferScene basic.TransferScene, transferStatus basic.RecordStatus, changeType basic.ChangeType, comment string, change onChange) error {
 	transferType := getRecordTypeWithStatus(basic.RecordTypeAdd, transferStatus)
 	//不存在则创建放到最外面，提高并发性能
-	_, err := getAccountDefaultCreate(ctx, accountId, itemType)
+	_, err := l.store.GetOrCreateAccount(ctx, accountId, itemType)
 	if err != nil {
 		return err
 	}
-	originRecord, err := GetRecord(ctx, accountId, transferId, itemType, transferScene, transferType, changeType)
+	originRecord, err := l.store.GetRecord(ctx, accountId, transferId, itemType, transferScene, transferType, changeType)
 	if err != nil {
 		return err
 	}
@@ -121,18 +151,18 @@ func IncreaseAccount(ctx context.Context, accountId, transferId, amount int64, i
 		//该操作已完成，直接幂等结束
 		return nil
 	}
-	err = RecordAndAccountInstanceTX(ctx, accountId, func(ctx context.Context, db *gorm.DB) error {
+	err = l.recordAndAccountTX(ctx, accountId, func(ctx context.Context, tx Store) error {
 		if originRecord == nil {
 			if transferStatus == basic.RecordStatusRollback {
 				//如果是回滚操作，需要确认之前是否执行过减的操作，未执行过减直接结束
 				record := assembleRecord(transferId, accountId, amount, transferScene, basic.RecordStatusEmptyRollback, transferType, changeType, itemType, comment)
-				if err = CreateRecord(ctx, &record, db); err != nil {
+				if err = tx.CreateRecord(ctx, &record); err != nil {
 					return err
 				}
 				return nil
 			}
 			record := assembleRecord(transferId, accountId, amount, transferScene, transferStatus, transferType, changeType, itemType, comment)
-			if err = CreateRecord(ctx, &record, db); err != nil {
+			if err = tx.CreateRecord(ctx, &record); err != nil {
 				return err
 			}
 		}
@@ -145,20 +175,29 @@ func IncreaseAccount(ctx context.Context, accountId, transferId, amount int64, i
 		}
 		//更新订单
 		if originRecord != nil {
-			affect, err := UpdateRecord(ctx, accountId, transferId, itemType, transferScene, transferType, transferStatus, basic.RecordStatusNormal, changeType, db)
+			affect, err := tx.UpdateRecord(ctx, accountId, transferId, itemType, transferScene, transferType, transferStatus, basic.RecordStatusNormal, changeType)
 			if err != nil {
 				return err
 			}
 			if !affect {
-				//该操作已完成，返回成功
-				return nil
+				//该操作已完成，返回成功，已有退款而不能回滚时报错
+				return checkRefundedRollback(ctx, tx, accountId, transferId, itemType, transferScene, transferType, transferStatus, changeType)
+			}
+		}
+		if change != nil {
+			if err = change(ctx, tx, transferStatus); err != nil {
+				return err
 			}
 		}
 		if amount == 0 {
 			//如果金额是0，直接成功返回(一般用于某些官方账号加0操作，只记录转移不加钱)
 			return nil
 		}
-		return increaseAccountAmount(ctx, accountId, amount, itemType, db)
+		account, err := tx.IncreaseAccountAmount(ctx, accountId, amount, itemType)
+		if err != nil {
+			return err
+		}
+		return tx.UpdateRecordBalance(ctx, accountId, transferId, itemType, transferScene, transferType, changeType, transferStatus == basic.RecordStatusRollback, account)
 	})
 	if err != nil {
 		return err
@@ -166,6 +205,22 @@ func IncreaseAccount(ctx context.Context, accountId, transferId, amount int64, i
 	return nil
 }
 
+// checkRefundedRollback 原记录未更新时检查是否因已有退款而不能回滚
+// 回滚在检查退款之后、更新记录之前可能有退款完成，此时原记录保持正常，回滚返回StateMutationErr，需先回滚退款
+func checkRefundedRollback(ctx context.Context, tx Store, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, transferType basic.TransferType, transferStatus basic.RecordStatus, changeType basic.ChangeType) error {
+	if transferStatus != basic.RecordStatusRollback {
+		return nil
+	}
+	record, err := tx.GetRecord(ctx, accountId, transferId, itemType, transferScene, transferType, changeType)
+	if err != nil {
+		return err
+	}
+	if record != nil && record.TransferStatus == basic.RecordStatusNormal && record.RefundedAmount != 0 {
+		return basic.StateMutationErr
+	}
+	return nil
+}
+
 func assembleRecord(transferId, accountId, amount int64, transferScene basic.TransferScene, transferStatus basic.RecordStatus, transferType basic.TransferType, changeType basic.ChangeType, itemType basic.ItemType, comment string) model.Record {
 	return model.Record{
 		TransferId:     transferId,
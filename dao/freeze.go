@@ -0,0 +1,217 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"github.com/zjn-zjn/fisher/basic"
+)
+
+//==============================================================================
+// 冻结case
+// A冻结10，之后扣款转给B，或者解冻
+//
+// 冻结:   A +10冻结(Freeze&Normal)
+// 扣款:   A -10(Deduct&Normal) 冻结记录变为已扣款(Freeze&Captured) 冻结数量-10   B +10(Add&Normal)
+// 扣款回滚: A +10(Deduct&Rollback) 冻结记录恢复(Freeze&Normal) 冻结数量+10
+// 解冻:   A 冻结记录变为回滚(Freeze&Rollback) 冻结数量-10
+// 先解冻后冻结: 解冻记录一条空回滚(Freeze&EmptyRollback)，后到的冻结直接失败
+// 预授权: 带过期时间的冻结，过期后不能扣款，由Inspection解冻
+//==============================================================================
+
+// FreezeAccount 冻结账户物品，冻结的部分计入数量但不可扣减，expireAt大于0时为过期时间(毫秒)
+// 冻结记录已存在时幂等返回，已解冻时返回AlreadyRolledBackErr
+func (l *Ledger) FreezeAccount(ctx context.Context, accountId, transferId, amount int64, itemType basic.ItemType, transferScene basic.TransferScene, changeType basic.ChangeType, comment string, expireAt int64) error {
+	originRecord, err := l.store.GetRecord(ctx, accountId, transferId, itemType, transferScene, basic.RecordTypeFreeze, changeType)
+	if err != nil {
+		return err
+	}
+	if originRecord != nil {
+		return checkFreezeRecord(originRecord.TransferStatus)
+	}
+	account, err := l.store.GetOrCreateAccount(ctx, accountId, itemType)
+	if err != nil {
+		return err
+	}
+	if !l.official.IsOfficialAccount(accountId) && account.GetAvailableAmount() < amount {
+		return basic.InsufficientAmountErr
+	}
+	return l.recordAndAccountTX(ctx, accountId, func(ctx context.Context, tx Store) error {
+		record := assembleRecord(transferId, accountId, amount, transferScene, basic.RecordStatusNormal, basic.RecordTypeFreeze, changeType, itemType, comment)
+		record.ExpireAt = expireAt
+		if err = tx.CreateRecord(ctx, &record); err != nil {
+			return err
+		}
+		if amount == 0 {
+			return nil
+		}
+		return tx.FreezeAccountAmount(ctx, accountId, amount, itemType, l.official.IsOfficialAccount(accountId))
+	})
+}
+
+// checkFreezeRecord 冻结记录已存在时重复冻结的结果
+func checkFreezeRecord(status basic.RecordStatus) error {
+	switch status {
+	case basic.RecordStatusNormal, basic.RecordStatusCaptured:
+		return nil
+	}
+	return basic.AlreadyRolledBackErr
+}
+
+// UnfreezeAccount 解冻账户物品，冻结不存在时记录一条空回滚，避免后到的冻结生效
+// 已解冻时幂等返回，已扣款时返回StateMutationErr
+func (l *Ledger) UnfreezeAccount(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, changeType basic.ChangeType, comment string) error {
+	_, err := l.unfreezeAccount(ctx, accountId, transferId, itemType, transferScene, changeType, comment)
+	return err
+}
+
+// ReleaseExpiredFreeze 解冻已过期的冻结，返回是否由本次解冻，已被扣款或解冻时返回false
+func (l *Ledger) ReleaseExpiredFreeze(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, changeType basic.ChangeType) (bool, error) {
+	released, err := l.unfreezeAccount(ctx, accountId, transferId, itemType, transferScene, changeType, "expired")
+	if basic.Is(err, basic.StateMutationErr) {
+		//过期前已扣款
+		return false, nil
+	}
+	return released, err
+}
+
+func (l *Ledger) unfreezeAccount(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, changeType basic.ChangeType, comment string) (bool, error) {
+	originRecord, err := l.store.GetRecord(ctx, accountId, transferId, itemType, transferScene, basic.RecordTypeFreeze, changeType)
+	if err != nil {
+		return false, err
+	}
+	if originRecord != nil && originRecord.TransferStatus != basic.RecordStatusNormal {
+		return false, checkUnfreezeRecord(originRecord.TransferStatus)
+	}
+	var released bool
+	err = l.recordAndAccountTX(ctx, accountId, func(ctx context.Context, tx Store) error {
+		if originRecord == nil {
+			record := assembleRecord(transferId, accountId, 0, transferScene, basic.RecordStatusEmptyRollback, basic.RecordTypeFreeze, changeType, itemType, comment)
+			return tx.CreateRecord(ctx, &record)
+		}
+		affect, err := tx.UpdateRecord(ctx, accountId, transferId, itemType, transferScene, basic.RecordTypeFreeze, basic.RecordStatusRollback, basic.RecordStatusNormal, changeType)
+		if err != nil {
+			return err
+		}
+		if !affect {
+			//并发的解冻或扣款已完成，以最新的记录为准
+			record, err := tx.GetRecord(ctx, accountId, transferId, itemType, transferScene, basic.RecordTypeFreeze, changeType)
+			if err != nil {
+				return err
+			}
+			return checkUnfreezeRecord(record.TransferStatus)
+		}
+		released = true
+		if originRecord.Amount == 0 {
+			return nil
+		}
+		return tx.UnfreezeAccountAmount(ctx, accountId, originRecord.Amount, itemType)
+	})
+	if err != nil {
+		return false, err
+	}
+	return released, nil
+}
+
+// checkUnfreezeRecord 冻结记录不是冻结中时解冻的结果
+func checkUnfreezeRecord(status basic.RecordStatus) error {
+	if status == basic.RecordStatusCaptured {
+		return basic.StateMutationErr
+	}
+	return nil
+}
+
+// CaptureAccount 将冻结转为扣减，冻结数量和数量同时减少冻结金额，作为Capture转移的扣减操作
+// 需要冻结处于冻结中，扣减已完成时幂等返回，扣减已回滚时返回StateMutationErr
+func (l *Ledger) CaptureAccount(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, changeType basic.ChangeType, comment string) error {
+	originRecord, err := l.store.GetRecord(ctx, accountId, transferId, itemType, transferScene, basic.RecordTypeDeduct, changeType)
+	if err != nil {
+		return err
+	}
+	if originRecord != nil {
+		if originRecord.TransferStatus == basic.RecordStatusNormal {
+			return nil
+		}
+		return basic.StateMutationErr
+	}
+	return l.recordAndAccountTX(ctx, accountId, func(ctx context.Context, tx Store) error {
+		freezeRecord, err := tx.GetRecord(ctx, accountId, transferId, itemType, transferScene, basic.RecordTypeFreeze, changeType)
+		if err != nil {
+			return err
+		}
+		if freezeRecord == nil || freezeRecord.TransferStatus != basic.RecordStatusNormal {
+			//冻结不存在或已解冻
+			return basic.StateMutationErr
+		}
+		if freezeRecord.IsExpired(time.Now().UnixMilli()) {
+			//预授权已过期，等待Inspection解冻
+			return basic.ExpiredErr
+		}
+		affect, err := tx.UpdateRecord(ctx, accountId, transferId, itemType, transferScene, basic.RecordTypeFreeze, basic.RecordStatusCaptured, basic.RecordStatusNormal, changeType)
+		if err != nil {
+			return err
+		}
+		if !affect {
+			return basic.StateMutationErr
+		}
+		record := assembleRecord(transferId, accountId, freezeRecord.Amount, transferScene, basic.RecordStatusNormal, basic.RecordTypeDeduct, changeType, itemType, comment)
+		if err = tx.CreateRecord(ctx, &record); err != nil {
+			return err
+		}
+		if freezeRecord.Amount == 0 {
+			return nil
+		}
+		if err = tx.UnfreezeAccountAmount(ctx, accountId, freezeRecord.Amount, itemType); err != nil {
+			return err
+		}
+		//冻结的部分已从可用数量中扣除，这里不再校验
+		account, err := tx.DeductAccountAmount(ctx, accountId, freezeRecord.Amount, itemType, true)
+		if err != nil {
+			return err
+		}
+		return tx.UpdateRecordBalance(ctx, accountId, transferId, itemType, transferScene, basic.RecordTypeDeduct, changeType, false, account)
+	})
+}
+
+// RollbackCaptureAccount 回滚扣款，恢复数量并重新冻结，冻结回到冻结中，之后可以解冻
+// 扣减不存在时记录一条空回滚，避免后到的扣款生效
+func (l *Ledger) RollbackCaptureAccount(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, changeType basic.ChangeType, comment string) error {
+	originRecord, err := l.store.GetRecord(ctx, accountId, transferId, itemType, transferScene, basic.RecordTypeDeduct, changeType)
+	if err != nil {
+		return err
+	}
+	if originRecord != nil && originRecord.TransferStatus != basic.RecordStatusNormal {
+		return nil
+	}
+	return l.recordAndAccountTX(ctx, accountId, func(ctx context.Context, tx Store) error {
+		if originRecord == nil {
+			record := assembleRecord(transferId, accountId, 0, transferScene, basic.RecordStatusEmptyRollback, basic.RecordTypeDeduct, changeType, itemType, comment)
+			return tx.CreateRecord(ctx, &record)
+		}
+		affect, err := tx.UpdateRecord(ctx, accountId, transferId, itemType, transferScene, basic.RecordTypeDeduct, basic.RecordStatusRollback, basic.RecordStatusNormal, changeType)
+		if err != nil {
+			return err
+		}
+		if !affect {
+			return nil
+		}
+		affect, err = tx.UpdateRecord(ctx, accountId, transferId, itemType, transferScene, basic.RecordTypeFreeze, basic.RecordStatusNormal, basic.RecordStatusCaptured, changeType)
+		if err != nil {
+			return err
+		}
+		if !affect {
+			return basic.StateMutationErr
+		}
+		if originRecord.Amount == 0 {
+			return nil
+		}
+		account, err := tx.IncreaseAccountAmount(ctx, accountId, originRecord.Amount, itemType)
+		if err != nil {
+			return err
+		}
+		if err = tx.UpdateRecordBalance(ctx, accountId, transferId, itemType, transferScene, basic.RecordTypeDeduct, changeType, true, account); err != nil {
+			return err
+		}
+		return tx.FreezeAccountAmount(ctx, accountId, originRecord.Amount, itemType, true)
+	})
+}
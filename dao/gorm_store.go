@@ -0,0 +1,169 @@
+package dao
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+
+	"github.com/zjn-zjn/fisher/basic"
+)
+
+// gormStore 基于gorm的存储实现，按basic中的布局进行分库分表路由
+// 每次操作开始时确定所用布局，重新分片期间写操作完成后会将写入的行同步到影子布局
+type gormStore struct {
+	layouts *basic.LayoutManager
+	layout  *basic.Layout //本次操作使用的布局，为空时获取当前布局
+	shadow  *basic.Layout //影子布局，为空表示无需双写
+	tx      *gorm.DB      //事务内的连接，为空时按路由选择实例
+	touched *[]rowKey     //本次操作写入的行
+}
+
+// NewGormStore 创建基于gorm的存储，使用basic包级初始化的布局
+func NewGormStore() Store {
+	return NewGormStoreWithLayouts(basic.GetDefaultLayoutManager())
+}
+
+// NewGormStoreWithLayouts 创建使用指定布局管理的gorm存储
+func NewGormStoreWithLayouts(layouts *basic.LayoutManager) Store {
+	return &gormStore{layouts: layouts}
+}
+
+// scope 确定本次操作使用的布局后执行fn，写入的行在fn成功后同步到影子布局
+func (s *gormStore) scope(ctx context.Context, fn func(s *gormStore) error) error {
+	if s.layout != nil {
+		return fn(s)
+	}
+	layout, shadow, release := s.layouts.AcquireLayout()
+	defer release()
+	scoped := &gormStore{layouts: s.layouts, layout: layout, shadow: shadow, touched: &[]rowKey{}}
+	if err := fn(scoped); err != nil {
+		return err
+	}
+	scoped.syncShadow(ctx)
+	return nil
+}
+
+// touch 记录写入的行，仅在需要双写时记录
+func (s *gormStore) touch(key rowKey) {
+	if s.shadow != nil {
+		*s.touched = append(*s.touched, key)
+	}
+}
+
+func (s *gormStore) syncShadow(ctx context.Context) {
+	if s.shadow == nil {
+		return
+	}
+	for _, key := range *s.touched {
+		syncRow(ctx, s.layouts, s.layout, s.shadow, key)
+	}
+}
+
+func (s *gormStore) stateTable(ctx context.Context, transferId int64) *gorm.DB {
+	db := s.tx
+	if db == nil {
+		db = s.layout.GetStateWriteDB(ctx, transferId)
+	}
+	return db.Table(s.layout.GetStateTableName(transferId))
+}
+
+func (s *gormStore) recordAndAccountDB(ctx context.Context, accountId int64, readOnly bool) *gorm.DB {
+	if s.tx != nil {
+		return s.tx
+	}
+	if readOnly {
+		return s.layout.GetRecordAndAccountReadDB(ctx, accountId)
+	}
+	return s.layout.GetRecordAndAccountWriteDB(ctx, accountId)
+}
+
+func (s *gormStore) recordTable(ctx context.Context, accountId int64, readOnly bool) *gorm.DB {
+	return s.recordAndAccountDB(ctx, accountId, readOnly).Table(s.layout.GetRecordTableName(accountId))
+}
+
+func (s *gormStore) accountTable(ctx context.Context, accountId int64, readOnly bool) *gorm.DB {
+	return s.recordAndAccountDB(ctx, accountId, readOnly).Table(s.layout.GetAccountTableName(accountId))
+}
+
+// readTables 只读查询依次查询的表，迁移期间当前布局查不到时回退到影子布局
+func (s *gormStore) readTables(readOnly bool, table func(s *gormStore) *gorm.DB) []*gorm.DB {
+	dbs := []*gorm.DB{table(s)}
+	if readOnly && s.tx == nil && s.shadow != nil {
+		dbs = append(dbs, table(&gormStore{layouts: s.layouts, layout: s.shadow}))
+	}
+	return dbs
+}
+
+func (s *gormStore) StateInstanceTX(ctx context.Context, transferId int64, fn func(context.Context, Store) error) error {
+	if s.tx != nil {
+		return fn(ctx, s)
+	}
+	return s.scope(ctx, func(s *gormStore) error {
+		return s.executeTx(s.layout.GetStateWriteDB(ctx, transferId), fn)
+	})
+}
+
+func (s *gormStore) RecordAndAccountInstanceTX(ctx context.Context, accountId int64, fn func(context.Context, Store) error) error {
+	if s.tx != nil {
+		return fn(ctx, s)
+	}
+	return s.scope(ctx, func(s *gormStore) error {
+		return s.executeTx(s.layout.GetRecordAndAccountWriteDB(ctx, accountId), fn)
+	})
+}
+
+func (s *gormStore) executeTx(db *gorm.DB, fn func(context.Context, Store) error) error {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return basic.NewWithErr(basic.DBFailedErrCode, errors.Wrap(tx.Error, "[fisher] begin tx failed"))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	txStore := &gormStore{layouts: s.layouts, layout: s.layout, shadow: s.shadow, tx: tx, touched: &[]rowKey{}}
+	if err := fn(tx.Statement.Context, txStore); err != nil {
+		if rbErr := tx.Rollback().Error; rbErr != nil {
+			return basic.NewWithErr(basic.DBFailedErrCode, errors.Wrap(rbErr, "[fisher] rollback tx failed"))
+		}
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return basic.NewWithErr(basic.DBFailedErrCode, errors.Wrap(err, "[fisher] commit tx failed"))
+	}
+	//事务提交后再同步，未提交的数据不会写入影子布局
+	*s.touched = append(*s.touched, *txStore.touched...)
+	return nil
+}
+
+// sqlStateErr PostgreSQL驱动(pgx、pq)错误
+type sqlStateErr interface {
+	SQLState() string
+}
+
+// isDuplicateKeyErr 是否是唯一键冲突错误
+func isDuplicateKeyErr(err error) bool {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		//开启了TranslateError
+		return true
+	}
+	//MySQL 1062 Duplicate entry
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062
+	}
+	//PostgreSQL 23505 unique_violation
+	var pgErr sqlStateErr
+	if errors.As(err, &pgErr) {
+		return pgErr.SQLState() == "23505"
+	}
+	//SQLite 不同驱动的错误类型不一致，统一按错误信息判断
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
@@ -0,0 +1,29 @@
+package dao
+
+import "github.com/zjn-zjn/fisher/basic"
+
+// Ledger 转移执行器，携带存储和官方账户配置，不依赖包级状态，一个客户端实例持有一个
+type Ledger struct {
+	store    Store
+	official *basic.OfficialAccount
+}
+
+// NewLedger 创建转移执行器
+func NewLedger(store Store, official *basic.OfficialAccount) *Ledger {
+	return &Ledger{store: store, official: official}
+}
+
+// Store 获取使用的存储
+func (l *Ledger) Store() Store {
+	return l.store
+}
+
+// Official 获取官方账户配置
+func (l *Ledger) Official() *basic.OfficialAccount {
+	return l.official
+}
+
+// defaultLedger 包级函数使用的执行器，每次按SetStore和basic包级初始化的配置创建
+func defaultLedger() *Ledger {
+	return NewLedger(store, basic.GetDefaultOfficialAccount())
+}
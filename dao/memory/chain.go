@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+func (s *Store) GetLastRecordChain(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.RecordChain, error) {
+	defer s.lock()()
+	var last *model.RecordChain
+	for key, chain := range s.data.chains {
+		if key.accountId == accountId && key.itemType == itemType && (last == nil || key.chainSeq > last.ChainSeq) {
+			last = chain
+		}
+	}
+	if last == nil {
+		return nil, nil
+	}
+	cp := *last
+	return &cp, nil
+}
+
+func (s *Store) CreateRecordChain(ctx context.Context, chain *model.RecordChain) error {
+	defer s.lock()()
+	key := recordChainKey{chain.AccountId, chain.ItemType, chain.ChainSeq}
+	if _, ok := s.data.chains[key]; ok {
+		return basic.NewDBFailed(fmt.Errorf("duplicate entry '%d-%d-%d' for key 'uk_record_chain'", chain.AccountId, chain.ItemType, chain.ChainSeq))
+	}
+	chain.ID = s.nextId()
+	chain.CreatedAt = now()
+	chain.UpdatedAt = chain.CreatedAt
+	cp := *chain
+	s.data.chains[key] = &cp
+	s.onRollback(func() {
+		delete(s.data.chains, key)
+	})
+	return nil
+}
+
+func (s *Store) ListRecordChain(ctx context.Context, accountId int64, itemType basic.ItemType, afterChainSeq int64, limit int) ([]*model.RecordChain, error) {
+	defer s.lock()()
+	var chains []*model.RecordChain
+	for key, chain := range s.data.chains {
+		if key.accountId == accountId && key.itemType == itemType && key.chainSeq > afterChainSeq {
+			cp := *chain
+			chains = append(chains, &cp)
+		}
+	}
+	sort.Slice(chains, func(i, j int) bool {
+		return chains[i].ChainSeq < chains[j].ChainSeq
+	})
+	if len(chains) > limit {
+		chains = chains[:limit]
+	}
+	return chains, nil
+}
+
+func (s *Store) ListRecordsById(ctx context.Context, accountId int64, itemType basic.ItemType, afterId int64, limit int) ([]*model.Record, error) {
+	defer s.lock()()
+	var records []*model.Record
+	for _, record := range s.data.records {
+		if record.AccountId == accountId && record.ItemType == itemType && record.ID > afterId {
+			cp := *record
+			records = append(records, &cp)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ID < records[j].ID
+	})
+	if len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
@@ -0,0 +1,98 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/dao"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// createOutboxEvent 写入状态变更事件，需已持有锁，同一转移的同一状态已有事件时不写入
+func (s *Store) createOutboxEvent(event *model.OutboxEvent) {
+	key := outboxKey{event.TransferId, event.TransferScene, event.ToStatus}
+	if _, ok := s.data.outbox[key]; ok {
+		return
+	}
+	event.ID = s.nextId()
+	event.CreatedAt = now()
+	event.UpdatedAt = event.CreatedAt
+	cp := *event
+	s.data.outbox[key] = &cp
+	s.onRollback(func() {
+		delete(s.data.outbox, key)
+	})
+}
+
+func (s *Store) EachPendingOutboxEvent(ctx context.Context, batchSize int, fn func(ctx context.Context, store dao.Store, events []*model.OutboxEvent) error) error {
+	unlock := s.lock()
+	var events []*model.OutboxEvent
+	for _, event := range s.data.outbox {
+		if event.Status == basic.OutboxStatusPending {
+			cp := *event
+			events = append(events, &cp)
+		}
+	}
+	unlock()
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].CreatedAt != events[j].CreatedAt {
+			return events[i].CreatedAt < events[j].CreatedAt
+		}
+		return events[i].ID < events[j].ID
+	})
+	for len(events) > 0 {
+		n := batchSize
+		if n > len(events) {
+			n = len(events)
+		}
+		if err := fn(ctx, s, events[:n]); err != nil {
+			return err
+		}
+		events = events[n:]
+	}
+	return nil
+}
+
+func (s *Store) MarkOutboxEventPublished(ctx context.Context, event *model.OutboxEvent) error {
+	return s.updateOutboxEvent(event, func(event *model.OutboxEvent) {
+		event.Status = basic.OutboxStatusPublished
+	})
+}
+
+func (s *Store) MarkOutboxEventFailed(ctx context.Context, event *model.OutboxEvent, errMsg string) error {
+	return s.updateOutboxEvent(event, func(event *model.OutboxEvent) {
+		event.Attempts++
+		event.LastError = errMsg
+	})
+}
+
+func (s *Store) updateOutboxEvent(event *model.OutboxEvent, update func(event *model.OutboxEvent)) error {
+	defer s.lock()()
+	stored, ok := s.data.outbox[outboxKey{event.TransferId, event.TransferScene, event.ToStatus}]
+	if !ok || stored.Status != basic.OutboxStatusPending {
+		return nil
+	}
+	origin := *stored
+	update(stored)
+	stored.UpdatedAt = now()
+	s.onRollback(func() {
+		*stored = origin
+	})
+	return nil
+}
+
+func (s *Store) PurgeOutboxEvents(ctx context.Context, before int64) (int64, error) {
+	defer s.lock()()
+	var purged int64
+	for key, event := range s.data.outbox {
+		if event.Status == basic.OutboxStatusPublished && event.UpdatedAt < before {
+			delete(s.data.outbox, key)
+			s.onRollback(func() {
+				s.data.outbox[key] = event
+			})
+			purged++
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,33 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/zjn-zjn/fisher/basic"
+)
+
+func (s *Store) SumAccountAmount(ctx context.Context) (map[basic.ItemType]int64, error) {
+	defer s.lock()()
+	totals := make(map[basic.ItemType]int64)
+	for _, account := range s.data.accounts {
+		totals[account.ItemType] += account.Amount
+	}
+	return totals, nil
+}
+
+func (s *Store) SumRecordAmount(ctx context.Context) (map[basic.ItemType]int64, error) {
+	defer s.lock()()
+	totals := make(map[basic.ItemType]int64)
+	for _, record := range s.data.records {
+		if record.TransferStatus != basic.RecordStatusNormal {
+			continue
+		}
+		switch record.TransferType {
+		case basic.RecordTypeAdd:
+			totals[record.ItemType] += record.Amount
+		case basic.RecordTypeDeduct:
+			totals[record.ItemType] -= record.Amount
+		}
+	}
+	return totals, nil
+}
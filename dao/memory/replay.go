@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/dao"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// addRecordTotal 与gorm存储的回放一致，只有正常状态的增减记录生效，冻结数量为冻结中的冻结记录之和
+func addRecordTotal(total *model.RecordTotal, record *model.Record) {
+	total.Records++
+	if record.TransferStatus == basic.RecordStatusNormal {
+		switch record.TransferType {
+		case basic.RecordTypeAdd:
+			total.Amount += record.Amount
+		case basic.RecordTypeDeduct:
+			total.Amount -= record.Amount
+		case basic.RecordTypeFreeze:
+			total.Frozen += record.Amount
+		}
+	}
+	for _, sequence := range []int64{record.Sequence, record.RollbackSequence} {
+		if sequence > total.Sequence {
+			total.Sequence = sequence
+		}
+	}
+}
+
+func (s *Store) GetAccountRecordTotal(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.RecordTotal, error) {
+	defer s.lock()()
+	total := &model.RecordTotal{AccountId: accountId, ItemType: itemType}
+	for _, record := range s.data.records {
+		if record.AccountId == accountId && record.ItemType == itemType {
+			addRecordTotal(total, record)
+		}
+	}
+	return total, nil
+}
+
+func (s *Store) EachRecordAccount(ctx context.Context, batchSize int, fn func(ctx context.Context, store dao.Store, totals []*model.RecordTotal) error) error {
+	unlock := s.lock()
+	totalMap := make(map[accountKey]*model.RecordTotal)
+	for _, record := range s.data.records {
+		key := accountKey{record.AccountId, record.ItemType}
+		total, ok := totalMap[key]
+		if !ok {
+			total = &model.RecordTotal{AccountId: record.AccountId, ItemType: record.ItemType}
+			totalMap[key] = total
+		}
+		addRecordTotal(total, record)
+	}
+	unlock()
+	totals := make([]*model.RecordTotal, 0, len(totalMap))
+	for _, total := range totalMap {
+		totals = append(totals, total)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].AccountId != totals[j].AccountId {
+			return totals[i].AccountId < totals[j].AccountId
+		}
+		return totals[i].ItemType < totals[j].ItemType
+	})
+	for len(totals) > 0 {
+		n := batchSize
+		if n > len(totals) {
+			n = len(totals)
+		}
+		if err := fn(ctx, s, totals[:n]); err != nil {
+			return err
+		}
+		totals = totals[n:]
+	}
+	return nil
+}
+
+// LockAccount 事务内持有全局锁，获取或创建即可
+func (s *Store) LockAccount(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.Account, error) {
+	return s.GetOrCreateAccount(ctx, accountId, itemType)
+}
+
+func (s *Store) SetAccountAmount(ctx context.Context, accountId int64, itemType basic.ItemType, amount, frozenAmount, sequence int64) error {
+	defer s.lock()()
+	account, ok := s.data.accounts[accountKey{accountId, itemType}]
+	if !ok {
+		return nil
+	}
+	origin := *account
+	account.Amount, account.FrozenAmount, account.Sequence = amount, frozenAmount, sequence
+	s.onRollback(func() {
+		account.Amount, account.FrozenAmount, account.Sequence = origin.Amount, origin.FrozenAmount, origin.Sequence
+	})
+	return nil
+}
@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/dao"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+func (s *Store) EachAccount(ctx context.Context, batchSize int, fn func(ctx context.Context, store dao.Store, accounts []*model.Account) error) error {
+	unlock := s.lock()
+	accounts := make([]*model.Account, 0, len(s.data.accounts))
+	for _, account := range s.data.accounts {
+		cp := *account
+		accounts = append(accounts, &cp)
+	}
+	unlock()
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].ID < accounts[j].ID
+	})
+	for len(accounts) > 0 {
+		n := batchSize
+		if n > len(accounts) {
+			n = len(accounts)
+		}
+		if err := fn(ctx, s, accounts[:n]); err != nil {
+			return err
+		}
+		accounts = accounts[n:]
+	}
+	return nil
+}
+
+func (s *Store) GetAccountSnapshot(ctx context.Context, accountId int64, itemType basic.ItemType, cutOff int64) (*model.AccountSnapshot, error) {
+	defer s.lock()()
+	snapshot, ok := s.data.snapshots[snapshotKey{accountId, itemType, cutOff}]
+	if !ok {
+		return nil, nil
+	}
+	cp := *snapshot
+	return &cp, nil
+}
+
+func (s *Store) GetLastAccountSnapshot(ctx context.Context, accountId int64, itemType basic.ItemType, until int64) (*model.AccountSnapshot, error) {
+	defer s.lock()()
+	var last *model.AccountSnapshot
+	for key, snapshot := range s.data.snapshots {
+		if key.accountId != accountId || key.itemType != itemType || key.cutOff > until {
+			continue
+		}
+		if last == nil || snapshot.CutOff > last.CutOff {
+			last = snapshot
+		}
+	}
+	if last == nil {
+		return nil, nil
+	}
+	cp := *last
+	return &cp, nil
+}
+
+func (s *Store) CreateAccountSnapshot(ctx context.Context, snapshot *model.AccountSnapshot) (bool, error) {
+	defer s.lock()()
+	key := snapshotKey{snapshot.AccountId, snapshot.ItemType, snapshot.CutOff}
+	if _, ok := s.data.snapshots[key]; ok {
+		return false, nil
+	}
+	snapshot.ID = s.nextId()
+	snapshot.CreatedAt = now()
+	snapshot.UpdatedAt = snapshot.CreatedAt
+	cp := *snapshot
+	s.data.snapshots[key] = &cp
+	s.onRollback(func() {
+		delete(s.data.snapshots, key)
+	})
+	return true, nil
+}
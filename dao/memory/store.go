@@ -0,0 +1,588 @@
+// Package memory 内存存储实现，语义与默认的gorm存储保持一致，适用于单元测试和本地开发
+package memory
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/dao"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+type stateKey struct {
+	transferId    int64
+	transferScene basic.TransferScene
+}
+
+type recordKey struct {
+	accountId     int64
+	transferId    int64
+	itemType      basic.ItemType
+	transferScene basic.TransferScene
+	transferType  basic.TransferType
+	changeType    basic.ChangeType
+}
+
+type accountKey struct {
+	accountId int64
+	itemType  basic.ItemType
+}
+
+type snapshotKey struct {
+	accountId int64
+	itemType  basic.ItemType
+	cutOff    int64
+}
+
+type recordChainKey struct {
+	accountId int64
+	itemType  basic.ItemType
+	chainSeq  int64
+}
+
+type outboxKey struct {
+	transferId    int64
+	transferScene basic.TransferScene
+	toStatus      basic.StateStatus
+}
+
+type data struct {
+	mu        sync.Mutex
+	lastId    int64
+	states    map[stateKey]*model.State
+	records   map[recordKey]*model.Record
+	accounts  map[accountKey]*model.Account
+	snapshots map[snapshotKey]*model.AccountSnapshot
+	outbox    map[outboxKey]*model.OutboxEvent
+	chains    map[recordChainKey]*model.RecordChain
+}
+
+// Store 内存存储
+// 所有数据保存在进程内，本地事务通过全局锁加回滚日志实现，事务内的操作要么全部生效要么全部撤销
+type Store struct {
+	data *data
+	undo *[]func() //事务内的回滚日志，为空表示不在事务内
+}
+
+// NewStore 创建内存存储
+func NewStore() *Store {
+	return &Store{
+		data: &data{
+			states:    make(map[stateKey]*model.State),
+			records:   make(map[recordKey]*model.Record),
+			accounts:  make(map[accountKey]*model.Account),
+			snapshots: make(map[snapshotKey]*model.AccountSnapshot),
+			outbox:    make(map[outboxKey]*model.OutboxEvent),
+			chains:    make(map[recordChainKey]*model.RecordChain),
+		},
+	}
+}
+
+// Init 使用内存存储初始化，conf中的DBs可为空
+func Init(conf *basic.TransferConf) (*Store, error) {
+	if err := basic.InitWithoutDB(conf); err != nil {
+		return nil, err
+	}
+	s := NewStore()
+	dao.SetStore(s)
+	return s, nil
+}
+
+var _ dao.Store = (*Store)(nil)
+
+// lock 非事务内的操作需要加锁，事务内已持有锁
+func (s *Store) lock() func() {
+	if s.undo != nil {
+		return func() {}
+	}
+	s.data.mu.Lock()
+	return s.data.mu.Unlock
+}
+
+// onRollback 记录事务回滚时需要执行的撤销操作
+func (s *Store) onRollback(fn func()) {
+	if s.undo != nil {
+		*s.undo = append(*s.undo, fn)
+	}
+}
+
+func (s *Store) nextId() int64 {
+	s.data.lastId++
+	id := s.data.lastId
+	s.onRollback(func() {
+		s.data.lastId--
+	})
+	return id
+}
+
+func (s *Store) executeTx(ctx context.Context, fn func(context.Context, dao.Store) error) error {
+	if s.undo != nil {
+		return fn(ctx, s)
+	}
+	s.data.mu.Lock()
+	defer s.data.mu.Unlock()
+	var undo []func()
+	tx := &Store{data: s.data, undo: &undo}
+	rollback := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			rollback()
+			panic(r)
+		}
+	}()
+	if err := fn(ctx, tx); err != nil {
+		rollback()
+		return err
+	}
+	return nil
+}
+
+func (s *Store) StateInstanceTX(ctx context.Context, transferId int64, fn func(context.Context, dao.Store) error) error {
+	return s.executeTx(ctx, fn)
+}
+
+func (s *Store) RecordAndAccountInstanceTX(ctx context.Context, accountId int64, fn func(context.Context, dao.Store) error) error {
+	return s.executeTx(ctx, fn)
+}
+
+func now() int64 {
+	return time.Now().UnixMilli()
+}
+
+func copyState(state *model.State) *model.State {
+	cp := *state
+	cp.FromAccounts = copyAccountList(state.FromAccounts)
+	cp.ToAccounts = copyAccountList(state.ToAccounts)
+	return &cp
+}
+
+func copyAccountList(list model.AccountList) model.AccountList {
+	if list == nil {
+		return nil
+	}
+	cp := make(model.AccountList, 0, len(list))
+	for _, item := range list {
+		itemCp := *item
+		cp = append(cp, &itemCp)
+	}
+	return cp
+}
+
+func (s *Store) GetState(ctx context.Context, transferId int64, transferScene basic.TransferScene) (*model.State, error) {
+	defer s.lock()()
+	state, ok := s.data.states[stateKey{transferId, transferScene}]
+	if !ok {
+		return nil, nil
+	}
+	return copyState(state), nil
+}
+
+func (s *Store) CreateState(ctx context.Context, state *model.State) error {
+	defer s.lock()()
+	key := stateKey{state.TransferId, state.TransferScene}
+	if _, ok := s.data.states[key]; ok {
+		return basic.NewDBFailed(fmt.Errorf("duplicate entry '%d-%d' for key 'uk_state'", state.TransferId, state.TransferScene))
+	}
+	state.ID = s.nextId()
+	state.CreatedAt = now()
+	state.UpdatedAt = state.CreatedAt
+	s.data.states[key] = copyState(state)
+	s.onRollback(func() {
+		delete(s.data.states, key)
+	})
+	if basic.IsOutboxStateStatus(state.Status) {
+		s.createOutboxEvent(model.AssembleOutboxEvent(state.TransferId, state.TransferScene, 0, state.Status))
+	}
+	return nil
+}
+
+func (s *Store) updateState(state *model.State, toStatus basic.StateStatus) {
+	origin := *state
+	state.Status = toStatus
+	state.UpdatedAt = now()
+	s.onRollback(func() {
+		*state = origin
+	})
+}
+
+func (s *Store) UpdateStateStatus(ctx context.Context, transferId int64, transferScene basic.TransferScene, fromStatus, toStatus basic.StateStatus) (bool, error) {
+	defer s.lock()()
+	state, ok := s.data.states[stateKey{transferId, transferScene}]
+	if !ok || state.Status != fromStatus {
+		return false, nil
+	}
+	s.updateState(state, toStatus)
+	if basic.IsOutboxStateStatus(toStatus) {
+		s.createOutboxEvent(model.AssembleOutboxEvent(transferId, transferScene, fromStatus, toStatus))
+	}
+	return true, nil
+}
+
+func (s *Store) UpdateStateToRollbackDoing(ctx context.Context, transferId int64, transferScene basic.TransferScene) (bool, error) {
+	defer s.lock()()
+	state, ok := s.data.states[stateKey{transferId, transferScene}]
+	if !ok || state.Status == basic.StateStatusRollbackDone {
+		return false, nil
+	}
+	s.updateState(state, basic.StateStatusRollbackDoing)
+	return true, nil
+}
+
+func (s *Store) GetNeedInspectionStateList(ctx context.Context, lastTime int64) ([]*model.State, error) {
+	defer s.lock()()
+	var states []*model.State
+	for _, state := range s.data.states {
+		if state.Status <= basic.StateStatusHalfSuccess && state.UpdatedAt <= lastTime {
+			states = append(states, copyState(state))
+		}
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].ID < states[j].ID
+	})
+	return states, nil
+}
+
+func (s *Store) GetStateListByCreatedAt(ctx context.Context, start, end int64) ([]*model.State, error) {
+	defer s.lock()()
+	var states []*model.State
+	for _, state := range s.data.states {
+		if state.CreatedAt >= start && state.CreatedAt < end {
+			states = append(states, copyState(state))
+		}
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].ID < states[j].ID
+	})
+	return states, nil
+}
+
+func (s *Store) GetRecord(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, transferType basic.TransferType, changeType basic.ChangeType) (*model.Record, error) {
+	defer s.lock()()
+	record, ok := s.data.records[recordKey{accountId, transferId, itemType, transferScene, transferType, changeType}]
+	if !ok {
+		return nil, nil
+	}
+	cp := *record
+	return &cp, nil
+}
+
+func (s *Store) CreateRecord(ctx context.Context, record *model.Record) error {
+	defer s.lock()()
+	key := recordKey{record.AccountId, record.TransferId, record.ItemType, record.TransferScene, record.TransferType, record.ChangeType}
+	if _, ok := s.data.records[key]; ok {
+		return basic.NewDBFailed(fmt.Errorf("duplicate entry '%d-%d' for key 'uk_record'", record.AccountId, record.TransferId))
+	}
+	record.ID = s.nextId()
+	record.CreatedAt = now()
+	record.UpdatedAt = record.CreatedAt
+	cp := *record
+	s.data.records[key] = &cp
+	s.onRollback(func() {
+		delete(s.data.records, key)
+	})
+	return nil
+}
+
+func (s *Store) UpdateRecord(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, transferType basic.TransferType, transferStatus, originTransferStatus basic.RecordStatus, changeType basic.ChangeType) (bool, error) {
+	defer s.lock()()
+	record, ok := s.data.records[recordKey{accountId, transferId, itemType, transferScene, transferType, changeType}]
+	if !ok || record.TransferStatus != originTransferStatus {
+		return false, nil
+	}
+	if originTransferStatus == basic.RecordStatusNormal && transferStatus == basic.RecordStatusRollback && record.RefundedAmount != 0 {
+		return false, nil
+	}
+	origin := *record
+	record.TransferStatus = transferStatus
+	record.UpdatedAt = now()
+	s.onRollback(func() {
+		*record = origin
+	})
+	return true, nil
+}
+
+func (s *Store) UpdateRecordRefundedAmount(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, transferType basic.TransferType, changeType basic.ChangeType, delta int64) (bool, error) {
+	defer s.lock()()
+	record, ok := s.data.records[recordKey{accountId, transferId, itemType, transferScene, transferType, changeType}]
+	if !ok || record.TransferStatus != basic.RecordStatusNormal {
+		return false, nil
+	}
+	refunded := record.RefundedAmount + delta
+	if refunded < 0 || refunded > record.Amount {
+		return false, nil
+	}
+	origin := *record
+	//与gorm存储的UpdateColumn一致，不更新UpdatedAt，快照按UpdatedAt识别回滚
+	record.RefundedAmount = refunded
+	s.onRollback(func() {
+		*record = origin
+	})
+	return true, nil
+}
+
+func (s *Store) UpdateRecordBalance(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, transferType basic.TransferType, changeType basic.ChangeType, rollback bool, account *model.Account) error {
+	defer s.lock()()
+	record, ok := s.data.records[recordKey{accountId, transferId, itemType, transferScene, transferType, changeType}]
+	if !ok {
+		return nil
+	}
+	origin := *record
+	if rollback {
+		record.RollbackBalanceAfter, record.RollbackSequence = account.Amount, account.Sequence
+	} else {
+		record.BalanceAfter, record.Sequence = account.Amount, account.Sequence
+	}
+	s.onRollback(func() {
+		*record = origin
+	})
+	return nil
+}
+
+func (s *Store) GetAccountRecordsBetween(ctx context.Context, accountId int64, itemType basic.ItemType, after, until int64) ([]*model.Record, error) {
+	defer s.lock()()
+	if until <= 0 {
+		until = math.MaxInt64
+	}
+	var records []*model.Record
+	for _, record := range s.data.records {
+		if record.AccountId != accountId || record.ItemType != itemType || (record.TransferType != basic.RecordTypeAdd && record.TransferType != basic.RecordTypeDeduct) {
+			continue
+		}
+		if (record.CreatedAt > after && record.CreatedAt <= until) || (record.TransferStatus == basic.RecordStatusRollback && record.UpdatedAt > after && record.UpdatedAt <= until) {
+			cp := *record
+			records = append(records, &cp)
+		}
+	}
+	return records, nil
+}
+
+func (s *Store) GetExpiredFreezeRecordList(ctx context.Context, now int64) ([]*model.Record, error) {
+	defer s.lock()()
+	var records []*model.Record
+	for _, record := range s.data.records {
+		if record.TransferType == basic.RecordTypeFreeze && record.TransferStatus == basic.RecordStatusNormal && record.IsExpired(now) {
+			cp := *record
+			records = append(records, &cp)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ID < records[j].ID
+	})
+	return records, nil
+}
+
+func (s *Store) GetAccountLastRecord(ctx context.Context, accountId int64, itemType *basic.ItemType, transferScene *basic.TransferScene, transferType *basic.TransferType, readOnly bool) (*model.Record, error) {
+	defer s.lock()()
+	var last *model.Record
+	for _, record := range s.data.records {
+		if record.AccountId != accountId || record.TransferStatus != basic.RecordStatusNormal {
+			continue
+		}
+		if itemType != nil && record.ItemType != *itemType {
+			continue
+		}
+		if transferScene != nil && record.TransferScene != *transferScene {
+			continue
+		}
+		if transferType != nil && record.TransferType != *transferType {
+			continue
+		}
+		if last == nil || recordBefore(last, record) {
+			last = record
+		}
+	}
+	if last == nil {
+		return nil, nil
+	}
+	cp := *last
+	return &cp, nil
+}
+
+func (s *Store) ListAccountRecords(ctx context.Context, req *model.ListRecordReq, limit int) ([]*model.Record, error) {
+	defer s.lock()()
+	var cursor *model.Record
+	if req.Cursor > 0 {
+		for _, record := range s.data.records {
+			if record.ID == req.Cursor && record.AccountId == req.AccountId {
+				cursor = record
+			}
+		}
+		if cursor == nil {
+			return nil, nil
+		}
+	}
+	var records []*model.Record
+	for _, record := range s.data.records {
+		if record.AccountId != req.AccountId || !matchRecord(record, req) {
+			continue
+		}
+		if cursor != nil && (req.Asc && !recordBefore(cursor, record) || !req.Asc && !recordBefore(record, cursor)) {
+			continue
+		}
+		cp := *record
+		records = append(records, &cp)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if req.Asc {
+			return recordBefore(records[i], records[j])
+		}
+		return recordBefore(records[j], records[i])
+	})
+	if len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+// recordBefore 与gorm存储一致按(创建时间, ID)排序
+func recordBefore(a, b *model.Record) bool {
+	if a.CreatedAt != b.CreatedAt {
+		return a.CreatedAt < b.CreatedAt
+	}
+	return a.ID < b.ID
+}
+
+// matchRecord 记录是否满足查询的筛选条件
+func matchRecord(record *model.Record, req *model.ListRecordReq) bool {
+	if req.ItemType != nil && record.ItemType != *req.ItemType {
+		return false
+	}
+	if req.TransferScene != nil && record.TransferScene != *req.TransferScene {
+		return false
+	}
+	if req.ChangeType != nil && record.ChangeType != *req.ChangeType {
+		return false
+	}
+	if req.TransferType != nil && record.TransferType != *req.TransferType {
+		return false
+	}
+	if req.TransferStatus != nil && record.TransferStatus != *req.TransferStatus {
+		return false
+	}
+	if req.HideRolledBack && (record.TransferStatus == basic.RecordStatusRollback || record.TransferStatus == basic.RecordStatusEmptyRollback) {
+		return false
+	}
+	if req.StartTime > 0 && record.CreatedAt < req.StartTime {
+		return false
+	}
+	return req.EndTime <= 0 || record.CreatedAt < req.EndTime
+}
+
+func (s *Store) GetOrCreateAccount(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.Account, error) {
+	defer s.lock()()
+	key := accountKey{accountId, itemType}
+	account, ok := s.data.accounts[key]
+	if !ok {
+		account = &model.Account{
+			ID:        s.nextId(),
+			AccountId: accountId,
+			ItemType:  itemType,
+			CreatedAt: now(),
+		}
+		account.UpdatedAt = account.CreatedAt
+		s.data.accounts[key] = account
+		s.onRollback(func() {
+			delete(s.data.accounts, key)
+		})
+	}
+	cp := *account
+	return &cp, nil
+}
+
+func (s *Store) GetAccountAmount(ctx context.Context, accountId int64, readOnly bool) (map[basic.ItemType]int64, error) {
+	defer s.lock()()
+	amountMap := make(map[basic.ItemType]int64)
+	for key, account := range s.data.accounts {
+		if key.accountId == accountId {
+			amountMap[key.itemType] = account.Amount
+		}
+	}
+	return amountMap, nil
+}
+
+func (s *Store) GetAccountAmountByItemType(ctx context.Context, accountId int64, itemType basic.ItemType, readOnly bool) (int64, error) {
+	defer s.lock()()
+	account, ok := s.data.accounts[accountKey{accountId, itemType}]
+	if !ok {
+		return 0, nil
+	}
+	return account.Amount, nil
+}
+
+func (s *Store) GetAccount(ctx context.Context, accountId int64, itemType basic.ItemType, readOnly bool) (*model.Account, error) {
+	defer s.lock()()
+	account, ok := s.data.accounts[accountKey{accountId, itemType}]
+	if !ok {
+		return nil, nil
+	}
+	cp := *account
+	return &cp, nil
+}
+
+func (s *Store) DeductAccountAmount(ctx context.Context, accountId, amount int64, itemType basic.ItemType, allowNegative bool) (*model.Account, error) {
+	defer s.lock()()
+	account, ok := s.data.accounts[accountKey{accountId, itemType}]
+	//与 amount - frozen_amount - ? >= 0 的条件更新保持一致，无匹配行视为金额不足
+	if !ok || (!allowNegative && account.Amount-account.FrozenAmount-amount < 0) {
+		return nil, basic.InsufficientAmountErr
+	}
+	account.Amount -= amount
+	account.Sequence++
+	s.onRollback(func() {
+		account.Amount += amount
+		account.Sequence--
+	})
+	cp := *account
+	return &cp, nil
+}
+
+func (s *Store) IncreaseAccountAmount(ctx context.Context, accountId, amount int64, itemType basic.ItemType) (*model.Account, error) {
+	defer s.lock()()
+	account, ok := s.data.accounts[accountKey{accountId, itemType}]
+	if !ok {
+		return nil, basic.StateMutationErr
+	}
+	account.Amount += amount
+	account.Sequence++
+	s.onRollback(func() {
+		account.Amount -= amount
+		account.Sequence--
+	})
+	cp := *account
+	return &cp, nil
+}
+
+func (s *Store) FreezeAccountAmount(ctx context.Context, accountId, amount int64, itemType basic.ItemType, allowNegative bool) error {
+	defer s.lock()()
+	account, ok := s.data.accounts[accountKey{accountId, itemType}]
+	if !ok || (!allowNegative && account.Amount-account.FrozenAmount-amount < 0) {
+		return basic.InsufficientAmountErr
+	}
+	account.FrozenAmount += amount
+	s.onRollback(func() {
+		account.FrozenAmount -= amount
+	})
+	return nil
+}
+
+func (s *Store) UnfreezeAccountAmount(ctx context.Context, accountId, amount int64, itemType basic.ItemType) error {
+	defer s.lock()()
+	account, ok := s.data.accounts[accountKey{accountId, itemType}]
+	if !ok || account.FrozenAmount-amount < 0 {
+		return basic.StateMutationErr
+	}
+	account.FrozenAmount -= amount
+	s.onRollback(func() {
+		account.FrozenAmount += amount
+	})
+	return nil
+}
@@ -0,0 +1,223 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// rowKey 重新分片期间需要同步到影子布局的行，按唯一键定位
+type rowKey struct {
+	spec    *basic.TableSpec
+	routeId int64                  //路由ID，转移状态为转移ID，记录和账户为账户ID
+	where   map[string]interface{} //唯一键条件
+}
+
+func stateKey(transferId int64, transferScene basic.TransferScene) rowKey {
+	return rowKey{spec: basic.StateTableSpec, routeId: transferId, where: map[string]interface{}{
+		"transfer_id": transferId, "transfer_scene": transferScene,
+	}}
+}
+
+func recordKey(accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, transferType basic.TransferType, changeType basic.ChangeType) rowKey {
+	return rowKey{spec: basic.RecordTableSpec, routeId: accountId, where: map[string]interface{}{
+		"account_id": accountId, "transfer_id": transferId, "item_type": itemType,
+		"transfer_scene": transferScene, "transfer_type": transferType, "change_type": changeType,
+	}}
+}
+
+func accountKey(accountId int64, itemType basic.ItemType) rowKey {
+	return rowKey{spec: basic.AccountTableSpec, routeId: accountId, where: map[string]interface{}{
+		"account_id": accountId, "item_type": itemType,
+	}}
+}
+
+func snapshotKey(accountId int64, itemType basic.ItemType, cutOff int64) rowKey {
+	return rowKey{spec: basic.AccountSnapshotTableSpec, routeId: accountId, where: map[string]interface{}{
+		"account_id": accountId, "item_type": itemType, "cut_off": cutOff,
+	}}
+}
+
+func recordChainKey(accountId int64, itemType basic.ItemType, chainSeq int64) rowKey {
+	return rowKey{spec: basic.RecordChainTableSpec, routeId: accountId, where: map[string]interface{}{
+		"account_id": accountId, "item_type": itemType, "chain_seq": chainSeq,
+	}}
+}
+
+func outboxKey(transferId int64, transferScene basic.TransferScene, toStatus basic.StateStatus) rowKey {
+	return rowKey{spec: basic.OutboxTableSpec, routeId: transferId, where: map[string]interface{}{
+		"transfer_id": transferId, "transfer_scene": transferScene, "to_status": toStatus,
+	}}
+}
+
+// location 获取行在布局中所在的库下标和表名
+func location(layout *basic.Layout, spec *basic.TableSpec, routeId int64) (int64, string) {
+	switch spec {
+	case basic.StateTableSpec:
+		return layout.GetStateDBIndex(routeId), layout.GetStateTableName(routeId)
+	case basic.OutboxTableSpec:
+		return layout.GetStateDBIndex(routeId), layout.GetOutboxTableName(routeId)
+	case basic.RecordTableSpec:
+		return layout.GetRecordAndAccountDBIndex(routeId), layout.GetRecordTableName(routeId)
+	case basic.RecordChainTableSpec:
+		return layout.GetRecordAndAccountDBIndex(routeId), layout.GetRecordChainTableName(routeId)
+	case basic.AccountSnapshotTableSpec:
+		return layout.GetRecordAndAccountDBIndex(routeId), layout.GetAccountSnapshotTableName(routeId)
+	}
+	return layout.GetRecordAndAccountDBIndex(routeId), layout.GetAccountTableName(routeId)
+}
+
+// uniqueColumns 表的唯一键列，用于定位和冲突更新
+func uniqueColumns(spec *basic.TableSpec) []clause.Column {
+	for _, index := range spec.Indexes {
+		if index.Unique {
+			columns := make([]clause.Column, 0, len(index.Columns))
+			for _, name := range index.Columns {
+				columns = append(columns, clause.Column{Name: name})
+			}
+			return columns
+		}
+	}
+	return nil
+}
+
+// mirrorColumns 同步时覆盖的列，主键在各布局中独立生成，不做同步
+func mirrorColumns(spec *basic.TableSpec) []string {
+	columns := make([]string, 0, len(spec.Columns))
+	for _, column := range spec.Columns {
+		if column.Type != basic.ColumnTypeID {
+			columns = append(columns, column.Name)
+		}
+	}
+	return columns
+}
+
+// lockRows 加行锁读取源数据，保证同一行的多次同步按源库提交顺序写入目标
+func lockRows(db *gorm.DB) *gorm.DB {
+	if db.Dialector.Name() == "sqlite" {
+		//SQLite不支持行锁，写事务本身是串行的
+		return db
+	}
+	return db.Clauses(clause.Locking{Strength: "UPDATE"})
+}
+
+// upsertRows 按唯一键写入目标表，已存在时覆盖除主键外的全部列
+func upsertRows(db *gorm.DB, tableName string, spec *basic.TableSpec, rows interface{}) error {
+	return db.Table(tableName).Omit("id").Clauses(clause.OnConflict{
+		Columns:   uniqueColumns(spec),
+		DoUpdates: clause.AssignmentColumns(mirrorColumns(spec)),
+	}).Create(rows).Error
+}
+
+// mirrorRow 将行从from布局同步到to布局，源行不存在时删除目标行，所在库表相同时跳过
+func mirrorRow(ctx context.Context, from, to *basic.Layout, key rowKey) error {
+	srcIdx, srcTable := location(from, key.spec, key.routeId)
+	dstIdx, dstTable := location(to, key.spec, key.routeId)
+	srcDB, dstDB := from.GetShardDB(key.spec.Kind, srcIdx), to.GetShardDB(key.spec.Kind, dstIdx)
+	if srcDB == dstDB && srcTable == dstTable {
+		return nil
+	}
+	return srcDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		dst := dstDB.WithContext(ctx)
+		if srcDB == dstDB {
+			//同库时在同一事务内写入
+			dst = tx
+		}
+		switch key.spec {
+		case basic.StateTableSpec:
+			return mirrorTo[model.State](tx, srcTable, dst, dstTable, key)
+		case basic.RecordTableSpec:
+			return mirrorTo[model.Record](tx, srcTable, dst, dstTable, key)
+		case basic.RecordChainTableSpec:
+			return mirrorTo[model.RecordChain](tx, srcTable, dst, dstTable, key)
+		case basic.AccountSnapshotTableSpec:
+			return mirrorTo[model.AccountSnapshot](tx, srcTable, dst, dstTable, key)
+		case basic.OutboxTableSpec:
+			return mirrorTo[model.OutboxEvent](tx, srcTable, dst, dstTable, key)
+		}
+		return mirrorTo[model.Account](tx, srcTable, dst, dstTable, key)
+	})
+}
+
+func mirrorTo[T any](src *gorm.DB, srcTable string, dst *gorm.DB, dstTable string, key rowKey) error {
+	var rows []T
+	if err := lockRows(src).Table(srcTable).Where(key.where).Find(&rows).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		//源行已删除或写入未提交，同步删除
+		return dst.Table(dstTable).Where(key.where).Delete(new(T)).Error
+	}
+	return upsertRows(dst, dstTable, key.spec, &rows)
+}
+
+// dirtySet 同步到影子布局失败的行
+type dirtySet struct {
+	mu   sync.Mutex
+	rows map[string]rowKey
+}
+
+var dirtySets sync.Map //*basic.LayoutManager -> *dirtySet，每个布局管理独立记录
+
+func getDirtySet(layouts *basic.LayoutManager) *dirtySet {
+	set, _ := dirtySets.LoadOrStore(layouts, &dirtySet{rows: make(map[string]rowKey)})
+	return set.(*dirtySet)
+}
+
+// syncRow 同步行到影子布局，失败时记录下来等待SyncDirtyRows重试，不影响本次操作的结果
+func syncRow(ctx context.Context, layouts *basic.LayoutManager, from, to *basic.Layout, key rowKey) {
+	if err := mirrorRow(ctx, from, to, key); err != nil {
+		set := getDirtySet(layouts)
+		set.mu.Lock()
+		set.rows[fmt.Sprint(key.spec.Prefix, key.where)] = key
+		set.mu.Unlock()
+	}
+}
+
+// SyncDirtyRows 重试同步到影子布局失败的行，返回仍未同步成功的行数
+// 切换布局前需保证返回0，否则新布局中可能缺少最近的写入
+func SyncDirtyRows(ctx context.Context, layouts *basic.LayoutManager) (int, error) {
+	layout, shadow, release := layouts.AcquireLayout()
+	defer release()
+	return syncDirtyRows(ctx, layouts, layout, shadow)
+}
+
+// SyncDirtyRowsFrozen 与SyncDirtyRows相同，在FreezeLayout冻结期间使用
+func SyncDirtyRowsFrozen(ctx context.Context, layouts *basic.LayoutManager) (int, error) {
+	return syncDirtyRows(ctx, layouts, layouts.GetLayout(), layouts.GetShadowLayout())
+}
+
+func syncDirtyRows(ctx context.Context, layouts *basic.LayoutManager, layout, shadow *basic.Layout) (int, error) {
+	set := getDirtySet(layouts)
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	if shadow == nil {
+		return len(set.rows), nil
+	}
+	var lastErr error
+	for k, key := range set.rows {
+		if err := mirrorRow(ctx, layout, shadow, key); err != nil {
+			lastErr = err
+			continue
+		}
+		delete(set.rows, k)
+	}
+	if lastErr != nil {
+		return len(set.rows), basic.NewDBFailed(lastErr)
+	}
+	return 0, nil
+}
+
+// ClearDirtyRows 清空未同步的行，放弃迁移时使用
+func ClearDirtyRows(layouts *basic.LayoutManager) {
+	set := getDirtySet(layouts)
+	set.mu.Lock()
+	set.rows = make(map[string]rowKey)
+	set.mu.Unlock()
+}
@@ -0,0 +1,59 @@
+package dao
+
+import (
+	"context"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// maxOutboxErrorLen 保存的投递失败原因的最大长度，与事件表last_error列的长度一致
+const maxOutboxErrorLen = 1000
+
+// Publisher 事件投递方，返回nil表示下游已接收，返回错误时事件保留在待投递中由下一轮重试
+type Publisher interface {
+	Publish(ctx context.Context, event *model.OutboxEvent) error
+}
+
+type outboxTransfer struct {
+	transferId    int64
+	transferScene basic.TransferScene
+}
+
+// RelayOutbox 将待投递的事件依次交给publisher，投递成功后标记为已投递
+// 同一转移的事件按写入顺序投递，某个事件投递失败时该转移后续的事件推迟到下一轮
+func (l *Ledger) RelayOutbox(ctx context.Context, publisher Publisher, batchSize int) (*model.RelayReport, error) {
+	report := &model.RelayReport{}
+	blocked := make(map[outboxTransfer]bool)
+	err := l.store.EachPendingOutboxEvent(ctx, batchSize, func(ctx context.Context, store Store, events []*model.OutboxEvent) error {
+		for _, event := range events {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			transfer := outboxTransfer{event.TransferId, event.TransferScene}
+			if blocked[transfer] {
+				report.Deferred++
+				continue
+			}
+			if err := publisher.Publish(ctx, event); err != nil {
+				blocked[transfer] = true
+				report.Failed++
+				errMsg := err.Error()
+				if len(errMsg) > maxOutboxErrorLen {
+					errMsg = errMsg[:maxOutboxErrorLen]
+				}
+				if err = store.MarkOutboxEventFailed(ctx, event, errMsg); err != nil {
+					return err
+				}
+				continue
+			}
+			//已投递但标记失败时下一轮会重复投递，下游需按(转移ID, 转移场景, 变更后状态)去重
+			if err := store.MarkOutboxEventPublished(ctx, event); err != nil {
+				return err
+			}
+			report.Published++
+		}
+		return nil
+	})
+	return report, err
+}
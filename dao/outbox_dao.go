@@ -0,0 +1,141 @@
+package dao
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// createOutboxEvent 写入状态变更事件，需与状态变更在同一事务内调用，同一转移的同一状态已有事件时不写入
+func (s *gormStore) createOutboxEvent(ctx context.Context, event *model.OutboxEvent) error {
+	return s.scope(ctx, func(s *gormStore) error {
+		res := s.outboxTable(ctx, event.TransferId).Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+		if res.Error != nil {
+			return basic.NewDBFailed(res.Error)
+		}
+		if res.RowsAffected != 0 {
+			s.touch(outboxKey(event.TransferId, event.TransferScene, event.ToStatus))
+		}
+		return nil
+	})
+}
+
+// EachPendingOutboxEvent 依次遍历每个状态库上的全部事件分表，按(创建时间, 主键)分批读取待投递的事件
+// 同一转移的事件在同一张表内，重新分片时复制的行会重新生成主键，按创建时间排序保持写入顺序
+func (s *gormStore) EachPendingOutboxEvent(ctx context.Context, batchSize int, fn func(ctx context.Context, store Store, events []*model.OutboxEvent) error) error {
+	return s.scope(ctx, func(s *gormStore) error {
+		for i := int64(0); i < s.layout.GetStateDBNum(); i++ {
+			for _, table := range basic.GetPrefixedSplitTables(s.layout.GetTablePrefix(), basic.OutboxTableSpec, s.layout.GetStateTableSplitNum()) {
+				var cursorTime, cursor int64
+				for {
+					var events []*model.OutboxEvent
+					err := s.layout.GetStateDB(i).Clauses(dbresolver.Write).WithContext(ctx).Table(table.Name).
+						Where("status = ? and (created_at > ? or (created_at = ? and id > ?))", basic.OutboxStatusPending, cursorTime, cursorTime, cursor).
+						Order("created_at, id").Limit(batchSize).Find(&events).Error
+					if err != nil {
+						return basic.NewDBFailed(err)
+					}
+					if len(events) == 0 {
+						break
+					}
+					if err = fn(ctx, s, events); err != nil {
+						return err
+					}
+					if len(events) < batchSize {
+						break
+					}
+					cursorTime, cursor = events[len(events)-1].CreatedAt, events[len(events)-1].ID
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *gormStore) MarkOutboxEventPublished(ctx context.Context, event *model.OutboxEvent) error {
+	return s.updateOutboxEvent(ctx, event, map[string]interface{}{
+		"status": basic.OutboxStatusPublished,
+	})
+}
+
+func (s *gormStore) MarkOutboxEventFailed(ctx context.Context, event *model.OutboxEvent, errMsg string) error {
+	return s.updateOutboxEvent(ctx, event, map[string]interface{}{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": errMsg,
+	})
+}
+
+// updateOutboxEvent 按唯一键更新待投递的事件，重新分片期间主键在各布局中不一致
+func (s *gormStore) updateOutboxEvent(ctx context.Context, event *model.OutboxEvent, updates map[string]interface{}) error {
+	return s.scope(ctx, func(s *gormStore) error {
+		res := s.outboxTable(ctx, event.TransferId).
+			Where("transfer_id = ? and transfer_scene = ? and to_status = ? and status = ?", event.TransferId, event.TransferScene, event.ToStatus, basic.OutboxStatusPending).
+			Updates(updates)
+		if res.Error != nil {
+			return basic.NewDBFailed(res.Error)
+		}
+		if res.RowsAffected != 0 {
+			s.touch(outboxKey(event.TransferId, event.TransferScene, event.ToStatus))
+		}
+		return nil
+	})
+}
+
+// PurgeOutboxEvents 删除全部事件表中过期的已投递事件
+// 重新分片期间按主键分批删除，删除的行同步到影子布局
+func (s *gormStore) PurgeOutboxEvents(ctx context.Context, before int64) (int64, error) {
+	var purged int64
+	err := s.scope(ctx, func(s *gormStore) error {
+		for i := int64(0); i < s.layout.GetStateDBNum(); i++ {
+			for _, table := range basic.GetPrefixedSplitTables(s.layout.GetTablePrefix(), basic.OutboxTableSpec, s.layout.GetStateTableSplitNum()) {
+				db := s.layout.GetStateDB(i).Clauses(dbresolver.Write).WithContext(ctx).Table(table.Name)
+				if s.shadow == nil {
+					res := db.Where("status = ? and updated_at < ?", basic.OutboxStatusPublished, before).Delete(&model.OutboxEvent{})
+					if res.Error != nil {
+						return basic.NewDBFailed(res.Error)
+					}
+					purged += res.RowsAffected
+					continue
+				}
+				for {
+					var events []*model.OutboxEvent
+					err := db.Session(&gorm.Session{}).Where("status = ? and updated_at < ?", basic.OutboxStatusPublished, before).
+						Limit(purgeOutboxBatchSize).Find(&events).Error
+					if err != nil {
+						return basic.NewDBFailed(err)
+					}
+					if len(events) == 0 {
+						break
+					}
+					ids := make([]int64, 0, len(events))
+					for _, event := range events {
+						ids = append(ids, event.ID)
+						s.touch(outboxKey(event.TransferId, event.TransferScene, event.ToStatus))
+					}
+					res := db.Session(&gorm.Session{}).Where("id in ?", ids).Delete(&model.OutboxEvent{})
+					if res.Error != nil {
+						return basic.NewDBFailed(res.Error)
+					}
+					purged += res.RowsAffected
+				}
+			}
+		}
+		return nil
+	})
+	return purged, err
+}
+
+const purgeOutboxBatchSize = 500 //重新分片期间每批删除的事件数
+
+func (s *gormStore) outboxTable(ctx context.Context, transferId int64) *gorm.DB {
+	db := s.tx
+	if db == nil {
+		db = s.layout.GetStateWriteDB(ctx, transferId)
+	}
+	return db.Table(s.layout.GetOutboxTableName(transferId))
+}
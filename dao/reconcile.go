@@ -0,0 +1,83 @@
+package dao
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// Reconcile 零和对账，每次转移扣减与增加的数量相等，全部账户同一物品的数量之和应为0
+// 进行中的转移只执行了部分操作，其已生效的变动单独统计，扣除后仍不为0的才是真实差异
+// 汇总期间仍有转移时，扫描期间完成的转移可能造成暂时的差异，出现差异时可重新执行确认
+func (l *Ledger) Reconcile(ctx context.Context) (*model.ReconcileReport, error) {
+	report := &model.ReconcileReport{CheckedAt: time.Now().UnixMilli()}
+	accountTotals, err := l.store.SumAccountAmount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	recordTotals, err := l.store.SumRecordAmount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	states, err := l.store.GetNeedInspectionStateList(ctx, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	inFlight := make(map[basic.ItemType]int64)
+	for _, state := range states {
+		//空回滚的转移没有账户操作
+		if len(state.FromAccounts) == 0 && len(state.ToAccounts) == 0 {
+			continue
+		}
+		report.InFlight = append(report.InFlight, state)
+		for _, item := range state.FromAccounts {
+			if err = l.addInFlight(ctx, inFlight, state, item, basic.RecordTypeDeduct); err != nil {
+				return nil, err
+			}
+		}
+		for _, item := range state.ToAccounts {
+			if err = l.addInFlight(ctx, inFlight, state, item, basic.RecordTypeAdd); err != nil {
+				return nil, err
+			}
+		}
+	}
+	itemTypes := make(map[basic.ItemType]bool)
+	for _, totals := range []map[basic.ItemType]int64{accountTotals, recordTotals, inFlight} {
+		for itemType := range totals {
+			itemTypes[itemType] = true
+		}
+	}
+	for itemType := range itemTypes {
+		report.Items = append(report.Items, &model.ReconcileItem{
+			ItemType:     itemType,
+			AccountTotal: accountTotals[itemType],
+			RecordTotal:  recordTotals[itemType],
+			InFlight:     inFlight[itemType],
+			Discrepancy:  accountTotals[itemType] - inFlight[itemType],
+			Mismatch:     accountTotals[itemType] - recordTotals[itemType],
+		})
+	}
+	sort.Slice(report.Items, func(i, j int) bool {
+		return report.Items[i].ItemType < report.Items[j].ItemType
+	})
+	return report, nil
+}
+
+// addInFlight 累加进行中转移的单个账户操作已生效的变动，回滚后的记录正反抵消不计入
+func (l *Ledger) addInFlight(ctx context.Context, inFlight map[basic.ItemType]int64, state *model.State, item *model.TransferItem, transferType basic.TransferType) error {
+	record, err := l.store.GetRecord(ctx, item.AccountId, state.TransferId, item.ItemType, state.TransferScene, transferType, item.ChangeType)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return nil
+	}
+	if delta, ok := recordDelta(record); ok && record.TransferStatus == basic.RecordStatusNormal {
+		inFlight[item.ItemType] += delta
+	}
+	return nil
+}
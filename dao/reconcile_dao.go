@@ -0,0 +1,55 @@
+package dao
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/zjn-zjn/fisher/basic"
+)
+
+type itemTotal struct {
+	ItemType basic.ItemType
+	Total    int64
+}
+
+// SumAccountAmount 依次汇总每个库上全部账户分表的数量，读主库
+func (s *gormStore) SumAccountAmount(ctx context.Context) (map[basic.ItemType]int64, error) {
+	return s.sumTables(ctx, basic.AccountTableSpec, func(db *gorm.DB) *gorm.DB {
+		return db.Select("item_type, sum(amount) as total")
+	})
+}
+
+// SumRecordAmount 依次汇总每个库上全部记录分表中正常状态的增减记录，已回滚的记录正反抵消不计入，读主库
+func (s *gormStore) SumRecordAmount(ctx context.Context) (map[basic.ItemType]int64, error) {
+	return s.sumTables(ctx, basic.RecordTableSpec, func(db *gorm.DB) *gorm.DB {
+		return db.Select("item_type, sum(case when transfer_type = ? then amount else -amount end) as total", basic.RecordTypeAdd).
+			Where("transfer_status = ? and transfer_type in ?", basic.RecordStatusNormal, []basic.TransferType{basic.RecordTypeAdd, basic.RecordTypeDeduct})
+	})
+}
+
+func (s *gormStore) sumTables(ctx context.Context, spec *basic.TableSpec, query func(db *gorm.DB) *gorm.DB) (map[basic.ItemType]int64, error) {
+	totals := make(map[basic.ItemType]int64)
+	err := s.scope(ctx, func(s *gormStore) error {
+		num := s.layout.GetShardTableSplitNum(spec.Kind)
+		for i := int64(0); i < s.layout.GetDBNum(); i++ {
+			for _, table := range basic.GetPrefixedSplitTables(s.layout.GetTablePrefix(), spec, num) {
+				var rows []itemTotal
+				err := query(s.layout.GetDB(i).Clauses(dbresolver.Write).WithContext(ctx).Table(table.Name)).
+					Group("item_type").Scan(&rows).Error
+				if err != nil {
+					return basic.NewDBFailed(err)
+				}
+				for _, row := range rows {
+					totals[row.ItemType] += row.Total
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
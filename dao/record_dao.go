@@ -3,20 +3,26 @@ package dao
 import (
 	"context"
 	"errors"
+	"math"
+	"time"
 
 	"github.com/zjn-zjn/fisher/model"
 
 	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
 
 	"github.com/zjn-zjn/fisher/basic"
 )
 
 // GetRecord 获取转移记录
-func GetRecord(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, transferType basic.TransferType, changeType basic.ChangeType) (*model.Record, error) {
+func (s *gormStore) GetRecord(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, transferType basic.TransferType, changeType basic.ChangeType) (*model.Record, error) {
 	var records []model.Record
-	if err := basic.GetRecordAndAccountWriteDB(ctx, accountId).Table(model.GetRecordTableName(accountId)).
-		Where("account_id = ? and transfer_id = ? and  item_type = ? and transfer_scene = ? and transfer_type = ? and change_type = ?", accountId, transferId, itemType, transferScene, transferType, changeType).
-		Find(&records).Error; err != nil {
+	err := s.scope(ctx, func(s *gormStore) error {
+		return s.recordTable(ctx, accountId, false).
+			Where("account_id = ? and transfer_id = ? and  item_type = ? and transfer_scene = ? and transfer_type = ? and change_type = ?", accountId, transferId, itemType, transferScene, transferType, changeType).
+			Find(&records).Error
+	})
+	if err != nil {
 		return nil, basic.NewDBFailed(err)
 	}
 	if len(records) == 0 {
@@ -26,52 +32,213 @@ func GetRecord(ctx context.Context, accountId, transferId int64, itemType basic.
 }
 
 // UpdateRecord 更新转移记录
-func UpdateRecord(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, transferType basic.TransferType, transferStatus, originTransferStatus basic.RecordStatus, changeType basic.ChangeType, db *gorm.DB) (bool, error) {
-	if db == nil {
-		db = basic.GetRecordAndAccountWriteDB(ctx, accountId)
-	}
-	result := db.Table(model.GetRecordTableName(accountId)).
-		Where("account_id = ? and transfer_id = ? and  item_type = ? and transfer_scene = ? and transfer_type = ? and transfer_status = ? and change_type = ?", accountId, transferId, itemType, transferScene, transferType, originTransferStatus, changeType).
-		Update("transfer_status", transferStatus)
-	if err := result.Error; err != nil {
-		return false, basic.NewDBFailed(err)
-	}
-	if result.RowsAffected == 0 {
-		return false, nil
-	}
-	return true, nil
+func (s *gormStore) UpdateRecord(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, transferType basic.TransferType, transferStatus, originTransferStatus basic.RecordStatus, changeType basic.ChangeType) (bool, error) {
+	var updated bool
+	err := s.scope(ctx, func(s *gormStore) error {
+		db := s.recordTable(ctx, accountId, false).
+			Where("account_id = ? and transfer_id = ? and  item_type = ? and transfer_scene = ? and transfer_type = ? and transfer_status = ? and change_type = ?", accountId, transferId, itemType, transferScene, transferType, originTransferStatus, changeType)
+		if originTransferStatus == basic.RecordStatusNormal && transferStatus == basic.RecordStatusRollback {
+			//已有退款的记录不能回滚，与退款累加已退款金额在同一行上互斥
+			db = db.Where("refunded_amount = 0")
+		}
+		//更新时间即回滚时间，按时间点查询数量时使用
+		result := db.Updates(map[string]interface{}{"transfer_status": transferStatus, "updated_at": time.Now().UnixMilli()})
+		if err := result.Error; err != nil {
+			return basic.NewDBFailed(err)
+		}
+		updated = result.RowsAffected != 0
+		if updated {
+			s.touch(recordKey(accountId, transferId, itemType, transferScene, transferType, changeType))
+		}
+		return nil
+	})
+	return updated, err
 }
 
-func CreateRecord(ctx context.Context, record *model.Record, db *gorm.DB) error {
-	if db == nil {
-		db = basic.GetRecordAndAccountWriteDB(ctx, record.AccountId)
-	}
-	if err := db.Table(model.GetRecordTableName(record.AccountId)).Create(record).Error; err != nil {
-		return basic.NewDBFailed(err)
+func (s *gormStore) CreateRecord(ctx context.Context, record *model.Record) error {
+	return s.scope(ctx, func(s *gormStore) error {
+		if err := s.recordTable(ctx, record.AccountId, false).Create(record).Error; err != nil {
+			return basic.NewDBFailed(err)
+		}
+		s.touch(recordKey(record.AccountId, record.TransferId, record.ItemType, record.TransferScene, record.TransferType, record.ChangeType))
+		return nil
+	})
+}
+
+func (s *gormStore) GetAccountLastRecord(ctx context.Context, accountId int64, itemType *basic.ItemType, transferScene *basic.TransferScene, transferType *basic.TransferType, readOnly bool) (*model.Record, error) {
+	var record *model.Record
+	err := s.scope(ctx, func(s *gormStore) error {
+		for _, db := range s.readTables(readOnly, func(s *gormStore) *gorm.DB { return s.recordTable(ctx, accountId, readOnly) }) {
+			db = db.Where("account_id = ?", accountId)
+			if itemType != nil {
+				db = db.Where("item_type = ?", *itemType)
+			}
+			if transferScene != nil {
+				db = db.Where("transfer_scene = ?", *transferScene)
+			}
+			if transferType != nil {
+				db = db.Where("transfer_type = ?", *transferType)
+			}
+			var last model.Record
+			//重新分片时复制的行会重新生成主键，按创建时间排序，主键只用于同一时间的先后
+			if err := db.Where(`transfer_status = ?`, basic.RecordStatusNormal).Order("created_at desc, id desc").First(&last).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					continue
+				}
+				return err
+			}
+			record = &last
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return record, nil
 }
 
-func GetAccountLastRecord(ctx context.Context, accountId int64, itemType *basic.ItemType, transferScene *basic.TransferScene, transferType *basic.TransferType, db *gorm.DB) (*model.Record, error) {
-	if db == nil {
-		db = basic.GetRecordAndAccountReadDB(ctx, accountId)
+// ListAccountRecords 在账户所在的记录表上按(创建时间, ID)分页，游标为上一页最后一条记录的ID
+// 各布局的ID相互独立，游标不能跨布局使用，迁移期间只查询当前布局，当前布局的数据始终完整
+func (s *gormStore) ListAccountRecords(ctx context.Context, req *model.ListRecordReq, limit int) ([]*model.Record, error) {
+	var records []*model.Record
+	err := s.scope(ctx, func(s *gormStore) error {
+		db := s.recordTable(ctx, req.AccountId, true).Where("account_id = ?", req.AccountId)
+		if req.ItemType != nil {
+			db = db.Where("item_type = ?", *req.ItemType)
+		}
+		if req.TransferScene != nil {
+			db = db.Where("transfer_scene = ?", *req.TransferScene)
+		}
+		if req.ChangeType != nil {
+			db = db.Where("change_type = ?", *req.ChangeType)
+		}
+		if req.TransferType != nil {
+			db = db.Where("transfer_type = ?", *req.TransferType)
+		}
+		if req.TransferStatus != nil {
+			db = db.Where("transfer_status = ?", *req.TransferStatus)
+		}
+		if req.HideRolledBack {
+			db = db.Where("transfer_status not in ?", []basic.RecordStatus{basic.RecordStatusRollback, basic.RecordStatusEmptyRollback})
+		}
+		if req.StartTime > 0 {
+			db = db.Where("created_at >= ?", req.StartTime)
+		}
+		if req.EndTime > 0 {
+			db = db.Where("created_at < ?", req.EndTime)
+		}
+		if req.Cursor > 0 {
+			//重新分片时复制的行会重新生成主键，主键顺序不再是创建顺序，按游标记录的创建时间定位
+			var cursor model.Record
+			if err := db.Session(&gorm.Session{}).Select("created_at").Where("id = ?", req.Cursor).Take(&cursor).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil
+				}
+				return basic.NewDBFailed(err)
+			}
+			if req.Asc {
+				db = db.Where("(created_at > ? or (created_at = ? and id > ?))", cursor.CreatedAt, cursor.CreatedAt, req.Cursor)
+			} else {
+				db = db.Where("(created_at < ? or (created_at = ? and id < ?))", cursor.CreatedAt, cursor.CreatedAt, req.Cursor)
+			}
+		}
+		if req.Asc {
+			db = db.Order("created_at asc, id asc")
+		} else {
+			db = db.Order("created_at desc, id desc")
+		}
+		if err := db.Limit(limit).Find(&records).Error; err != nil {
+			return basic.NewDBFailed(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	var record model.Record
-	db = db.Table(model.GetRecordTableName(accountId)).Where("account_id = ?", accountId)
-	if itemType != nil {
-		db = db.Where("item_type = ?", *itemType)
+	return records, nil
+}
+
+// UpdateRecordBalance 记录操作或回滚后的账户数量和数量变更序号
+func (s *gormStore) UpdateRecordBalance(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, transferType basic.TransferType, changeType basic.ChangeType, rollback bool, account *model.Account) error {
+	columns := map[string]interface{}{"balance_after": account.Amount, "sequence": account.Sequence}
+	if rollback {
+		columns = map[string]interface{}{"rollback_balance_after": account.Amount, "rollback_sequence": account.Sequence}
 	}
-	if transferScene != nil {
-		db = db.Where("transfer_scene = ?", *transferScene)
+	return s.scope(ctx, func(s *gormStore) error {
+		err := s.recordTable(ctx, accountId, false).
+			Where("account_id = ? and transfer_id = ? and  item_type = ? and transfer_scene = ? and transfer_type = ? and change_type = ?", accountId, transferId, itemType, transferScene, transferType, changeType).
+			UpdateColumns(columns).Error
+		if err != nil {
+			return basic.NewDBFailed(err)
+		}
+		s.touch(recordKey(accountId, transferId, itemType, transferScene, transferType, changeType))
+		return nil
+	})
+}
+
+// GetAccountRecordsBetween 获取账户在时间范围内有数量变更的增减记录，读主库
+func (s *gormStore) GetAccountRecordsBetween(ctx context.Context, accountId int64, itemType basic.ItemType, after, until int64) ([]*model.Record, error) {
+	var records []*model.Record
+	if until <= 0 {
+		until = math.MaxInt64
 	}
-	if transferType != nil {
-		db = db.Where("transfer_type = ?", *transferType)
+	err := s.scope(ctx, func(s *gormStore) error {
+		err := s.recordTable(ctx, accountId, false).
+			Where("account_id = ? and item_type = ? and transfer_type in ?", accountId, itemType, []basic.TransferType{basic.RecordTypeAdd, basic.RecordTypeDeduct}).
+			Where("(created_at > ? and created_at <= ?) or (transfer_status = ? and updated_at > ? and updated_at <= ?)", after, until, basic.RecordStatusRollback, after, until).
+			Find(&records).Error
+		if err != nil {
+			return basic.NewDBFailed(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	if err := db.Where(`transfer_status = ?`, basic.RecordStatusNormal).Order("id desc").First(&record).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, nil
+	return records, nil
+}
+
+// GetExpiredFreezeRecordList 获取截止now已过期且仍在冻结中的冻结记录，遍历全部记录表
+func (s *gormStore) GetExpiredFreezeRecordList(ctx context.Context, now int64) ([]*model.Record, error) {
+	var records []*model.Record
+	err := s.scope(ctx, func(s *gormStore) error {
+		for i := int64(0); i < s.layout.GetDBNum(); i++ {
+			for _, table := range basic.GetPrefixedSplitTables(s.layout.GetTablePrefix(), basic.RecordTableSpec, s.layout.GetRecordTableSplitNum()) {
+				var recordsTmp []*model.Record
+				err := s.layout.GetDB(i).Clauses(dbresolver.Write).WithContext(ctx).Table(table.Name).
+					Where("transfer_type = ? and transfer_status = ? and expire_at > 0 and expire_at <= ?", basic.RecordTypeFreeze, basic.RecordStatusNormal, now).
+					Find(&recordsTmp).Error
+				if err != nil {
+					return basic.NewDBFailed(err)
+				}
+				records = append(records, recordsTmp...)
+			}
 		}
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
-	return &record, nil
+	return records, nil
+}
+
+// UpdateRecordRefundedAmount 条件更新已退款金额，保证累计退款不超过转移金额
+func (s *gormStore) UpdateRecordRefundedAmount(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, transferType basic.TransferType, changeType basic.ChangeType, delta int64) (bool, error) {
+	var updated bool
+	err := s.scope(ctx, func(s *gormStore) error {
+		result := s.recordTable(ctx, accountId, false).
+			Where("account_id = ? and transfer_id = ? and  item_type = ? and transfer_scene = ? and transfer_type = ? and transfer_status = ? and change_type = ?", accountId, transferId, itemType, transferScene, transferType, basic.RecordStatusNormal, changeType).
+			Where("refunded_amount + ? >= 0 and refunded_amount + ? <= amount", delta, delta).
+			UpdateColumn("refunded_amount", gorm.Expr("refunded_amount + ?", delta))
+		if err := result.Error; err != nil {
+			return basic.NewDBFailed(err)
+		}
+		updated = result.RowsAffected != 0
+		if updated {
+			s.touch(recordKey(accountId, transferId, itemType, transferScene, transferType, changeType))
+		}
+		return nil
+	})
+	return updated, err
 }
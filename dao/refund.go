@@ -0,0 +1,49 @@
+package dao
+
+import (
+	"context"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+//==============================================================================
+// 退款case
+// A 100 转给 B 90 C 10，之后退款30
+//
+// 退款是一次以退款ID为转移ID的反向转移，与原转移在同一账户上的记录同时更新已退款金额
+// B -27(Normal&Deduct) 原记录B+90已退款+27   C -3(Normal&Deduct) 原记录C+10已退款+3   A +30(Normal&Add) 原记录A-100已退款+30
+// 退款回滚时已退款金额同时减少，已退款金额超过原记录金额时退款失败
+//==============================================================================
+
+// RefundDeductionAccount 退款中扣回原转移收款方的物品，同时累加原记录的已退款金额
+func (l *Ledger) RefundDeductionAccount(ctx context.Context, origin *model.RefundOf, accountId, transferId, amount int64, itemType basic.ItemType, transferScene basic.TransferScene, transferStatus basic.RecordStatus, changeType basic.ChangeType, comment string) error {
+	return l.deductionAccount(ctx, accountId, transferId, amount, itemType, transferScene, transferStatus, changeType, comment, refundChange(origin, accountId, amount, itemType, changeType))
+}
+
+// RefundIncreaseAccount 退款中退还原转移付款方的物品，同时累加原记录的已退款金额
+func (l *Ledger) RefundIncreaseAccount(ctx context.Context, origin *model.RefundOf, accountId, transferId, amount int64, itemType basic.ItemType, transferScene basic.TransferScene, transferStatus basic.RecordStatus, changeType basic.ChangeType, comment string) error {
+	return l.increaseAccount(ctx, accountId, transferId, amount, itemType, transferScene, transferStatus, changeType, comment, refundChange(origin, accountId, amount, itemType, changeType))
+}
+
+// refundChange 正常操作时累加原记录的已退款金额，回滚时扣除
+func refundChange(origin *model.RefundOf, accountId, amount int64, itemType basic.ItemType, changeType basic.ChangeType) onChange {
+	return func(ctx context.Context, tx Store, transferStatus basic.RecordStatus) error {
+		delta := amount
+		if transferStatus != basic.RecordStatusNormal {
+			delta = -amount
+		}
+		affect, err := tx.UpdateRecordRefundedAmount(ctx, accountId, origin.TransferId, itemType, origin.TransferScene, origin.TransferType, changeType, delta)
+		if err != nil {
+			return err
+		}
+		if affect {
+			return nil
+		}
+		if delta > 0 {
+			return basic.RefundExceededErr
+		}
+		//回滚的退款一定累加过，理论上不会发生
+		return basic.StateMutationErr
+	}
+}
@@ -0,0 +1,118 @@
+package dao
+
+import (
+	"context"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// ReplayAccounts 按记录回放重建每个账户物品的数量和冻结数量，与当前账户对比，apply为true时修正不一致的账户
+// 先遍历记录表中出现的账户物品，包括账户行已丢失的，再遍历账户表中没有任何记录的账户，其数量应为0
+func (l *Ledger) ReplayAccounts(ctx context.Context, apply bool, batchSize int) (*model.ReplayReport, error) {
+	report := &model.ReplayReport{Applied: apply}
+	err := l.store.EachRecordAccount(ctx, batchSize, func(ctx context.Context, store Store, totals []*model.RecordTotal) error {
+		for _, total := range totals {
+			if err := replayAccount(ctx, store, report, total.AccountId, total.ItemType, apply); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = l.store.EachAccount(ctx, batchSize, func(ctx context.Context, store Store, accounts []*model.Account) error {
+		for _, account := range accounts {
+			total, err := store.GetAccountRecordTotal(ctx, account.AccountId, account.ItemType)
+			if err != nil {
+				return err
+			}
+			if total.Records != 0 {
+				//已在遍历记录表时检查
+				continue
+			}
+			if err = replayAccount(ctx, store, report, account.AccountId, account.ItemType, apply); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// replayAccount 对比单个账户物品与记录回放的结果
+// 修正时在账户所在实例的本地事务内先锁定账户再回放，并发的转移要么已提交被回放到，要么等待修正后在其基础上变更
+func replayAccount(ctx context.Context, store Store, report *model.ReplayReport, accountId int64, itemType basic.ItemType, apply bool) error {
+	report.Checked++
+	if !apply {
+		account, err := store.GetAccount(ctx, accountId, itemType, false)
+		if err != nil {
+			return err
+		}
+		total, err := store.GetAccountRecordTotal(ctx, accountId, itemType)
+		if err != nil {
+			return err
+		}
+		if diff := diffAccount(account, total); diff != nil {
+			report.Diffs = append(report.Diffs, diff)
+		}
+		return nil
+	}
+	return store.RecordAndAccountInstanceTX(ctx, accountId, func(ctx context.Context, tx Store) error {
+		origin, err := tx.GetAccount(ctx, accountId, itemType, false)
+		if err != nil {
+			return err
+		}
+		account, err := tx.LockAccount(ctx, accountId, itemType)
+		if err != nil {
+			return err
+		}
+		total, err := tx.GetAccountRecordTotal(ctx, accountId, itemType)
+		if err != nil {
+			return err
+		}
+		diff := diffAccount(account, total)
+		if diff == nil && origin != nil {
+			return nil
+		}
+		if diff == nil {
+			//账户行丢失且回放数量为0，创建即已修正
+			diff = &model.AccountDiff{AccountId: accountId, ItemType: itemType, ReplaySequence: total.Sequence, LiveSequence: account.Sequence}
+		}
+		diff.Missing = origin == nil
+		sequence := account.Sequence
+		if total.Sequence > sequence {
+			sequence = total.Sequence
+		}
+		if err = tx.SetAccountAmount(ctx, accountId, itemType, total.Amount, total.Frozen, sequence); err != nil {
+			return err
+		}
+		report.Diffs = append(report.Diffs, diff)
+		return nil
+	})
+}
+
+// diffAccount 账户数量或冻结数量与回放结果不同，或数量变更序号落后于记录时返回差异，account为nil表示账户行不存在
+func diffAccount(account *model.Account, total *model.RecordTotal) *model.AccountDiff {
+	diff := &model.AccountDiff{
+		AccountId:      total.AccountId,
+		ItemType:       total.ItemType,
+		Missing:        account == nil,
+		ReplayAmount:   total.Amount,
+		ReplayFrozen:   total.Frozen,
+		ReplaySequence: total.Sequence,
+	}
+	if account != nil {
+		diff.LiveAmount = account.Amount
+		diff.LiveFrozen = account.FrozenAmount
+		diff.LiveSequence = account.Sequence
+	}
+	if !diff.Missing && diff.LiveAmount == diff.ReplayAmount && diff.LiveFrozen == diff.ReplayFrozen && diff.LiveSequence >= diff.ReplaySequence {
+		return nil
+	}
+	return diff
+}
@@ -0,0 +1,110 @@
+package dao
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// recordTotalColumns 按账户物品回放记录，与DeductionAccount、IncreaseAccount一致，只有正常状态的增减记录生效
+// 冻结数量为冻结中(正常状态)的冻结记录之和，已扣款的冻结已转为扣减记录
+const recordTotalColumns = "account_id, item_type, count(*) as records, " +
+	"sum(case when transfer_status = ? and transfer_type = ? then amount when transfer_status = ? and transfer_type = ? then -amount else 0 end) as amount, " +
+	"sum(case when transfer_status = ? and transfer_type = ? then amount else 0 end) as frozen, " +
+	"max(case when rollback_sequence > sequence then rollback_sequence else sequence end) as sequence"
+
+func selectRecordTotal(db *gorm.DB) *gorm.DB {
+	return db.Select(recordTotalColumns, basic.RecordStatusNormal, basic.RecordTypeAdd, basic.RecordStatusNormal, basic.RecordTypeDeduct,
+		basic.RecordStatusNormal, basic.RecordTypeFreeze).
+		Group("account_id, item_type")
+}
+
+func (s *gormStore) GetAccountRecordTotal(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.RecordTotal, error) {
+	total := &model.RecordTotal{AccountId: accountId, ItemType: itemType}
+	err := s.scope(ctx, func(s *gormStore) error {
+		var totals []*model.RecordTotal
+		err := selectRecordTotal(s.recordTable(ctx, accountId, false).Where("account_id = ? and item_type = ?", accountId, itemType)).
+			Scan(&totals).Error
+		if err != nil {
+			return basic.NewDBFailed(err)
+		}
+		if len(totals) != 0 {
+			total = totals[0]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return total, nil
+}
+
+// EachRecordAccount 依次遍历每个库上的全部记录分表，按(账户ID, 物品类型)分组后分批读取
+// 遍历期间持有当前布局，fn内通过入参store的操作使用同一布局
+func (s *gormStore) EachRecordAccount(ctx context.Context, batchSize int, fn func(ctx context.Context, store Store, totals []*model.RecordTotal) error) error {
+	return s.scope(ctx, func(s *gormStore) error {
+		for i := int64(0); i < s.layout.GetDBNum(); i++ {
+			for _, table := range basic.GetPrefixedSplitTables(s.layout.GetTablePrefix(), basic.RecordTableSpec, s.layout.GetRecordTableSplitNum()) {
+				var cursor *model.RecordTotal
+				for {
+					db := s.layout.GetDB(i).Clauses(dbresolver.Write).WithContext(ctx).Table(table.Name)
+					if cursor != nil {
+						db = db.Where("account_id > ? or (account_id = ? and item_type > ?)", cursor.AccountId, cursor.AccountId, cursor.ItemType)
+					}
+					var totals []*model.RecordTotal
+					if err := selectRecordTotal(db).Order("account_id, item_type").Limit(batchSize).Scan(&totals).Error; err != nil {
+						return basic.NewDBFailed(err)
+					}
+					if len(totals) == 0 {
+						break
+					}
+					if err := fn(ctx, s, totals); err != nil {
+						return err
+					}
+					if len(totals) < batchSize {
+						break
+					}
+					cursor = totals[len(totals)-1]
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// LockAccount 通过不改变数据的更新锁定账户行，MySQL和PostgreSQL为行锁，SQLite为库写锁
+func (s *gormStore) LockAccount(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.Account, error) {
+	var account *model.Account
+	err := s.scope(ctx, func(s *gormStore) error {
+		if _, err := s.getOrCreateAccount(ctx, accountId, itemType); err != nil {
+			return err
+		}
+		//未改变数据时MySQL的影响行数为0，不能据此判断
+		err := s.accountTable(ctx, accountId, false).
+			Where("account_id = ? and item_type = ?", accountId, itemType).
+			UpdateColumn("sequence", gorm.Expr("sequence")).Error
+		if err != nil {
+			return basic.NewDBFailed(err)
+		}
+		account, err = s.getChangedAccount(ctx, accountId, itemType)
+		return err
+	})
+	return account, err
+}
+
+func (s *gormStore) SetAccountAmount(ctx context.Context, accountId int64, itemType basic.ItemType, amount, frozenAmount, sequence int64) error {
+	return s.scope(ctx, func(s *gormStore) error {
+		res := s.accountTable(ctx, accountId, false).
+			Where("account_id = ? and item_type = ?", accountId, itemType).
+			UpdateColumns(map[string]interface{}{"amount": amount, "frozen_amount": frozenAmount, "sequence": sequence})
+		if res.Error != nil {
+			return basic.NewDBFailed(res.Error)
+		}
+		s.touch(accountKey(accountId, itemType))
+		return nil
+	})
+}
@@ -0,0 +1,303 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// ReshardResult 单张表的迁移结果
+type ReshardResult struct {
+	DB         int64    //源布局中该类数据的库下标，Target为true时为目标布局中的
+	Table      string   //源布局中的表名，Target为true时为目标布局中的
+	Target     bool     //是否为目标布局中多出的行的校验
+	Copied     int64    //复制的行数
+	Checked    int64    //校验的行数
+	Mismatched int64    //目标布局中缺失或不一致的行数
+	Repaired   int64    //已修复的行数
+	Purged     int64    //清理的行数
+	Mismatches []string //不一致的行，最多保留maxMismatches条
+}
+
+const maxMismatches = 100
+
+func routeIdOf(row interface{}) int64 {
+	switch r := row.(type) {
+	case *model.State:
+		return r.TransferId
+	case *model.Record:
+		return r.AccountId
+	case *model.Account:
+		return r.AccountId
+	case *model.AccountSnapshot:
+		return r.AccountId
+	case *model.RecordChain:
+		return r.AccountId
+	case *model.OutboxEvent:
+		return r.TransferId
+	}
+	return 0
+}
+
+func keyOf(row interface{}) rowKey {
+	switch r := row.(type) {
+	case *model.State:
+		return stateKey(r.TransferId, r.TransferScene)
+	case *model.Record:
+		return recordKey(r.AccountId, r.TransferId, r.ItemType, r.TransferScene, r.TransferType, r.ChangeType)
+	case *model.AccountSnapshot:
+		return snapshotKey(r.AccountId, r.ItemType, r.CutOff)
+	case *model.RecordChain:
+		return recordChainKey(r.AccountId, r.ItemType, r.ChainSeq)
+	case *model.OutboxEvent:
+		return outboxKey(r.TransferId, r.TransferScene, r.ToStatus)
+	}
+	r := row.(*model.Account)
+	return accountKey(r.AccountId, r.ItemType)
+}
+
+// CopyTable 将from布局中该类数据下标为dbIdx的库上的表按主键分批复制到to布局，已存在的行会被覆盖，可重复执行
+func CopyTable(ctx context.Context, from, to *basic.Layout, dbIdx int64, table *basic.Table, batchSize int) (*ReshardResult, error) {
+	switch table.Spec {
+	case basic.StateTableSpec:
+		return copyTable[model.State](ctx, from, to, dbIdx, table, batchSize)
+	case basic.RecordTableSpec:
+		return copyTable[model.Record](ctx, from, to, dbIdx, table, batchSize)
+	case basic.RecordChainTableSpec:
+		return copyTable[model.RecordChain](ctx, from, to, dbIdx, table, batchSize)
+	case basic.AccountSnapshotTableSpec:
+		return copyTable[model.AccountSnapshot](ctx, from, to, dbIdx, table, batchSize)
+	case basic.OutboxTableSpec:
+		return copyTable[model.OutboxEvent](ctx, from, to, dbIdx, table, batchSize)
+	}
+	return copyTable[model.Account](ctx, from, to, dbIdx, table, batchSize)
+}
+
+func copyTable[T any](ctx context.Context, from, to *basic.Layout, dbIdx int64, table *basic.Table, batchSize int) (*ReshardResult, error) {
+	result := &ReshardResult{DB: dbIdx, Table: table.Name}
+	srcDB := from.GetShardDB(table.Spec.Kind, dbIdx)
+	var cursor int64
+	for {
+		var rows []T
+		err := srcDB.Clauses(dbresolver.Write).WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			//加锁读取，与双写的同步互斥，避免旧数据覆盖新数据
+			if err := lockRows(tx).Table(table.Name).Where("id > ?", cursor).Order("id").Limit(batchSize).Find(&rows).Error; err != nil {
+				return err
+			}
+			groups := make(map[int64]map[string][]T)
+			for i := range rows {
+				dstIdx, dstTable := location(to, table.Spec, routeIdOf(&rows[i]))
+				if to.GetShardDB(table.Spec.Kind, dstIdx) == srcDB && dstTable == table.Name {
+					continue
+				}
+				if groups[dstIdx] == nil {
+					groups[dstIdx] = make(map[string][]T)
+				}
+				groups[dstIdx][dstTable] = append(groups[dstIdx][dstTable], rows[i])
+			}
+			for dstIdx, tables := range groups {
+				dst := to.GetShardDB(table.Spec.Kind, dstIdx).Clauses(dbresolver.Write).WithContext(ctx)
+				if to.GetShardDB(table.Spec.Kind, dstIdx) == srcDB {
+					dst = tx
+				}
+				for dstTable, dstRows := range tables {
+					//写入会回填主键，使用副本避免影响游标
+					batch := append([]T(nil), dstRows...)
+					if err := upsertRows(dst, dstTable, table.Spec, &batch); err != nil {
+						return err
+					}
+					result.Copied += int64(len(batch))
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return result, basic.NewDBFailed(err)
+		}
+		if len(rows) == 0 {
+			return result, nil
+		}
+		cursor = reflect.ValueOf(&rows[len(rows)-1]).Elem().FieldByName("ID").Int()
+		if len(rows) < batchSize {
+			return result, nil
+		}
+	}
+}
+
+// VerifyTable 校验from布局中该类数据下标为dbIdx的库上的表在to布局中是否存在且内容一致，repair为true时重新同步不一致的行
+func VerifyTable(ctx context.Context, from, to *basic.Layout, dbIdx int64, table *basic.Table, batchSize int, repair bool) (*ReshardResult, error) {
+	switch table.Spec {
+	case basic.StateTableSpec:
+		return verifyTable[model.State](ctx, from, to, dbIdx, table, batchSize, repair)
+	case basic.RecordTableSpec:
+		return verifyTable[model.Record](ctx, from, to, dbIdx, table, batchSize, repair)
+	case basic.RecordChainTableSpec:
+		return verifyTable[model.RecordChain](ctx, from, to, dbIdx, table, batchSize, repair)
+	case basic.AccountSnapshotTableSpec:
+		return verifyTable[model.AccountSnapshot](ctx, from, to, dbIdx, table, batchSize, repair)
+	case basic.OutboxTableSpec:
+		return verifyTable[model.OutboxEvent](ctx, from, to, dbIdx, table, batchSize, repair)
+	}
+	return verifyTable[model.Account](ctx, from, to, dbIdx, table, batchSize, repair)
+}
+
+func verifyTable[T any](ctx context.Context, from, to *basic.Layout, dbIdx int64, table *basic.Table, batchSize int, repair bool) (*ReshardResult, error) {
+	result := &ReshardResult{DB: dbIdx, Table: table.Name}
+	srcDB := from.GetShardDB(table.Spec.Kind, dbIdx).Clauses(dbresolver.Write).WithContext(ctx)
+	var cursor int64
+	for {
+		var rows []T
+		if err := srcDB.Table(table.Name).Where("id > ?", cursor).Order("id").Limit(batchSize).Find(&rows).Error; err != nil {
+			return result, basic.NewDBFailed(err)
+		}
+		for i := range rows {
+			row := &rows[i]
+			key := keyOf(row)
+			dstIdx, dstTable := location(to, table.Spec, key.routeId)
+			if to.GetShardDB(table.Spec.Kind, dstIdx) == from.GetShardDB(table.Spec.Kind, dbIdx) && dstTable == table.Name {
+				continue
+			}
+			result.Checked++
+			var dstRows []T
+			if err := to.GetShardDB(table.Spec.Kind, dstIdx).Clauses(dbresolver.Write).WithContext(ctx).Table(dstTable).Where(key.where).Find(&dstRows).Error; err != nil {
+				return result, basic.NewDBFailed(err)
+			}
+			if len(dstRows) != 0 && sameRow(row, &dstRows[0]) {
+				continue
+			}
+			result.Mismatched++
+			if len(result.Mismatches) < maxMismatches {
+				result.Mismatches = append(result.Mismatches, fmt.Sprintf("db %d table %s -> db %d table %s: %v", dbIdx, table.Name, dstIdx, dstTable, key.where))
+			}
+			if repair {
+				if err := mirrorRow(ctx, from, to, key); err != nil {
+					return result, basic.NewDBFailed(err)
+				}
+				result.Repaired++
+			}
+		}
+		if len(rows) < batchSize {
+			return result, nil
+		}
+		cursor = reflect.ValueOf(&rows[len(rows)-1]).Elem().FieldByName("ID").Int()
+	}
+}
+
+// VerifyTargetTable 校验to布局中该类数据下标为dbIdx的库上的表是否有from布局中不存在的行，repair为true时删除多出的行
+// 与VerifyTable一起保证两个布局一致，例如双写期间删除的行
+func VerifyTargetTable(ctx context.Context, from, to *basic.Layout, dbIdx int64, table *basic.Table, batchSize int, repair bool) (*ReshardResult, error) {
+	switch table.Spec {
+	case basic.StateTableSpec:
+		return verifyTargetTable[model.State](ctx, from, to, dbIdx, table, batchSize, repair)
+	case basic.RecordTableSpec:
+		return verifyTargetTable[model.Record](ctx, from, to, dbIdx, table, batchSize, repair)
+	case basic.RecordChainTableSpec:
+		return verifyTargetTable[model.RecordChain](ctx, from, to, dbIdx, table, batchSize, repair)
+	case basic.AccountSnapshotTableSpec:
+		return verifyTargetTable[model.AccountSnapshot](ctx, from, to, dbIdx, table, batchSize, repair)
+	case basic.OutboxTableSpec:
+		return verifyTargetTable[model.OutboxEvent](ctx, from, to, dbIdx, table, batchSize, repair)
+	}
+	return verifyTargetTable[model.Account](ctx, from, to, dbIdx, table, batchSize, repair)
+}
+
+func verifyTargetTable[T any](ctx context.Context, from, to *basic.Layout, dbIdx int64, table *basic.Table, batchSize int, repair bool) (*ReshardResult, error) {
+	result := &ReshardResult{DB: dbIdx, Table: table.Name, Target: true}
+	dstDB := to.GetShardDB(table.Spec.Kind, dbIdx).Clauses(dbresolver.Write).WithContext(ctx)
+	var cursor int64
+	for {
+		var rows []T
+		if err := dstDB.Table(table.Name).Where("id > ?", cursor).Order("id").Limit(batchSize).Find(&rows).Error; err != nil {
+			return result, basic.NewDBFailed(err)
+		}
+		for i := range rows {
+			key := keyOf(&rows[i])
+			srcIdx, srcTable := location(from, table.Spec, key.routeId)
+			if from.GetShardDB(table.Spec.Kind, srcIdx) == to.GetShardDB(table.Spec.Kind, dbIdx) && srcTable == table.Name {
+				continue
+			}
+			result.Checked++
+			var n int64
+			if err := from.GetShardDB(table.Spec.Kind, srcIdx).Clauses(dbresolver.Write).WithContext(ctx).Table(srcTable).Where(key.where).Count(&n).Error; err != nil {
+				return result, basic.NewDBFailed(err)
+			}
+			if n != 0 {
+				//内容不一致由VerifyTable校验
+				continue
+			}
+			result.Mismatched++
+			if len(result.Mismatches) < maxMismatches {
+				result.Mismatches = append(result.Mismatches, fmt.Sprintf("db %d table %s: %v not in db %d table %s", dbIdx, table.Name, key.where, srcIdx, srcTable))
+			}
+			if repair {
+				//源行不存在时同步即删除
+				if err := mirrorRow(ctx, from, to, key); err != nil {
+					return result, basic.NewDBFailed(err)
+				}
+				result.Repaired++
+			}
+		}
+		if len(rows) < batchSize {
+			return result, nil
+		}
+		cursor = reflect.ValueOf(&rows[len(rows)-1]).Elem().FieldByName("ID").Int()
+	}
+}
+
+// sameRow 比较除主键外的全部字段，主键在各布局中独立生成
+func sameRow(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	for i := 0; i < va.NumField(); i++ {
+		if va.Type().Field(i).Name == "ID" {
+			continue
+		}
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			return false
+		}
+	}
+	return true
+}
+
+// PurgeTable 删除from布局中库dbIdx上已迁移到to布局其他位置的行，需在切换到to布局且停止双写后执行
+func PurgeTable(ctx context.Context, from, to *basic.Layout, dbIdx int64, table *basic.Table, batchSize int) (*ReshardResult, error) {
+	result := &ReshardResult{DB: dbIdx, Table: table.Name}
+	srcDB := from.GetShardDB(table.Spec.Kind, dbIdx).Clauses(dbresolver.Write).WithContext(ctx)
+	routeColumn := "account_id"
+	if table.Spec.Kind == basic.ShardKindState {
+		routeColumn = "transfer_id"
+	}
+	var cursor int64
+	for {
+		var rows []struct {
+			ID      int64
+			RouteId int64
+		}
+		if err := srcDB.Table(table.Name).Select("id, "+routeColumn+" as route_id").Where("id > ?", cursor).Order("id").Limit(batchSize).Find(&rows).Error; err != nil {
+			return result, basic.NewDBFailed(err)
+		}
+		var ids []int64
+		for _, row := range rows {
+			dstIdx, dstTable := location(to, table.Spec, row.RouteId)
+			if to.GetShardDB(table.Spec.Kind, dstIdx) != from.GetShardDB(table.Spec.Kind, dbIdx) || dstTable != table.Name {
+				ids = append(ids, row.ID)
+			}
+		}
+		if len(ids) != 0 {
+			res := srcDB.Exec("DELETE FROM "+table.Name+" WHERE id IN ?", ids)
+			if res.Error != nil {
+				return result, basic.NewDBFailed(res.Error)
+			}
+			result.Purged += res.RowsAffected
+		}
+		if len(rows) < batchSize {
+			return result, nil
+		}
+		cursor = rows[len(rows)-1].ID
+	}
+}
@@ -0,0 +1,126 @@
+package dao
+
+import (
+	"context"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// GetAccountAmountAt 获取账户指定物品在timestamp(毫秒，包含)时的数量和数量变更序号，读主库
+// 有不晚于timestamp的快照时，从快照开始加上之后到timestamp的变更，否则从当前数量减去timestamp之后的变更
+func (l *Ledger) GetAccountAmountAt(ctx context.Context, accountId int64, itemType basic.ItemType, timestamp int64) (*model.AccountSnapshot, error) {
+	return accountAmountAt(ctx, l.store, accountId, itemType, timestamp)
+}
+
+func accountAmountAt(ctx context.Context, store Store, accountId int64, itemType basic.ItemType, timestamp int64) (*model.AccountSnapshot, error) {
+	result := &model.AccountSnapshot{AccountId: accountId, ItemType: itemType, CutOff: timestamp}
+	snapshot, err := store.GetLastAccountSnapshot(ctx, accountId, itemType, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot != nil {
+		records, err := store.GetAccountRecordsBetween(ctx, accountId, itemType, snapshot.CutOff, timestamp)
+		if err != nil {
+			return nil, err
+		}
+		result.Amount, result.Sequence = snapshot.Amount, snapshot.Sequence
+		for _, record := range records {
+			delta, ok := recordDelta(record)
+			if !ok {
+				continue
+			}
+			if record.CreatedAt > snapshot.CutOff && record.CreatedAt <= timestamp {
+				result.Amount += delta
+				result.Sequence = max(result.Sequence, record.Sequence)
+			}
+			if record.TransferStatus == basic.RecordStatusRollback && record.UpdatedAt > snapshot.CutOff && record.UpdatedAt <= timestamp {
+				result.Amount -= delta
+				result.Sequence = max(result.Sequence, record.RollbackSequence)
+			}
+		}
+		return result, nil
+	}
+	account, err := store.GetAccount(ctx, accountId, itemType, false)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return result, nil
+	}
+	records, err := store.GetAccountRecordsBetween(ctx, accountId, itemType, timestamp, 0)
+	if err != nil {
+		return nil, err
+	}
+	//按序号排除查询账户之后才发生的变更，保证两次查询之间有新转移时结果仍一致，序号为0的是没有序号的历史记录
+	seen := func(sequence int64) bool {
+		return sequence == 0 || sequence <= account.Sequence
+	}
+	result.Amount, result.Sequence = account.Amount, account.Sequence
+	for _, record := range records {
+		delta, ok := recordDelta(record)
+		if !ok {
+			continue
+		}
+		if record.CreatedAt > timestamp && seen(record.Sequence) {
+			result.Amount -= delta
+			if record.Sequence > 0 {
+				result.Sequence--
+			}
+		}
+		if record.TransferStatus == basic.RecordStatusRollback && record.UpdatedAt > timestamp && seen(record.RollbackSequence) {
+			result.Amount += delta
+			if record.RollbackSequence > 0 {
+				result.Sequence--
+			}
+		}
+	}
+	return result, nil
+}
+
+// recordDelta 记录正向操作对账户数量的变动，空回滚等没有变动的记录返回false
+func recordDelta(record *model.Record) (int64, bool) {
+	if record.TransferStatus != basic.RecordStatusNormal && record.TransferStatus != basic.RecordStatusRollback {
+		return 0, false
+	}
+	if record.TransferType == basic.RecordTypeDeduct {
+		return -record.Amount, true
+	}
+	return record.Amount, true
+}
+
+// SnapshotAccounts 为全部账户写入截止cutOff(毫秒，包含)时每种物品的数量快照，截止后才创建的账户没有快照
+// 已写入的快照会被跳过，任务中断后重新执行即可从中断处继续
+func (l *Ledger) SnapshotAccounts(ctx context.Context, cutOff int64, batchSize int) (*model.SnapshotReport, error) {
+	report := &model.SnapshotReport{CutOff: cutOff}
+	err := l.store.EachAccount(ctx, batchSize, func(ctx context.Context, store Store, accounts []*model.Account) error {
+		for _, account := range accounts {
+			if account.CreatedAt > cutOff {
+				continue
+			}
+			existing, err := store.GetAccountSnapshot(ctx, account.AccountId, account.ItemType, cutOff)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				report.Skipped++
+				continue
+			}
+			snapshot, err := accountAmountAt(ctx, store, account.AccountId, account.ItemType, cutOff)
+			if err != nil {
+				return err
+			}
+			created, err := store.CreateAccountSnapshot(ctx, snapshot)
+			if err != nil {
+				return err
+			}
+			if created {
+				report.Created++
+			} else {
+				report.Skipped++
+			}
+		}
+		return nil
+	})
+	return report, err
+}
@@ -0,0 +1,96 @@
+package dao
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// EachAccount 依次遍历每个库上的全部账户分表，按主键分批读取
+// 遍历期间持有当前布局，fn内通过入参store的操作使用同一布局，重新分片切换布局需等待遍历结束
+func (s *gormStore) EachAccount(ctx context.Context, batchSize int, fn func(ctx context.Context, store Store, accounts []*model.Account) error) error {
+	return s.scope(ctx, func(s *gormStore) error {
+		for i := int64(0); i < s.layout.GetDBNum(); i++ {
+			for _, table := range basic.GetPrefixedSplitTables(s.layout.GetTablePrefix(), basic.AccountTableSpec, s.layout.GetAccountTableSplitNum()) {
+				var cursor int64
+				for {
+					var accounts []*model.Account
+					err := s.layout.GetDB(i).Clauses(dbresolver.Write).WithContext(ctx).Table(table.Name).
+						Where("id > ?", cursor).Order("id").Limit(batchSize).Find(&accounts).Error
+					if err != nil {
+						return basic.NewDBFailed(err)
+					}
+					if len(accounts) == 0 {
+						break
+					}
+					if err = fn(ctx, s, accounts); err != nil {
+						return err
+					}
+					if len(accounts) < batchSize {
+						break
+					}
+					cursor = accounts[len(accounts)-1].ID
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *gormStore) GetAccountSnapshot(ctx context.Context, accountId int64, itemType basic.ItemType, cutOff int64) (*model.AccountSnapshot, error) {
+	var snapshots []*model.AccountSnapshot
+	err := s.scope(ctx, func(s *gormStore) error {
+		return s.snapshotTable(ctx, accountId).
+			Where("account_id = ? and item_type = ? and cut_off = ?", accountId, itemType, cutOff).
+			Find(&snapshots).Error
+	})
+	if err != nil {
+		return nil, basic.NewDBFailed(err)
+	}
+	if len(snapshots) == 0 {
+		return nil, nil
+	}
+	return snapshots[0], nil
+}
+
+func (s *gormStore) GetLastAccountSnapshot(ctx context.Context, accountId int64, itemType basic.ItemType, until int64) (*model.AccountSnapshot, error) {
+	var snapshots []*model.AccountSnapshot
+	err := s.scope(ctx, func(s *gormStore) error {
+		return s.snapshotTable(ctx, accountId).
+			Where("account_id = ? and item_type = ? and cut_off <= ?", accountId, itemType, until).
+			Order("cut_off desc").Limit(1).Find(&snapshots).Error
+	})
+	if err != nil {
+		return nil, basic.NewDBFailed(err)
+	}
+	if len(snapshots) == 0 {
+		return nil, nil
+	}
+	return snapshots[0], nil
+}
+
+// CreateAccountSnapshot 写入快照，唯一键冲突时不写入，重复执行快照任务时跳过已写入的快照
+func (s *gormStore) CreateAccountSnapshot(ctx context.Context, snapshot *model.AccountSnapshot) (bool, error) {
+	var created bool
+	err := s.scope(ctx, func(s *gormStore) error {
+		res := s.snapshotTable(ctx, snapshot.AccountId).Clauses(clause.OnConflict{DoNothing: true}).Create(snapshot)
+		if res.Error != nil {
+			return basic.NewDBFailed(res.Error)
+		}
+		created = res.RowsAffected != 0
+		if created {
+			s.touch(snapshotKey(snapshot.AccountId, snapshot.ItemType, snapshot.CutOff))
+		}
+		return nil
+	})
+	return created, err
+}
+
+func (s *gormStore) snapshotTable(ctx context.Context, accountId int64) *gorm.DB {
+	return s.recordAndAccountDB(ctx, accountId, false).Table(s.layout.GetAccountSnapshotTableName(accountId))
+}
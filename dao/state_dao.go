@@ -4,25 +4,41 @@ import (
 	"context"
 
 	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
 
 	"github.com/zjn-zjn/fisher/basic"
 	"github.com/zjn-zjn/fisher/model"
 )
 
 // GetOrCreateState 获取转移记录，如果不存在则创建
+// 已存在时与请求的付款方和收款方比较，不一致返回IdempotencyConflictErr
 func GetOrCreateState(ctx context.Context, req *model.TransferReq) (*model.State, error) {
+	return defaultLedger().GetOrCreateState(ctx, req)
+}
+
+// GetOrCreateState 见包级函数GetOrCreateState
+func (l *Ledger) GetOrCreateState(ctx context.Context, req *model.TransferReq) (*model.State, error) {
 	var state *model.State
-	err := StateInstanceTX(ctx, req.TransferId, func(ctx context.Context, db *gorm.DB) error {
+	err := l.store.StateInstanceTX(ctx, req.TransferId, func(ctx context.Context, tx Store) error {
 		var err error
-		state, err = GetState(ctx, req.TransferId, req.TransferScene, db)
+		state, err = tx.GetState(ctx, req.TransferId, req.TransferScene)
 		if err != nil {
 			return basic.NewDBFailed(err)
 		}
 		if state == nil {
 			state = model.AssembleState(req.FromAccounts, req.ToAccounts, req.TransferId, req.TransferScene, basic.StateStatusDoing, req.Comment)
-			if err = CreateState(ctx, state, db); err != nil {
+			if err = tx.CreateState(ctx, state); err != nil {
 				return err
 			}
+			return nil
+		}
+		if len(state.FromAccounts) == 0 && len(state.ToAccounts) == 0 {
+			//空回滚的状态没有转移内容，由调用方按状态处理
+			return nil
+		}
+		if diff := state.DiffAccounts(req.FromAccounts, req.ToAccounts); len(diff) != 0 {
+			//转移ID被不同内容的请求复用
+			return basic.NewIdempotencyConflict(diff)
 		}
 		return nil
 	})
@@ -33,14 +49,13 @@ func GetOrCreateState(ctx context.Context, req *model.TransferReq) (*model.State
 }
 
 // GetState 获取转移记录
-func GetState(ctx context.Context, transferId int64, transferScene basic.TransferScene, db *gorm.DB) (*model.State, error) {
+func (s *gormStore) GetState(ctx context.Context, transferId int64, transferScene basic.TransferScene) (*model.State, error) {
 	var records []*model.State
-	if db == nil {
-		db = basic.GetStateWriteDB(ctx, transferId)
-	}
-	err := db.Table(model.GetStateTableName(transferId)).
-		Where("transfer_id = ? and transfer_scene = ?", transferId, transferScene).
-		Find(&records).Error
+	err := s.scope(ctx, func(s *gormStore) error {
+		return s.stateTable(ctx, transferId).
+			Where("transfer_id = ? and transfer_scene = ?", transferId, transferScene).
+			Find(&records).Error
+	})
 	if err != nil {
 		return nil, basic.NewDBFailed(err)
 	}
@@ -50,57 +65,75 @@ func GetState(ctx context.Context, transferId int64, transferScene basic.Transfe
 	return records[0], nil
 }
 
-// UpdateStateStatus 更新转移状态
-func UpdateStateStatus(ctx context.Context, transferId int64, transferScene basic.TransferScene, fromStatus, toStatus basic.StateStatus) error {
-	err := basic.GetStateWriteDB(ctx, transferId).Table(model.GetStateTableName(transferId)).
-		Where("transfer_id = ? and transfer_scene = ? and status = ?", transferId, transferScene, fromStatus).
-		Updates(map[string]interface{}{
-			"status": toStatus,
-		}).Error
-	if err != nil {
-		return basic.NewDBFailed(err)
+// UpdateStateStatus 更新转移状态并返回是否有更改，需要通知下游的状态在同一事务内写入事件
+func (s *gormStore) UpdateStateStatus(ctx context.Context, transferId int64, transferScene basic.TransferScene, fromStatus, toStatus basic.StateStatus) (bool, error) {
+	if !basic.IsOutboxStateStatus(toStatus) {
+		return s.updateStateStatus(ctx, transferId, transferScene, fromStatus, toStatus)
 	}
-	return nil
+	var updated bool
+	err := s.StateInstanceTX(ctx, transferId, func(ctx context.Context, tx Store) error {
+		var err error
+		updated, err = tx.(*gormStore).updateStateStatus(ctx, transferId, transferScene, fromStatus, toStatus)
+		if err != nil || !updated {
+			return err
+		}
+		return tx.(*gormStore).createOutboxEvent(ctx, model.AssembleOutboxEvent(transferId, transferScene, fromStatus, toStatus))
+	})
+	return updated, err
 }
 
-// UpdateStateStatusWithAffect 更新转移状态并返回是否有更改
-func UpdateStateStatusWithAffect(ctx context.Context, transferId int64, transferScene basic.TransferScene, fromStatus, toStatus basic.StateStatus) (bool, error) {
-	res := basic.GetStateWriteDB(ctx, transferId).Table(model.GetStateTableName(transferId)).
-		Where("transfer_id = ? and transfer_scene = ? and status = ?", transferId, transferScene, fromStatus).
-		Updates(map[string]interface{}{
-			"status": toStatus,
-		})
-	if res.Error != nil {
-		return false, basic.NewDBFailed(res.Error)
-	}
-	return res.RowsAffected != 0, nil
+func (s *gormStore) updateStateStatus(ctx context.Context, transferId int64, transferScene basic.TransferScene, fromStatus, toStatus basic.StateStatus) (bool, error) {
+	return s.updateState(ctx, transferId, transferScene, func(db *gorm.DB) *gorm.DB {
+		return db.Where("transfer_id = ? and transfer_scene = ? and status = ?", transferId, transferScene, fromStatus).
+			Updates(map[string]interface{}{
+				"status": toStatus,
+			})
+	})
 }
 
 // UpdateStateToRollbackDoing 将非回滚成功的转移状态更新为回滚中
-func UpdateStateToRollbackDoing(ctx context.Context, transferId int64, transferScene basic.TransferScene) (bool, error) {
-	res := basic.GetStateWriteDB(ctx, transferId).Table(model.GetStateTableName(transferId)).
-		Where("transfer_id = ? and transfer_scene = ? and status != ?", transferId, transferScene, basic.StateStatusRollbackDone).
-		Updates(map[string]interface{}{
-			"status": basic.StateStatusRollbackDoing,
-		})
-	if res.Error != nil {
-		return false, basic.NewDBFailed(res.Error)
-	}
-	return res.RowsAffected != 0, nil
+func (s *gormStore) UpdateStateToRollbackDoing(ctx context.Context, transferId int64, transferScene basic.TransferScene) (bool, error) {
+	return s.updateState(ctx, transferId, transferScene, func(db *gorm.DB) *gorm.DB {
+		return db.Where("transfer_id = ? and transfer_scene = ? and status != ?", transferId, transferScene, basic.StateStatusRollbackDone).
+			Updates(map[string]interface{}{
+				"status": basic.StateStatusRollbackDoing,
+			})
+	})
+}
+
+func (s *gormStore) updateState(ctx context.Context, transferId int64, transferScene basic.TransferScene, update func(db *gorm.DB) *gorm.DB) (bool, error) {
+	var updated bool
+	err := s.scope(ctx, func(s *gormStore) error {
+		res := update(s.stateTable(ctx, transferId))
+		if res.Error != nil {
+			return basic.NewDBFailed(res.Error)
+		}
+		updated = res.RowsAffected != 0
+		if updated {
+			s.touch(stateKey(transferId, transferScene))
+		}
+		return nil
+	})
+	return updated, err
 }
 
 // GetNeedInspectionStateList 获取截止lastTime需要推进的转移记录
-func GetNeedInspectionStateList(ctx context.Context, lastTime int64) ([]*model.State, error) {
+func (s *gormStore) GetNeedInspectionStateList(ctx context.Context, lastTime int64) ([]*model.State, error) {
 	var records []*model.State
-	for i := int64(0); i < basic.GetDBNum(); i++ {
-		for j := int64(0); j < basic.GetStateTableSplitNum(); j++ {
-			tableName := model.GetStateTableName(j)
-			recordsTmp, err := getLastTimeNeedInspectionStateListByTable(basic.GetStateWriteDB(ctx, i), tableName, lastTime)
-			if err != nil {
-				return nil, err
+	err := s.scope(ctx, func(s *gormStore) error {
+		for i := int64(0); i < s.layout.GetStateDBNum(); i++ {
+			for _, table := range basic.GetPrefixedSplitTables(s.layout.GetTablePrefix(), basic.StateTableSpec, s.layout.GetStateTableSplitNum()) {
+				recordsTmp, err := getLastTimeNeedInspectionStateListByTable(s.layout.GetStateDB(i).Clauses(dbresolver.Write).WithContext(ctx), table.Name, lastTime)
+				if err != nil {
+					return err
+				}
+				records = append(records, recordsTmp...)
 			}
-			records = append(records, recordsTmp...)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return records, nil
 }
@@ -116,13 +149,49 @@ func getLastTimeNeedInspectionStateListByTable(db *gorm.DB, tableName string, la
 	return records, nil
 }
 
-func CreateState(ctx context.Context, state *model.State, db *gorm.DB) error {
-	if db == nil {
-		db = basic.GetStateWriteDB(ctx, state.TransferId)
-	}
-	err := db.Table(model.GetStateTableName(state.TransferId)).Create(state).Error
+// GetStateListByCreatedAt 获取全部状态表中创建时间在[start, end)内的转移状态
+func (s *gormStore) GetStateListByCreatedAt(ctx context.Context, start, end int64) ([]*model.State, error) {
+	var states []*model.State
+	err := s.scope(ctx, func(s *gormStore) error {
+		for i := int64(0); i < s.layout.GetStateDBNum(); i++ {
+			for _, table := range basic.GetPrefixedSplitTables(s.layout.GetTablePrefix(), basic.StateTableSpec, s.layout.GetStateTableSplitNum()) {
+				var statesTmp []*model.State
+				err := s.layout.GetStateDB(i).Clauses(dbresolver.Write).WithContext(ctx).Table(table.Name).
+					Where("created_at >= ? and created_at < ?", start, end).
+					Order("id").
+					Find(&statesTmp).Error
+				if err != nil {
+					return basic.NewDBFailed(err)
+				}
+				states = append(states, statesTmp...)
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return basic.NewDBFailed(err)
+		return nil, err
 	}
-	return nil
+	return states, nil
+}
+
+func (s *gormStore) CreateState(ctx context.Context, state *model.State) error {
+	if !basic.IsOutboxStateStatus(state.Status) {
+		return s.createState(ctx, state)
+	}
+	return s.StateInstanceTX(ctx, state.TransferId, func(ctx context.Context, tx Store) error {
+		if err := tx.(*gormStore).createState(ctx, state); err != nil {
+			return err
+		}
+		return tx.(*gormStore).createOutboxEvent(ctx, model.AssembleOutboxEvent(state.TransferId, state.TransferScene, 0, state.Status))
+	})
+}
+
+func (s *gormStore) createState(ctx context.Context, state *model.State) error {
+	return s.scope(ctx, func(s *gormStore) error {
+		if err := s.stateTable(ctx, state.TransferId).Create(state).Error; err != nil {
+			return basic.NewDBFailed(err)
+		}
+		s.touch(stateKey(state.TransferId, state.TransferScene))
+		return nil
+	})
 }
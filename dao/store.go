@@ -0,0 +1,141 @@
+package dao
+
+import (
+	"context"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// Store 存储后端
+// 转移、回滚、检查推进等流程只依赖该接口，不感知具体的数据库实现，默认实现为基于gorm的MySQL存储
+type Store interface {
+	StateStore
+	RecordStore
+	AccountStore
+	SnapshotStore
+	OutboxStore
+
+	// StateInstanceTX 在转移状态所在的实例上开启本地事务，fn内通过入参store进行的状态操作均在该事务内
+	StateInstanceTX(ctx context.Context, transferId int64, fn func(ctx context.Context, store Store) error) error
+	// RecordAndAccountInstanceTX 在账户所在的实例上开启本地事务，fn内通过入参store进行的记录和账户操作均在该事务内
+	RecordAndAccountInstanceTX(ctx context.Context, accountId int64, fn func(ctx context.Context, store Store) error) error
+}
+
+// StateStore 转移状态存储
+type StateStore interface {
+	// GetState 获取转移状态，不存在返回nil
+	GetState(ctx context.Context, transferId int64, transferScene basic.TransferScene) (*model.State, error)
+	// CreateState 创建转移状态，创建为半成功、成功或回滚完成时在同一本地事务内写入状态变更事件
+	CreateState(ctx context.Context, state *model.State) error
+	// UpdateStateStatus 将状态从fromStatus更新为toStatus，返回是否有更改
+	// 更新为半成功、成功或回滚完成时在同一本地事务内写入状态变更事件
+	UpdateStateStatus(ctx context.Context, transferId int64, transferScene basic.TransferScene, fromStatus, toStatus basic.StateStatus) (bool, error)
+	// UpdateStateToRollbackDoing 将非回滚完成的转移状态更新为回滚中，返回是否有更改
+	UpdateStateToRollbackDoing(ctx context.Context, transferId int64, transferScene basic.TransferScene) (bool, error)
+	// GetNeedInspectionStateList 获取截止lastTime需要推进的转移状态
+	GetNeedInspectionStateList(ctx context.Context, lastTime int64) ([]*model.State, error)
+	// GetStateListByCreatedAt 获取全部状态表中创建时间在[start, end)(毫秒)内的转移状态
+	GetStateListByCreatedAt(ctx context.Context, start, end int64) ([]*model.State, error)
+}
+
+// RecordStore 转移记录存储
+type RecordStore interface {
+	// GetRecord 获取转移记录，不存在返回nil
+	GetRecord(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, transferType basic.TransferType, changeType basic.ChangeType) (*model.Record, error)
+	// CreateRecord 创建转移记录
+	CreateRecord(ctx context.Context, record *model.Record) error
+	// UpdateRecord 将记录状态从originTransferStatus更新为transferStatus，返回是否有更改
+	// 将正常记录更新为回滚时要求已退款金额为0，已有退款的记录不更新，与UpdateRecordRefundedAmount互斥
+	UpdateRecord(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, transferType basic.TransferType, transferStatus, originTransferStatus basic.RecordStatus, changeType basic.ChangeType) (bool, error)
+	// UpdateRecordRefundedAmount 将正常记录的已退款金额增加delta，delta为负时减少，结果超出[0, 转移金额]时不更新，返回是否有更改
+	UpdateRecordRefundedAmount(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, transferType basic.TransferType, changeType basic.ChangeType, delta int64) (bool, error)
+	// UpdateRecordBalance 记录操作后的账户数量和数量变更序号，rollback为true时记录回滚后的
+	UpdateRecordBalance(ctx context.Context, accountId, transferId int64, itemType basic.ItemType, transferScene basic.TransferScene, transferType basic.TransferType, changeType basic.ChangeType, rollback bool, account *model.Account) error
+	// GetLastRecordChain 获取账户指定物品哈希链的最后一环，链为空返回nil，读主库
+	GetLastRecordChain(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.RecordChain, error)
+	// CreateRecordChain 向记录哈希链追加一环，需在本地事务内调用
+	CreateRecordChain(ctx context.Context, chain *model.RecordChain) error
+	// ListRecordChain 按链上序号升序获取账户指定物品序号大于afterChainSeq的环，最多limit个，读主库
+	ListRecordChain(ctx context.Context, accountId int64, itemType basic.ItemType, afterChainSeq int64, limit int) ([]*model.RecordChain, error)
+	// ListRecordsById 按ID升序获取账户指定物品ID大于afterId的全部记录，最多limit条，读主库
+	// 重新分片后ID顺序不再是创建顺序，只用于不依赖顺序的全量遍历
+	ListRecordsById(ctx context.Context, accountId int64, itemType basic.ItemType, afterId int64, limit int) ([]*model.Record, error)
+	// GetAccountRecordsBetween 获取账户指定物品在(after, until](毫秒)内创建或回滚的增减记录，until小于等于0时不限制，读主库
+	GetAccountRecordsBetween(ctx context.Context, accountId int64, itemType basic.ItemType, after, until int64) ([]*model.Record, error)
+	// GetAccountRecordTotal 按记录回放账户指定物品的数量，读主库
+	GetAccountRecordTotal(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.RecordTotal, error)
+	// EachRecordAccount 遍历全部记录表中出现的账户物品，按(账户ID, 物品类型)分批回放，fn内使用入参store操作
+	EachRecordAccount(ctx context.Context, batchSize int, fn func(ctx context.Context, store Store, totals []*model.RecordTotal) error) error
+	// SumRecordAmount 按物品类型汇总全部记录表中正常状态增减记录的变动，增加为正扣减为负
+	SumRecordAmount(ctx context.Context) (map[basic.ItemType]int64, error)
+	// GetExpiredFreezeRecordList 获取截止now已过期且仍在冻结中的冻结记录
+	GetExpiredFreezeRecordList(ctx context.Context, now int64) ([]*model.Record, error)
+	// GetAccountLastRecord 获取账户最新一条正常记录，按(创建时间, ID)排序，readOnly为true时读从库
+	GetAccountLastRecord(ctx context.Context, accountId int64, itemType *basic.ItemType, transferScene *basic.TransferScene, transferType *basic.TransferType, readOnly bool) (*model.Record, error)
+	// ListAccountRecords 按(创建时间, ID)分页查询账户记录，游标为上一页最后一条记录的ID，读从库，最多返回limit条
+	ListAccountRecords(ctx context.Context, req *model.ListRecordReq, limit int) ([]*model.Record, error)
+}
+
+// AccountStore 账户存储
+type AccountStore interface {
+	// GetOrCreateAccount 获取账户，不存在则创建
+	GetOrCreateAccount(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.Account, error)
+	// GetAccountAmount 获取账户所有物品数量，readOnly为true时读从库
+	GetAccountAmount(ctx context.Context, accountId int64, readOnly bool) (map[basic.ItemType]int64, error)
+	// GetAccountAmountByItemType 获取账户指定物品数量，readOnly为true时读从库
+	GetAccountAmountByItemType(ctx context.Context, accountId int64, itemType basic.ItemType, readOnly bool) (int64, error)
+	// SumAccountAmount 按物品类型汇总全部账户表的数量
+	SumAccountAmount(ctx context.Context) (map[basic.ItemType]int64, error)
+	// GetAccount 获取账户指定物品的数量和冻结数量，不存在返回nil，readOnly为true时读从库
+	GetAccount(ctx context.Context, accountId int64, itemType basic.ItemType, readOnly bool) (*model.Account, error)
+	// DeductAccountAmount 扣减账户物品并将数量变更序号加1，返回变更后的账户，需在本地事务内调用
+	// allowNegative为false时可用数量(数量减冻结数量)不足返回InsufficientAmountErr
+	DeductAccountAmount(ctx context.Context, accountId, amount int64, itemType basic.ItemType, allowNegative bool) (*model.Account, error)
+	// LockAccount 获取并锁定账户，不存在则创建，需在本地事务内调用，事务结束前其他变更该账户的事务需等待
+	LockAccount(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.Account, error)
+	// SetAccountAmount 直接设置账户数量、冻结数量和数量变更序号，不写记录，仅用于按记录重建账户，需在本地事务内调用
+	SetAccountAmount(ctx context.Context, accountId int64, itemType basic.ItemType, amount, frozenAmount, sequence int64) error
+	// IncreaseAccountAmount 增加账户物品并将数量变更序号加1，返回变更后的账户，需在本地事务内调用
+	IncreaseAccountAmount(ctx context.Context, accountId, amount int64, itemType basic.ItemType) (*model.Account, error)
+	// FreezeAccountAmount 增加冻结数量，allowNegative为false时可用数量不足返回InsufficientAmountErr
+	FreezeAccountAmount(ctx context.Context, accountId, amount int64, itemType basic.ItemType, allowNegative bool) error
+	// UnfreezeAccountAmount 减少冻结数量，冻结数量不足返回StateMutationErr
+	UnfreezeAccountAmount(ctx context.Context, accountId, amount int64, itemType basic.ItemType) error
+}
+
+// SnapshotStore 账户快照存储
+type SnapshotStore interface {
+	// EachAccount 按库和分表遍历全部账户，每批最多batchSize个，fn内通过入参store进行操作，读主库
+	EachAccount(ctx context.Context, batchSize int, fn func(ctx context.Context, store Store, accounts []*model.Account) error) error
+	// GetAccountSnapshot 获取账户指定截止时间的快照，不存在返回nil
+	GetAccountSnapshot(ctx context.Context, accountId int64, itemType basic.ItemType, cutOff int64) (*model.AccountSnapshot, error)
+	// GetLastAccountSnapshot 获取截止时间不晚于until的最新快照，不存在返回nil
+	GetLastAccountSnapshot(ctx context.Context, accountId int64, itemType basic.ItemType, until int64) (*model.AccountSnapshot, error)
+	// CreateAccountSnapshot 写入快照，同一截止时间已存在时不写入，返回是否写入
+	CreateAccountSnapshot(ctx context.Context, snapshot *model.AccountSnapshot) (bool, error)
+}
+
+// OutboxStore 转移状态变更事件存储，事件与转移状态同库同分表
+type OutboxStore interface {
+	// EachPendingOutboxEvent 按库和分表遍历待投递的事件，同一表内按(创建时间, ID)升序，每批最多batchSize个，fn内通过入参store进行操作，读主库
+	EachPendingOutboxEvent(ctx context.Context, batchSize int, fn func(ctx context.Context, store Store, events []*model.OutboxEvent) error) error
+	// MarkOutboxEventPublished 将待投递的事件标记为已投递
+	MarkOutboxEventPublished(ctx context.Context, event *model.OutboxEvent) error
+	// MarkOutboxEventFailed 记录待投递事件的一次投递失败，失败次数加1
+	MarkOutboxEventFailed(ctx context.Context, event *model.OutboxEvent, errMsg string) error
+	// PurgeOutboxEvents 删除更新时间早于before(毫秒)的已投递事件，返回删除的数量
+	PurgeOutboxEvents(ctx context.Context, before int64) (int64, error)
+}
+
+var store Store = NewGormStore()
+
+// SetStore 设置存储后端，需在初始化阶段调用
+func SetStore(s Store) {
+	store = s
+}
+
+// GetStore 获取当前存储后端
+func GetStore() Store {
+	return store
+}
@@ -0,0 +1,42 @@
+package dao
+
+import (
+	"context"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// GetTransferDetail 加载转移状态中每个账户操作所在分片上的记录，付款方为扣减记录，收款方为增加记录
+func (l *Ledger) GetTransferDetail(ctx context.Context, state *model.State) (*model.TransferDetail, error) {
+	detail := &model.TransferDetail{State: state}
+	for _, item := range state.FromAccounts {
+		leg, err := l.getTransferLeg(ctx, state, item, basic.RecordTypeDeduct)
+		if err != nil {
+			return nil, err
+		}
+		detail.FromAccounts = append(detail.FromAccounts, leg)
+	}
+	for _, item := range state.ToAccounts {
+		leg, err := l.getTransferLeg(ctx, state, item, basic.RecordTypeAdd)
+		if err != nil {
+			return nil, err
+		}
+		detail.ToAccounts = append(detail.ToAccounts, leg)
+	}
+	return detail, nil
+}
+
+func (l *Ledger) getTransferLeg(ctx context.Context, state *model.State, item *model.TransferItem, transferType basic.TransferType) (*model.TransferLeg, error) {
+	record, err := l.store.GetRecord(ctx, item.AccountId, state.TransferId, item.ItemType, state.TransferScene, transferType, item.ChangeType)
+	if err != nil {
+		return nil, err
+	}
+	leg := &model.TransferLeg{Item: item, Record: record, Status: model.GetLegStatus(record)}
+	if item.Frozen {
+		if leg.FreezeRecord, err = l.store.GetRecord(ctx, item.AccountId, state.TransferId, item.ItemType, state.TransferScene, basic.RecordTypeFreeze, item.ChangeType); err != nil {
+			return nil, err
+		}
+	}
+	return leg, nil
+}
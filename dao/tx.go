@@ -3,9 +3,6 @@ package dao
 import (
 	"context"
 
-	"github.com/pkg/errors"
-	"gorm.io/gorm"
-
 	"github.com/zjn-zjn/fisher/basic"
 	"github.com/zjn-zjn/fisher/model"
 )
@@ -16,21 +13,26 @@ type TransferTxItem struct {
 }
 
 func ExecuteTransfer(ctx context.Context, state *model.State, deductionTxItems, increaseTxItems []*TransferTxItem, useHalfSuccess bool) error {
+	return defaultLedger().ExecuteTransfer(ctx, state, deductionTxItems, increaseTxItems, useHalfSuccess)
+}
+
+// ExecuteTransfer 先执行扣减再执行增加，失败时快速回滚，useHalfSuccess为true时扣减成功即返回，增加异步执行
+func (l *Ledger) ExecuteTransfer(ctx context.Context, state *model.State, deductionTxItems, increaseTxItems []*TransferTxItem, useHalfSuccess bool) error {
 	if err := executeTransactions(ctx, deductionTxItems); err != nil {
-		fastRollBack(ctx, state, append(increaseTxItems, deductionTxItems...))
+		l.fastRollBack(ctx, state, append(increaseTxItems, deductionTxItems...))
 		return err
 	}
 
 	if useHalfSuccess {
-		return handleHalfSuccessTransfer(ctx, state, increaseTxItems)
+		return l.handleHalfSuccessTransfer(ctx, state, increaseTxItems)
 	}
 
 	if err := executeTransactions(ctx, increaseTxItems); err != nil {
-		fastRollBack(ctx, state, append(increaseTxItems, deductionTxItems...))
+		l.fastRollBack(ctx, state, append(increaseTxItems, deductionTxItems...))
 		return err
 	}
 
-	return finalizeTransfer(ctx, state)
+	return l.finalizeTransfer(ctx, state)
 }
 
 func executeTransactions(ctx context.Context, txItems []*TransferTxItem) error {
@@ -42,14 +44,14 @@ func executeTransactions(ctx context.Context, txItems []*TransferTxItem) error {
 	return nil
 }
 
-func handleHalfSuccessTransfer(ctx context.Context, state *model.State, increaseTxItems []*TransferTxItem) error {
-	affected, err := UpdateStateStatusWithAffect(ctx, state.TransferId, state.TransferScene, basic.StateStatusDoing, basic.StateStatusHalfSuccess)
+func (l *Ledger) handleHalfSuccessTransfer(ctx context.Context, state *model.State, increaseTxItems []*TransferTxItem) error {
+	affected, err := l.store.UpdateStateStatus(ctx, state.TransferId, state.TransferScene, basic.StateStatusDoing, basic.StateStatusHalfSuccess)
 	if err != nil {
 		return err
 	}
 
 	if !affected {
-		currentState, err := GetState(ctx, state.TransferId, state.TransferScene, nil)
+		currentState, err := l.store.GetState(ctx, state.TransferId, state.TransferScene)
 		if err != nil {
 			return err
 		}
@@ -60,7 +62,7 @@ func handleHalfSuccessTransfer(ctx context.Context, state *model.State, increase
 		case basic.StateStatusRollbackDone:
 			return basic.StateMutationErr
 		default:
-			fastRollBack(ctx, state, increaseTxItems)
+			l.fastRollBack(ctx, state, increaseTxItems)
 			return basic.StateMutationErr
 		}
 	}
@@ -69,20 +71,20 @@ func handleHalfSuccessTransfer(ctx context.Context, state *model.State, increase
 		if err := executeTransactions(ctx, increaseTxItems); err != nil {
 			return
 		}
-		_, _ = UpdateStateStatusWithAffect(ctx, state.TransferId, state.TransferScene, basic.StateStatusHalfSuccess, basic.StateStatusSuccess)
+		_, _ = l.store.UpdateStateStatus(ctx, state.TransferId, state.TransferScene, basic.StateStatusHalfSuccess, basic.StateStatusSuccess)
 	}()
 
 	return nil
 }
 
-func finalizeTransfer(ctx context.Context, state *model.State) error {
-	affected, err := UpdateStateStatusWithAffect(ctx, state.TransferId, state.TransferScene, basic.StateStatusDoing, basic.StateStatusSuccess)
+func (l *Ledger) finalizeTransfer(ctx context.Context, state *model.State) error {
+	affected, err := l.store.UpdateStateStatus(ctx, state.TransferId, state.TransferScene, basic.StateStatusDoing, basic.StateStatusSuccess)
 	if err != nil {
 		return err
 	}
 
 	if !affected {
-		currentState, err := GetState(ctx, state.TransferId, state.TransferScene, nil)
+		currentState, err := l.store.GetState(ctx, state.TransferId, state.TransferScene)
 		if err != nil {
 			return err
 		}
@@ -100,8 +102,8 @@ func finalizeTransfer(ctx context.Context, state *model.State) error {
 	return nil
 }
 
-func fastRollBack(ctx context.Context, state *model.State, txItems []*TransferTxItem) {
-	affected, err := UpdateStateStatusWithAffect(ctx, state.TransferId, state.TransferScene, basic.StateStatusDoing, basic.StateStatusRollbackDoing)
+func (l *Ledger) fastRollBack(ctx context.Context, state *model.State, txItems []*TransferTxItem) {
+	affected, err := l.store.UpdateStateStatus(ctx, state.TransferId, state.TransferScene, basic.StateStatusDoing, basic.StateStatusRollbackDoing)
 	if err != nil || !affected {
 		return
 	}
@@ -112,39 +114,5 @@ func fastRollBack(ctx context.Context, state *model.State, txItems []*TransferTx
 		}
 	}
 
-	_ = UpdateStateStatus(ctx, state.TransferId, state.TransferScene, basic.StateStatusRollbackDoing, basic.StateStatusRollbackDone)
-}
-
-func RecordAndAccountInstanceTX(ctx context.Context, accountId int64, fn func(context.Context, *gorm.DB) error) error {
-	return executeTx(basic.GetRecordAndAccountWriteDB(ctx, accountId), fn)
-}
-
-func StateInstanceTX(ctx context.Context, transferId int64, fn func(context.Context, *gorm.DB) error) error {
-	return executeTx(basic.GetStateWriteDB(ctx, transferId), fn)
-}
-
-func executeTx(db *gorm.DB, fn func(context.Context, *gorm.DB) error) error {
-	tx := db.Begin()
-	if tx.Error != nil {
-		return basic.NewWithErr(basic.DBFailedErrCode, errors.Wrap(tx.Error, "[fisher] begin tx failed"))
-	}
-
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	if err := fn(tx.Statement.Context, tx); err != nil {
-		if rbErr := tx.Rollback().Error; rbErr != nil {
-			return basic.NewWithErr(basic.DBFailedErrCode, errors.Wrap(rbErr, "[fisher] rollback tx failed"))
-		}
-		return err
-	}
-
-	if err := tx.Commit().Error; err != nil {
-		return basic.NewWithErr(basic.DBFailedErrCode, errors.Wrap(err, "[fisher] commit tx failed"))
-	}
-
-	return nil
+	_, _ = l.store.UpdateStateStatus(ctx, state.TransferId, state.TransferScene, basic.StateStatusRollbackDoing, basic.StateStatusRollbackDone)
 }
@@ -0,0 +1,39 @@
+// Package fisher 基于SAGA的物品转移账本
+//
+// 通过New按配置创建客户端，配置、路由和存储都保存在客户端实例上，同一进程可以承载多个账本：
+//
+//	client, err := fisher.New(&basic.TransferConf{DBs: dbs, AccountSplitNum: 3})
+//	err = client.Transfer(ctx, req)
+//
+// service包中的包级函数是基于basic.InitWithConf和dao.SetStore全局配置的默认客户端的封装
+package fisher
+
+import (
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/dao"
+	"github.com/zjn-zjn/fisher/service"
+)
+
+// Client 物品转移客户端
+type Client = service.Client
+
+// Option 客户端选项
+type Option = service.Option
+
+// New 按配置创建客户端
+func New(conf *basic.TransferConf, opts ...Option) (*Client, error) {
+	return service.New(conf, opts...)
+}
+
+// WithStore 使用指定的存储，例如memory.NewStore()
+func WithStore(store dao.Store) Option {
+	return service.WithStore(store)
+}
+
+// Ledgers 多账本客户端，每个命名空间一个独立的账本
+type Ledgers = service.Ledgers
+
+// NewLedgers 按配置中的命名空间创建多账本客户端
+func NewLedgers(conf *basic.TransferConf, opts ...Option) (*Ledgers, error) {
+	return service.NewLedgers(conf, opts...)
+}
@@ -0,0 +1,180 @@
+package fisher
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/dao/memory"
+	"github.com/zjn-zjn/fisher/model"
+	"github.com/zjn-zjn/fisher/schema"
+)
+
+const (
+	itemTypeGold  basic.ItemType      = 1
+	transferScene basic.TransferScene = 1
+	changeType    basic.ChangeType    = 1
+	userAccount                       = int64(100000000001)
+)
+
+// openSQLite 打开临时SQLite库并按配置建表
+func openSQLite(t *testing.T, conf *basic.TransferConf) {
+	dsn := filepath.Join(t.TempDir(), "fisher.db") + "?_busy_timeout=5000&_txlock=immediate"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	conf.DBs = []*gorm.DB{db}
+	if err = schema.Apply(context.Background(), conf); err != nil {
+		t.Fatalf("failed to create tables: %v", err)
+	}
+}
+
+func newSQLiteClient(t *testing.T, conf *basic.TransferConf) *Client {
+	openSQLite(t, conf)
+	client, err := New(conf)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	return client
+}
+
+// recharge 从官方账户bank给用户充值，返回用户余额
+func recharge(t *testing.T, client *Client, transferId, bank, amount int64) int64 {
+	t.Helper()
+	ctx := context.Background()
+	err := client.Transfer(ctx, &model.TransferReq{
+		TransferId:    transferId,
+		TransferScene: transferScene,
+		FromAccounts:  []*model.TransferItem{{AccountId: bank, ItemType: itemTypeGold, Amount: amount, ChangeType: changeType}},
+		ToAccounts:    []*model.TransferItem{{AccountId: userAccount, ItemType: itemTypeGold, Amount: amount, ChangeType: changeType}},
+	})
+	if err != nil {
+		t.Fatalf("failed to recharge: %v", err)
+	}
+	balance, err := client.GetAccountAmountByItemTypeWrite(ctx, userAccount, itemTypeGold)
+	if err != nil {
+		t.Fatalf("failed to get amount: %v", err)
+	}
+	return balance
+}
+
+// TestClientsAreIsolated 不同配置的客户端并行运行，互不影响
+func TestClientsAreIsolated(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		t.Parallel()
+		client, err := New(&basic.TransferConf{}, WithStore(memory.NewStore()))
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		for i := int64(1); i <= 20; i++ {
+			if balance := recharge(t, client, i, 10000000, 10); balance != 10*i {
+				t.Fatalf("balance got %d want %d", balance, 10*i)
+			}
+		}
+	})
+	t.Run("sqlite_split", func(t *testing.T) {
+		t.Parallel()
+		//官方账户步长与默认不同，默认配置下100不是官方账户
+		client := newSQLiteClient(t, &basic.TransferConf{
+			AccountSplitNum:     2,
+			RecordSplitNum:      3,
+			OfficialAccountStep: 100,
+			OfficialAccountMin:  1,
+			OfficialAccountMax:  1000,
+		})
+		for i := int64(1); i <= 20; i++ {
+			if balance := recharge(t, client, i, 100, 20); balance != 20*i {
+				t.Fatalf("balance got %d want %d", balance, 20*i)
+			}
+		}
+		if errs := client.Inspection(context.Background(), 0); len(errs) != 0 {
+			t.Fatalf("inspection failed: %v", errs)
+		}
+	})
+}
+
+func TestNewInvalidConf(t *testing.T) {
+	if _, err := New(nil); err == nil {
+		t.Fatalf("expect error for nil conf")
+	}
+	if _, err := New(&basic.TransferConf{}); err == nil {
+		t.Fatalf("expect error without db or store")
+	}
+	if _, err := New(&basic.TransferConf{OfficialAccountStep: 100, OfficialAccountMax: 10}, WithStore(memory.NewStore())); err == nil {
+		t.Fatalf("expect error for invalid official account range")
+	}
+	//配置了命名空间时只有带前缀的表，需通过NewLedgers创建
+	namespaces := []*basic.NamespaceConf{{Name: "coin"}}
+	if _, err := New(&basic.TransferConf{Namespaces: namespaces}, WithStore(memory.NewStore())); err == nil {
+		t.Fatalf("expect error for conf with namespaces")
+	}
+	if err := basic.InitWithConf(&basic.TransferConf{DBs: []*gorm.DB{nil}, Namespaces: namespaces}); err == nil {
+		t.Fatalf("expect error for init with namespaces")
+	}
+}
+
+// TestLedgersAreIsolated 同一个库上的多个命名空间，相同账户ID的余额互不影响，官方账户区间各自生效
+func TestLedgersAreIsolated(t *testing.T) {
+	conf := &basic.TransferConf{
+		AccountSplitNum: 2,
+		Namespaces: []*basic.NamespaceConf{
+			{Name: "coin"},
+			{Name: "points", TablePrefix: "pt_", OfficialAccountStep: 100, OfficialAccountMin: 1, OfficialAccountMax: 1000},
+		},
+	}
+	openSQLite(t, conf)
+	ledgers, err := NewLedgers(conf)
+	if err != nil {
+		t.Fatalf("failed to create ledgers: %v", err)
+	}
+	coin, _ := ledgers.Namespace("coin")
+	points, _ := ledgers.Namespace("points")
+	if balance := recharge(t, coin, 1, 10000000, 10); balance != 10 {
+		t.Fatalf("coin balance got %d want 10", balance)
+	}
+	//转移ID与coin相同，命名空间之间不冲突
+	if balance := recharge(t, points, 1, 100, 7); balance != 7 {
+		t.Fatalf("points balance got %d want 7", balance)
+	}
+	ctx := context.Background()
+	//10000000在points中不是官方账户，没有余额
+	err = ledgers.Transfer(ctx, "points", &model.TransferReq{
+		TransferId:    2,
+		TransferScene: transferScene,
+		FromAccounts:  []*model.TransferItem{{AccountId: 10000000, ItemType: itemTypeGold, Amount: 1, ChangeType: changeType}},
+		ToAccounts:    []*model.TransferItem{{AccountId: userAccount, ItemType: itemTypeGold, Amount: 1, ChangeType: changeType}},
+	})
+	if err == nil {
+		t.Fatalf("expect insufficient amount in points")
+	}
+	if balance, _ := coin.GetAccountAmountByItemTypeWrite(ctx, userAccount, itemTypeGold); balance != 10 {
+		t.Fatalf("coin balance got %d want 10", balance)
+	}
+	if err = ledgers.Transfer(ctx, "sandbox", &model.TransferReq{}); err == nil {
+		t.Fatalf("expect error for unknown namespace")
+	}
+	if errs := ledgers.Inspection(ctx, 0); len(errs) != 0 {
+		t.Fatalf("inspection failed: %v", errs)
+	}
+}
+
+func TestNewLedgersInvalidConf(t *testing.T) {
+	for name, namespaces := range map[string][]*basic.NamespaceConf{
+		"duplicated name":   {{Name: "coin"}, {Name: "coin", TablePrefix: "c_"}},
+		"duplicated prefix": {{Name: "coin", TablePrefix: "x_"}, {Name: "points", TablePrefix: "x_"}},
+		"invalid prefix":    {{Name: "coin", TablePrefix: "coin;"}},
+	} {
+		if _, err := NewLedgers(&basic.TransferConf{Namespaces: namespaces}); err == nil {
+			t.Fatalf("expect error for %s", name)
+		}
+	}
+	if _, err := NewLedgers(&basic.TransferConf{Namespaces: []*basic.NamespaceConf{{Name: "coin"}}}, WithStore(memory.NewStore())); err == nil {
+		t.Fatalf("expect error for shared store")
+	}
+}
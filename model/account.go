@@ -3,18 +3,25 @@ package model
 import "github.com/zjn-zjn/fisher/basic"
 
 const (
-	AccountTablePrefix = "account"
+	AccountTablePrefix = basic.AccountTablePrefix
 )
 
 type Account struct {
-	ID        int64          `json:"id" gorm:"column:id;"`                                     // 主键
-	AccountId int64          `json:"account_id" gorm:"column:account_id;"`                     // 账户ID
-	ItemType  basic.ItemType `json:"item_type" gorm:"column:item_type;"`                       // 转移物品类型
-	Amount    int64          `json:"amount" gorm:"column:amount;"`                             // 数量
-	CreatedAt int64          `json:"created_at" gorm:"column:created_at;autoCreateTime:milli"` // 创建时间
-	UpdatedAt int64          `json:"updated_at" gorm:"column:updated_at;autoUpdateTime:milli"` // 创建时间
+	ID           int64          `json:"id" gorm:"column:id;"`                                     // 主键
+	AccountId    int64          `json:"account_id" gorm:"column:account_id;"`                     // 账户ID
+	ItemType     basic.ItemType `json:"item_type" gorm:"column:item_type;"`                       // 转移物品类型
+	Amount       int64          `json:"amount" gorm:"column:amount;"`                             // 数量
+	FrozenAmount int64          `json:"frozen_amount" gorm:"column:frozen_amount;"`               // 冻结数量，包含在数量中
+	Sequence     int64          `json:"sequence" gorm:"column:sequence;"`                         // 数量变更序号，每次变更数量加1
+	CreatedAt    int64          `json:"created_at" gorm:"column:created_at;autoCreateTime:milli"` // 创建时间
+	UpdatedAt    int64          `json:"updated_at" gorm:"column:updated_at;autoUpdateTime:milli"` // 创建时间
 }
 
 func GetAccountTableName(accountId int64) string {
-	return AccountTablePrefix + basic.GetAccountTableSuffix(accountId)
+	return basic.GetLayout().GetAccountTableName(accountId)
+}
+
+// GetAvailableAmount 可用数量，即数量减去冻结数量
+func (a *Account) GetAvailableAmount() int64 {
+	return a.Amount - a.FrozenAmount
 }
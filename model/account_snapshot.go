@@ -0,0 +1,26 @@
+package model
+
+import "github.com/zjn-zjn/fisher/basic"
+
+const (
+	AccountSnapshotTablePrefix = basic.AccountSnapshotTablePrefix
+)
+
+// AccountSnapshot 账户在截止时间的数量快照
+type AccountSnapshot struct {
+	ID        int64          `json:"id" gorm:"column:id;"`                                     // 主键
+	AccountId int64          `json:"account_id" gorm:"column:account_id;"`                     // 账户ID
+	ItemType  basic.ItemType `json:"item_type" gorm:"column:item_type;"`                       // 物品类型
+	CutOff    int64          `json:"cut_off" gorm:"column:cut_off;"`                           // 截止时间 毫秒 包含该时刻的变更
+	Amount    int64          `json:"amount" gorm:"column:amount;"`                             // 截止时的数量
+	Sequence  int64          `json:"sequence" gorm:"column:sequence;"`                         // 截止时的数量变更序号
+	CreatedAt int64          `json:"created_at" gorm:"column:created_at;autoCreateTime:milli"` // 创建时间
+	UpdatedAt int64          `json:"updated_at" gorm:"column:updated_at;autoUpdateTime:milli"` // 更新时间
+}
+
+// SnapshotReport 快照任务的执行结果
+type SnapshotReport struct {
+	CutOff  int64 `json:"cut_off"` // 截止时间
+	Created int64 `json:"created"` // 本次写入的快照数
+	Skipped int64 `json:"skipped"` // 已存在而跳过的快照数，任务中断后重新执行时跳过已完成的部分
+}
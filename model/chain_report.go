@@ -0,0 +1,22 @@
+package model
+
+import "github.com/zjn-zjn/fisher/basic"
+
+// ChainReport 账户物品记录哈希链的校验结果
+type ChainReport struct {
+	AccountId int64          `json:"account_id"` // 账户ID
+	ItemType  basic.ItemType `json:"item_type"`  // 物品类型
+	Verified  int64          `json:"verified"`   // 校验通过的链上环数
+	Records   int64          `json:"records"`    // 与链上最新一环一致的记录数，链完整时才统计
+	Head      string         `json:"head"`       // 最后一环的哈希，定期保存到外部可发现链尾的删除
+	Unchained int64          `json:"unchained"`  // 不在链上的记录数，启用哈希链前写入的或绕过应用写入的，链完整时才统计
+	Broken    *ChainBreak    `json:"broken"`     // 第一处断裂，nil表示链完整
+}
+
+// ChainBreak 哈希链的断裂处
+type ChainBreak struct {
+	Chain    *RecordChain           `json:"chain"`     // 断裂处的环，链上序号不连续时为实际读到的环
+	Record   *Record                `json:"record"`    // 断裂处的环对应的记录，记录已删除时为空
+	ChainSeq int64                  `json:"chain_seq"` // 期望的链上序号
+	Reason   basic.ChainBreakReason `json:"reason"`    // 断裂的原因
+}
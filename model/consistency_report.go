@@ -0,0 +1,27 @@
+package model
+
+import "github.com/zjn-zjn/fisher/basic"
+
+// ConsistencyReport 转移状态与记录的一致性检查结果
+type ConsistencyReport struct {
+	Start        int64            `json:"start"`        // 检查的转移创建时间起点(含) 毫秒
+	End          int64            `json:"end"`          // 检查的转移创建时间终点(不含) 毫秒
+	Checked      int              `json:"checked"`      // 检查的转移数量
+	Inconsistent []*TransferCheck `json:"inconsistent"` // 不一致的转移
+}
+
+// TransferCheck 单个转移的一致性检查结果
+// 进行中(转移中、回滚中)的转移各操作可能只执行了一部分，由Inspection推进，视为一致
+type TransferCheck struct {
+	Detail     *TransferDetail `json:"detail"`     // 转移详情
+	Consistent bool            `json:"consistent"` // 是否一致
+	Issues     []*LegIssue     `json:"issues"`     // 不一致的操作
+}
+
+// LegIssue 转移中单个账户操作与转移状态的不一致
+type LegIssue struct {
+	Leg          *TransferLeg             `json:"leg"`           // 不一致的操作
+	TransferType basic.TransferType       `json:"transfer_type"` // 操作的记录类型 付款方为扣减，收款方为增加
+	Reason       basic.InconsistentReason `json:"reason"`        // 不一致的原因
+	Repair       basic.RepairType         `json:"repair"`        // 修复时将执行的动作
+}
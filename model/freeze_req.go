@@ -0,0 +1,36 @@
+package model
+
+import "github.com/zjn-zjn/fisher/basic"
+
+// FreezeReq 冻结请求，同一账户、转移ID、场景、物品类型和变更类型只能冻结一次
+type FreezeReq struct {
+	TransferId    int64               `json:"transfer_id"`    // 转移ID
+	TransferScene basic.TransferScene `json:"transfer_scene"` // 转移场景
+	AccountId     int64               `json:"account_id"`     // 冻结账户
+	ItemType      basic.ItemType      `json:"item_type"`      // 冻结币种
+	Amount        int64               `json:"amount"`         // 冻结金额
+	ChangeType    basic.ChangeType    `json:"change_type"`    // 变更类型
+	Comment       string              `json:"comment"`        // 冻结备注
+	ExpireAt      int64               `json:"expire_at"`      // 过期时间 毫秒时间戳，大于0时为预授权，过期未扣款由Inspection自动解冻
+}
+
+// UnfreezeReq 解冻请求，按冻结时的参数定位冻结
+type UnfreezeReq struct {
+	TransferId    int64               `json:"transfer_id"`    // 转移ID
+	TransferScene basic.TransferScene `json:"transfer_scene"` // 转移场景
+	AccountId     int64               `json:"account_id"`     // 冻结账户
+	ItemType      basic.ItemType      `json:"item_type"`      // 冻结币种
+	ChangeType    basic.ChangeType    `json:"change_type"`    // 变更类型
+}
+
+// CaptureReq 扣款请求，将冻结的金额全部转给ToAccounts，转移ID和场景与冻结相同
+type CaptureReq struct {
+	TransferId     int64               `json:"transfer_id"`      // 转移ID
+	TransferScene  basic.TransferScene `json:"transfer_scene"`   // 转移场景
+	AccountId      int64               `json:"account_id"`       // 冻结账户
+	ItemType       basic.ItemType      `json:"item_type"`        // 冻结币种
+	ChangeType     basic.ChangeType    `json:"change_type"`      // 变更类型
+	ToAccounts     []*TransferItem     `json:"to_accounts"`      // 转移接收者，合计需等于冻结金额
+	UseHalfSuccess bool                `json:"use_half_success"` // 是否使用半成功，同TransferReq
+	Comment        string              `json:"comment"`          // 转移备注
+}
@@ -0,0 +1,6 @@
+package model
+
+// InspectionReport 检查推进的结果
+type InspectionReport struct {
+	Released []*Record `json:"released"` // 本次因过期自动解冻的冻结记录
+}
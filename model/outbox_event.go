@@ -0,0 +1,39 @@
+package model
+
+import "github.com/zjn-zjn/fisher/basic"
+
+const (
+	OutboxTablePrefix = basic.OutboxTablePrefix
+)
+
+// OutboxEvent 转移状态变更事件，与状态变更在同一本地事务内写入，由RelayOutbox投递给下游
+type OutboxEvent struct {
+	ID            int64               `json:"id" gorm:"column:id;"`                                     // 主键
+	TransferId    int64               `json:"transfer_id" gorm:"column:transfer_id;"`                   // 转移ID
+	TransferScene basic.TransferScene `json:"transfer_scene" gorm:"column:transfer_scene;"`             // 转移场景
+	FromStatus    basic.StateStatus   `json:"from_status" gorm:"column:from_status;"`                   // 变更前的转移状态 直接创建为该状态时为0
+	ToStatus      basic.StateStatus   `json:"to_status" gorm:"column:to_status;"`                       // 变更后的转移状态
+	Status        basic.OutboxStatus  `json:"status" gorm:"column:status;"`                             // 投递状态
+	Attempts      int                 `json:"attempts" gorm:"column:attempts;"`                         // 投递失败次数
+	LastError     string              `json:"last_error" gorm:"column:last_error;"`                     // 最近一次投递失败的原因
+	CreatedAt     int64               `json:"created_at" gorm:"column:created_at;autoCreateTime:milli"` // 创建时间
+	UpdatedAt     int64               `json:"updated_at" gorm:"column:updated_at;autoUpdateTime:milli"` // 更新时间
+}
+
+// RelayReport 一轮事件投递的结果
+type RelayReport struct {
+	Published int `json:"published"` // 投递成功的事件数
+	Failed    int `json:"failed"`    // 投递失败的事件数，下一轮重试
+	Deferred  int `json:"deferred"`  // 同一转移有更早的事件投递失败而推迟到下一轮的事件数
+}
+
+// AssembleOutboxEvent 组装待投递的转移状态变更事件
+func AssembleOutboxEvent(transferId int64, transferScene basic.TransferScene, fromStatus, toStatus basic.StateStatus) *OutboxEvent {
+	return &OutboxEvent{
+		TransferId:    transferId,
+		TransferScene: transferScene,
+		FromStatus:    fromStatus,
+		ToStatus:      toStatus,
+		Status:        basic.OutboxStatusPending,
+	}
+}
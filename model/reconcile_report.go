@@ -0,0 +1,30 @@
+package model
+
+import "github.com/zjn-zjn/fisher/basic"
+
+// ReconcileReport 零和对账结果
+type ReconcileReport struct {
+	Items     []*ReconcileItem `json:"items"`      // 按物品类型的对账结果，按物品类型排序
+	InFlight  []*State         `json:"in_flight"`  // 对账时仍在进行中的转移
+	CheckedAt int64            `json:"checked_at"` // 对账开始时间 毫秒
+}
+
+// ReconcileItem 单个物品类型的对账结果
+type ReconcileItem struct {
+	ItemType     basic.ItemType `json:"item_type"`     // 物品类型
+	AccountTotal int64          `json:"account_total"` // 全部账户数量之和
+	RecordTotal  int64          `json:"record_total"`  // 全部生效记录的变动之和，已回滚的记录正反抵消
+	InFlight     int64          `json:"in_flight"`     // 进行中的转移已生效的变动之和，转移完成或回滚后归零
+	Discrepancy  int64          `json:"discrepancy"`   // 真实差异，账户数量之和扣除进行中的变动后应为0
+	Mismatch     int64          `json:"mismatch"`      // 账户数量之和与记录变动之和的差，应为0
+}
+
+// HasDiscrepancy 是否存在真实差异，进行中的转移造成的非零不算差异
+func (r *ReconcileReport) HasDiscrepancy() bool {
+	for _, item := range r.Items {
+		if item.Discrepancy != 0 || item.Mismatch != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -3,24 +3,35 @@ package model
 import "github.com/zjn-zjn/fisher/basic"
 
 const (
-	RecordTablePrefix = "record"
+	RecordTablePrefix = basic.RecordTablePrefix
 )
 
 type Record struct {
-	ID             int64               `json:"id" gorm:"column:id;"`                                     // 主键
-	AccountId      int64               `json:"account_id" gorm:"column:account_id;"`                     // 账户ID
-	TransferId     int64               `json:"transfer_id" gorm:"column:transfer_id;"`                   // 转移ID
-	TransferScene  basic.TransferScene `json:"transfer_scene" gorm:"column:transfer_scene;"`             // 转移场景
-	TransferType   basic.TransferType  `json:"transfer_type" gorm:"column:transfer_type;"`               // 转移类型
-	TransferStatus basic.RecordStatus  `json:"transfer_status" gorm:"column:transfer_status;"`           // 转移状态
-	Amount         int64               `json:"amount" gorm:"column:amount;"`                             // 转移金额
-	ItemType       basic.ItemType      `json:"item_type" gorm:"column:item_type;"`                       // 转移币种
-	ChangeType     basic.ChangeType    `json:"change_type" gorm:"column:change_type;"`                   // 转移变化类型
-	Comment        string              `json:"comment" gorm:"column:comment;"`                           // 转移备注
-	CreatedAt      int64               `json:"created_at" gorm:"column:created_at;autoCreateTime:milli"` // 创建时间
-	UpdatedAt      int64               `json:"updated_at" gorm:"column:updated_at;autoUpdateTime:milli"` // 创建时间
+	ID                   int64               `json:"id" gorm:"column:id;"`                                         // 主键
+	AccountId            int64               `json:"account_id" gorm:"column:account_id;"`                         // 账户ID
+	TransferId           int64               `json:"transfer_id" gorm:"column:transfer_id;"`                       // 转移ID
+	TransferScene        basic.TransferScene `json:"transfer_scene" gorm:"column:transfer_scene;"`                 // 转移场景
+	TransferType         basic.TransferType  `json:"transfer_type" gorm:"column:transfer_type;"`                   // 转移类型
+	TransferStatus       basic.RecordStatus  `json:"transfer_status" gorm:"column:transfer_status;"`               // 转移状态
+	Amount               int64               `json:"amount" gorm:"column:amount;"`                                 // 转移金额
+	RefundedAmount       int64               `json:"refunded_amount" gorm:"column:refunded_amount;"`               // 已退款金额，不超过转移金额
+	ItemType             basic.ItemType      `json:"item_type" gorm:"column:item_type;"`                           // 转移币种
+	ChangeType           basic.ChangeType    `json:"change_type" gorm:"column:change_type;"`                       // 转移变化类型
+	Comment              string              `json:"comment" gorm:"column:comment;"`                               // 转移备注
+	ExpireAt             int64               `json:"expire_at" gorm:"column:expire_at;"`                           // 冻结过期时间 毫秒 0-不过期
+	BalanceAfter         int64               `json:"balance_after" gorm:"column:balance_after;"`                   // 操作后账户数量
+	Sequence             int64               `json:"sequence" gorm:"column:sequence;"`                             // 操作后账户数量变更序号，0-未变更数量
+	RollbackBalanceAfter int64               `json:"rollback_balance_after" gorm:"column:rollback_balance_after;"` // 回滚后账户数量，回滚在原记录上进行
+	RollbackSequence     int64               `json:"rollback_sequence" gorm:"column:rollback_sequence;"`           // 回滚后账户数量变更序号，0-未回滚或未变更数量
+	CreatedAt            int64               `json:"created_at" gorm:"column:created_at;autoCreateTime:milli"`     // 创建时间
+	UpdatedAt            int64               `json:"updated_at" gorm:"column:updated_at;autoUpdateTime:milli"`     // 创建时间
 }
 
 func GetRecordTableName(accountId int64) string {
-	return RecordTablePrefix + basic.GetRecordTableSuffix(accountId)
+	return basic.GetLayout().GetRecordTableName(accountId)
+}
+
+// IsExpired 冻结是否已在now(毫秒)过期
+func (r *Record) IsExpired(now int64) bool {
+	return r.ExpireAt > 0 && r.ExpireAt <= now
 }
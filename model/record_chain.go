@@ -0,0 +1,25 @@
+package model
+
+import "github.com/zjn-zjn/fisher/basic"
+
+const (
+	RecordChainTablePrefix = basic.RecordChainTablePrefix
+)
+
+// RecordChain 账户物品记录哈希链上的一环，记录每次写入(创建、回滚、扣款、解冻、退款累计、操作后数量)都在同一本地事务内追加一环
+// 记录会被原地更新，哈希放在记录上只能覆盖重算，因此单独只追加保存
+type RecordChain struct {
+	ID            int64               `json:"id" gorm:"column:id;"`                                     // 主键
+	AccountId     int64               `json:"account_id" gorm:"column:account_id;"`                     // 账户ID
+	ItemType      basic.ItemType      `json:"item_type" gorm:"column:item_type;"`                       // 物品类型
+	ChainSeq      int64               `json:"chain_seq" gorm:"column:chain_seq;"`                       // 链上序号，从1开始
+	TransferId    int64               `json:"transfer_id" gorm:"column:transfer_id;"`                   // 记录的转移ID
+	TransferScene basic.TransferScene `json:"transfer_scene" gorm:"column:transfer_scene;"`             // 记录的转移场景
+	TransferType  basic.TransferType  `json:"transfer_type" gorm:"column:transfer_type;"`               // 记录的转移类型
+	ChangeType    basic.ChangeType    `json:"change_type" gorm:"column:change_type;"`                   // 记录的变动类型
+	Digest        string              `json:"digest" gorm:"column:digest;"`                             // 写入后记录全部内容的摘要
+	PrevHash      string              `json:"prev_hash" gorm:"column:prev_hash;"`                       // 链上一环的哈希，第一环为空
+	Hash          string              `json:"hash" gorm:"column:hash;"`                                 // 本环内容和上一环哈希的哈希
+	CreatedAt     int64               `json:"created_at" gorm:"column:created_at;autoCreateTime:milli"` // 创建时间
+	UpdatedAt     int64               `json:"updated_at" gorm:"column:updated_at;autoUpdateTime:milli"` // 更新时间
+}
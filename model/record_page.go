@@ -0,0 +1,26 @@
+package model
+
+import "github.com/zjn-zjn/fisher/basic"
+
+// ListRecordReq 账户记录分页查询，筛选条件为nil或0时不筛选
+type ListRecordReq struct {
+	AccountId      int64                `json:"account_id"`       // 账户ID
+	ItemType       *basic.ItemType      `json:"item_type"`        // 物品类型
+	TransferScene  *basic.TransferScene `json:"transfer_scene"`   // 转移场景
+	ChangeType     *basic.ChangeType    `json:"change_type"`      // 变更类型
+	TransferType   *basic.TransferType  `json:"transfer_type"`    // 转移类型
+	TransferStatus *basic.RecordStatus  `json:"transfer_status"`  // 记录状态
+	StartTime      int64                `json:"start_time"`       // 创建时间下限 毫秒 包含
+	EndTime        int64                `json:"end_time"`         // 创建时间上限 毫秒 不包含
+	HideRolledBack bool                 `json:"hide_rolled_back"` // 不返回已回滚和空回滚的记录，回滚在原记录上更新状态，隐藏后该操作不出现在历史中
+	Cursor         int64                `json:"cursor"`           // 游标，上一页返回的NextCursor，0从头开始
+	Asc            bool                 `json:"asc"`              // 按创建时间正序(从旧到新)，默认倒序(从新到旧)
+	Limit          int                  `json:"limit"`            // 每页数量
+}
+
+// RecordPage 账户记录分页结果
+type RecordPage struct {
+	Records    []*Record `json:"records"`     // 记录
+	NextCursor int64     `json:"next_cursor"` // 下一页游标，为本页最后一条记录的ID
+	HasMore    bool      `json:"has_more"`    // 是否还有下一页
+}
@@ -0,0 +1,21 @@
+package model
+
+import "github.com/zjn-zjn/fisher/basic"
+
+// RefundReq 部分退款请求，按原转移的每条记录退还指定金额，按RefundId幂等
+type RefundReq struct {
+	RefundId      int64               `json:"refund_id"`      // 退款ID，作为退款转移的转移ID
+	RefundScene   basic.TransferScene `json:"refund_scene"`   // 退款场景，为0时使用原转移场景，此时退款ID与该场景下的转移ID共用
+	TransferId    int64               `json:"transfer_id"`    // 原转移ID
+	TransferScene basic.TransferScene `json:"transfer_scene"` // 原转移场景
+	Items         []*RefundItem       `json:"items"`          // 每条记录的退款金额，收款方扣回的合计需等于退给付款方的合计
+	Comment       string              `json:"comment"`        // 退款备注
+}
+
+// RefundItem 原转移中一条记录的退款金额，按账户、物品类型和变更类型定位原转移的付款方或收款方
+type RefundItem struct {
+	AccountId  int64            `json:"account_id"`  // 账户ID，官方账户可以使用类型账户ID
+	ItemType   basic.ItemType   `json:"item_type"`   // 物品类型
+	ChangeType basic.ChangeType `json:"change_type"` // 原转移的变更类型
+	Amount     int64            `json:"amount"`      // 退款金额
+}
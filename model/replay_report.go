@@ -0,0 +1,33 @@
+package model
+
+import "github.com/zjn-zjn/fisher/basic"
+
+// RecordTotal 账户指定物品按记录回放的结果
+type RecordTotal struct {
+	AccountId int64          `json:"account_id"` // 账户ID
+	ItemType  basic.ItemType `json:"item_type"`  // 物品类型
+	Records   int64          `json:"records"`    // 记录数，包括已回滚、空回滚和冻结记录
+	Amount    int64          `json:"amount"`     // 正常状态增减记录的变动之和，已回滚的记录正反抵消不计入
+	Frozen    int64          `json:"frozen"`     // 正常状态冻结记录的数量之和，已扣款和已解冻的不计入
+	Sequence  int64          `json:"sequence"`   // 记录中最大的数量变更序号，包括回滚
+}
+
+// ReplayReport 按记录重建账户数量的结果
+type ReplayReport struct {
+	Applied bool           `json:"applied"` // 是否已修正不一致的账户，为false时只对比
+	Checked int            `json:"checked"` // 检查的账户物品数
+	Diffs   []*AccountDiff `json:"diffs"`   // 与记录回放结果不一致的账户
+}
+
+// AccountDiff 账户数量与记录回放结果的差异
+type AccountDiff struct {
+	AccountId      int64          `json:"account_id"`      // 账户ID
+	ItemType       basic.ItemType `json:"item_type"`       // 物品类型
+	Missing        bool           `json:"missing"`         // 账户行不存在
+	LiveAmount     int64          `json:"live_amount"`     // 当前账户数量
+	ReplayAmount   int64          `json:"replay_amount"`   // 按记录回放的数量
+	LiveFrozen     int64          `json:"live_frozen"`     // 当前冻结数量
+	ReplayFrozen   int64          `json:"replay_frozen"`   // 按冻结记录回放的冻结数量
+	LiveSequence   int64          `json:"live_sequence"`   // 当前数量变更序号
+	ReplaySequence int64          `json:"replay_sequence"` // 记录中最大的数量变更序号
+}
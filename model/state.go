@@ -3,12 +3,13 @@ package model
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"fmt"
 
 	"github.com/zjn-zjn/fisher/basic"
 )
 
 const (
-	StateTablePrefix = "state"
+	StateTablePrefix = basic.StateTablePrefix
 )
 
 type State struct {
@@ -26,10 +27,7 @@ type State struct {
 type AccountList []*TransferItem
 
 func GetStateTableName(transferId int64) string {
-	if basic.GetStateTableSplitNum() == 1 {
-		return StateTablePrefix
-	}
-	return StateTablePrefix + basic.GetStateTableSuffix(transferId)
+	return basic.GetLayout().GetStateTableName(transferId)
 }
 
 func AssembleState(fromAccounts, toAccounts []*TransferItem, transferId int64, transferScene basic.TransferScene, status basic.StateStatus, comment string) *State {
@@ -53,7 +51,16 @@ func AssembleState(fromAccounts, toAccounts []*TransferItem, transferId int64, t
 }
 
 func (m *AccountList) Scan(val interface{}) error {
-	s := val.([]uint8)
+	var s []byte
+	switch v := val.(type) {
+	case []byte:
+		s = v
+	case string:
+		//PostgreSQL的json/jsonb列可能以字符串返回
+		s = []byte(v)
+	default:
+		return fmt.Errorf("unsupported account list type: %T", val)
+	}
 	var toAccounts AccountList
 	err := json.Unmarshal(s, &toAccounts)
 	if err != nil {
@@ -67,3 +74,58 @@ func (m AccountList) Value() (driver.Value, error) {
 	result, _ := json.Marshal(m)
 	return string(result), nil
 }
+
+// DiffAccounts 比较已有转移与请求的付款方和收款方，按账户、物品类型和变更类型对应，不比较备注，无差异时返回空
+func (m *State) DiffAccounts(fromAccounts, toAccounts []*TransferItem) []string {
+	diff := diffAccountList("from", m.FromAccounts, fromAccounts)
+	return append(diff, diffAccountList("to", m.ToAccounts, toAccounts)...)
+}
+
+type accountItemKey struct {
+	accountId  int64
+	itemType   basic.ItemType
+	changeType basic.ChangeType
+}
+
+func diffAccountList(side string, stored, requested []*TransferItem) []string {
+	var diff []string
+	requestedMap := make(map[accountItemKey]*TransferItem, len(requested))
+	for _, item := range requested {
+		requestedMap[accountItemKey{item.AccountId, item.ItemType, item.ChangeType}] = item
+	}
+	storedKeys := make(map[accountItemKey]bool, len(stored))
+	for _, item := range stored {
+		key := accountItemKey{item.AccountId, item.ItemType, item.ChangeType}
+		storedKeys[key] = true
+		other, ok := requestedMap[key]
+		if !ok {
+			diff = append(diff, fmt.Sprintf("%s %s missing in request", side, describeItem(item)))
+			continue
+		}
+		if desc, otherDesc := describeLeg(item), describeLeg(other); desc != otherDesc {
+			diff = append(diff, fmt.Sprintf("%s %s: stored %s, requested %s", side, describeItem(item), desc, otherDesc))
+		}
+	}
+	for _, item := range requested {
+		if !storedKeys[accountItemKey{item.AccountId, item.ItemType, item.ChangeType}] {
+			diff = append(diff, fmt.Sprintf("%s %s not in stored transfer", side, describeItem(item)))
+		}
+	}
+	return diff
+}
+
+func describeItem(item *TransferItem) string {
+	return fmt.Sprintf("account %d item type %d change type %d", item.AccountId, item.ItemType, item.ChangeType)
+}
+
+// describeLeg 参与比较的字段
+func describeLeg(item *TransferItem) string {
+	desc := fmt.Sprintf("amount %d", item.Amount)
+	if item.Frozen {
+		desc += " frozen"
+	}
+	if item.Refund != nil {
+		desc += fmt.Sprintf(" refund of %d-%d-%d", item.Refund.TransferId, item.Refund.TransferScene, item.Refund.TransferType)
+	}
+	return desc
+}
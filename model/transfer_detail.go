@@ -0,0 +1,32 @@
+package model
+
+import "github.com/zjn-zjn/fisher/basic"
+
+// TransferDetail 转移详情，包括转移状态和每个账户操作的记录
+type TransferDetail struct {
+	State        *State         `json:"state"`         // 转移状态
+	FromAccounts []*TransferLeg `json:"from_accounts"` // 付款方的操作
+	ToAccounts   []*TransferLeg `json:"to_accounts"`   // 收款方的操作
+}
+
+// TransferLeg 转移中单个账户的操作，回滚与正向操作是同一条记录，回滚后记录状态变化
+type TransferLeg struct {
+	Item         *TransferItem   `json:"item"`          // 转移状态中的账户信息
+	Record       *Record         `json:"record"`        // 操作记录，未执行时为空
+	FreezeRecord *Record         `json:"freeze_record"` // 扣款对应的冻结记录，仅从冻结中扣减时有
+	Status       basic.LegStatus `json:"status"`        // 操作状态
+}
+
+// GetLegStatus 根据操作记录计算操作状态
+func GetLegStatus(record *Record) basic.LegStatus {
+	if record == nil {
+		return basic.LegStatusPending
+	}
+	switch record.TransferStatus {
+	case basic.RecordStatusRollback:
+		return basic.LegStatusRolledBack
+	case basic.RecordStatusEmptyRollback:
+		return basic.LegStatusEmptyRollback
+	}
+	return basic.LegStatusDone
+}
@@ -17,4 +17,13 @@ type TransferItem struct {
 	Amount     int64            `json:"amount"`      // 接收金额
 	ChangeType basic.ChangeType `json:"change_type"` // 变更类型
 	Comment    string           `json:"comment"`     // 转移备注
+	Frozen     bool             `json:"frozen"`      // 从冻结中扣减，仅由Capture设置
+	Refund     *RefundOf        `json:"refund"`      // 退款对应的原转移记录，仅由Refund设置
+}
+
+// RefundOf 退款对应的原转移记录，退款时累加原记录的已退款金额
+type RefundOf struct {
+	TransferId    int64               `json:"transfer_id"`    // 原转移ID
+	TransferScene basic.TransferScene `json:"transfer_scene"` // 原转移场景
+	TransferType  basic.TransferType  `json:"transfer_type"`  // 原记录的转移类型
 }
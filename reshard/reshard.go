@@ -0,0 +1,234 @@
+// Package reshard 在线调整分库数量和分表数量
+//
+// 迁移流程:
+//
+//	m, _ := reshard.NewMigrator(targetConf)
+//	m.Prepare(ctx)            //在目标库上建表
+//	m.StartDualWrite()        //开始双写，读写以当前布局为准，写入的行同步到目标布局
+//	m.Backfill(ctx)           //复制存量数据
+//	m.Verify(ctx, true)       //校验并修复不一致的行
+//	m.Freeze()                //阻塞读写
+//	m.Verify(ctx, true)       //冻结后再次校验，同步失败的行只记录在进程内，重启会丢失，Cutover要求冻结后校验通过
+//	m.Cutover(ctx)            //切换到目标布局，旧布局作为影子布局反向同步，可随时Abort回退
+//	m.Unfreeze()
+//	m.Finish(ctx)             //停止双写并清理旧布局中已迁移的行
+//
+// 布局保存在进程内，多实例部署时每个实例都需要执行StartDualWrite、Cutover、Finish，
+// 可以先在全部实例上Freeze，再依次校验、切换后Unfreeze，保证切换期间没有实例使用旧布局写入
+package reshard
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/dao"
+	"github.com/zjn-zjn/fisher/schema"
+)
+
+const DefaultBatchSize = 500 //默认每批迁移的行数
+
+// Report 迁移各步骤的结果，每张源表一条
+type Report struct {
+	Results []*dao.ReshardResult
+}
+
+// Mismatched 校验不一致的总行数
+func (r *Report) Mismatched() int64 {
+	var n int64
+	for _, result := range r.Results {
+		n += result.Mismatched
+	}
+	return n
+}
+
+// Migrator 将当前布局迁移到目标配置对应的布局
+type Migrator struct {
+	layouts   *basic.LayoutManager
+	conf      *basic.TransferConf
+	from      *basic.Layout
+	to        *basic.Layout
+	BatchSize int //每批迁移的行数，小于等于0时使用DefaultBatchSize
+	frozen    func()
+	verified  bool //本次冻结后双写期间校验通过，Cutover的前提
+}
+
+// NewMigrator 创建迁移，源布局为basic包级初始化的当前布局，conf为目标配置，只使用其中的库、分表数量和路由
+// 与源布局共用的库需传入同一个*gorm.DB，迁移按连接判断行是否需要移动
+func NewMigrator(conf *basic.TransferConf) (*Migrator, error) {
+	return NewMigratorWithLayouts(basic.GetDefaultLayoutManager(), conf)
+}
+
+// NewMigratorWithLayouts 迁移指定布局管理的布局，用于通过service.New创建的客户端
+func NewMigratorWithLayouts(layouts *basic.LayoutManager, conf *basic.TransferConf) (*Migrator, error) {
+	if conf == nil {
+		return nil, errors.New("conf is nil")
+	}
+	if len(conf.DBs) == 0 {
+		return nil, errors.New("db is nil")
+	}
+	if layouts.GetShadowLayout() != nil {
+		return nil, errors.New("another reshard is in progress")
+	}
+	if conf.TablePrefix != layouts.GetLayout().GetTablePrefix() {
+		return nil, errors.New("table prefix can not be changed by reshard")
+	}
+	to, err := basic.NewLayout(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{layouts: layouts, conf: conf, from: layouts.GetLayout(), to: to}, nil
+}
+
+func (m *Migrator) batchSize() int {
+	if m.BatchSize <= 0 {
+		return DefaultBatchSize
+	}
+	return m.BatchSize
+}
+
+// Prepare 在目标布局的每个库上建表
+func (m *Migrator) Prepare(ctx context.Context) error {
+	return schema.Apply(ctx, m.conf)
+}
+
+// Freeze 阻塞本实例的读写并等待进行中的操作结束，Cutover前需冻结并校验
+func (m *Migrator) Freeze() {
+	m.frozen = m.layouts.FreezeLayout()
+	m.verified = false
+}
+
+// Unfreeze 解除Freeze，之后Cutover需重新冻结并校验
+func (m *Migrator) Unfreeze() {
+	if m.frozen != nil {
+		m.frozen()
+		m.frozen = nil
+	}
+	m.verified = false
+}
+
+// switchLayout 切换布局，已Freeze时直接切换
+func (m *Migrator) switchLayout(layout, shadow *basic.Layout) {
+	if m.frozen == nil {
+		defer m.layouts.FreezeLayout()()
+	}
+	m.layouts.SwitchLayout(layout, shadow)
+}
+
+// StartDualWrite 开始双写，之后写入源布局的行都会同步到目标布局
+func (m *Migrator) StartDualWrite() {
+	m.switchLayout(m.from, m.to)
+}
+
+// Backfill 将源布局的存量数据复制到目标布局，需在StartDualWrite后执行，可重复执行
+func (m *Migrator) Backfill(ctx context.Context) (*Report, error) {
+	return m.eachTable(m.from, func(dbIdx int64, table *basic.Table) (*dao.ReshardResult, error) {
+		return dao.CopyTable(ctx, m.from, m.to, dbIdx, table, m.batchSize())
+	})
+}
+
+// Verify 校验源布局的每一行在目标布局中是否一致，以及目标布局中是否有源布局不存在的行，repair为true时重新同步不一致的行并删除多出的行
+// 冻结期间双写中校验通过(没有不一致或全部修复)后才允许Cutover
+func (m *Migrator) Verify(ctx context.Context, repair bool) (*Report, error) {
+	report, err := m.eachTable(m.from, func(dbIdx int64, table *basic.Table) (*dao.ReshardResult, error) {
+		return dao.VerifyTable(ctx, m.from, m.to, dbIdx, table, m.batchSize(), repair)
+	})
+	if err == nil {
+		//目标布局中多出的行，例如双写期间删除的行
+		var target *Report
+		target, err = m.eachTable(m.to, func(dbIdx int64, table *basic.Table) (*dao.ReshardResult, error) {
+			return dao.VerifyTargetTable(ctx, m.from, m.to, dbIdx, table, m.batchSize(), repair)
+		})
+		report.Results = append(report.Results, target.Results...)
+	}
+	if m.frozen != nil && m.dualWriting() {
+		m.verified = err == nil && (repair || report.Mismatched() == 0)
+	}
+	return report, err
+}
+
+func (m *Migrator) dualWriting() bool {
+	return m.layouts.GetLayout() == m.from && m.layouts.GetShadowLayout() == m.to
+}
+
+// Cutover 切换到目标布局，切换前补齐同步失败的行，之后旧布局作为影子布局反向同步
+// 同步失败的行只记录在进程内，实例重启后会丢失，因此要求Freeze后Verify通过，否则拒绝切换
+func (m *Migrator) Cutover(ctx context.Context) error {
+	if m.frozen == nil {
+		return errors.New("cutover requires Freeze and a clean Verify")
+	}
+	if !m.dualWriting() {
+		return errors.New("dual write is not started")
+	}
+	if !m.verified {
+		return errors.New("cutover requires a clean Verify after Freeze")
+	}
+	if err := m.syncDirtyRows(ctx); err != nil {
+		return err
+	}
+	m.layouts.SwitchLayout(m.to, m.from)
+	m.verified = false
+	return nil
+}
+
+// Finish 停止双写并清理源布局中已迁移到其他位置的行，需在Cutover后执行
+func (m *Migrator) Finish(ctx context.Context) (*Report, error) {
+	if err := m.stopDualWrite(ctx, m.to); err != nil {
+		return nil, err
+	}
+	return m.eachTable(m.from, func(dbIdx int64, table *basic.Table) (*dao.ReshardResult, error) {
+		return dao.PurgeTable(ctx, m.from, m.to, dbIdx, table, m.batchSize())
+	})
+}
+
+// Abort 放弃迁移并回到源布局，Finish后不可再回退，目标布局中已写入的数据需自行清理
+func (m *Migrator) Abort(ctx context.Context) error {
+	return m.stopDualWrite(ctx, m.from)
+}
+
+func (m *Migrator) stopDualWrite(ctx context.Context, layout *basic.Layout) error {
+	if m.frozen == nil {
+		defer m.layouts.FreezeLayout()()
+	}
+	if m.layouts.GetLayout() != layout {
+		//切回另一侧布局前补齐同步失败的行
+		if err := m.syncDirtyRows(ctx); err != nil {
+			return err
+		}
+	}
+	dao.ClearDirtyRows(m.layouts)
+	m.layouts.SwitchLayout(layout, nil)
+	return nil
+}
+
+func (m *Migrator) syncDirtyRows(ctx context.Context) error {
+	remain, err := dao.SyncDirtyRowsFrozen(ctx, m.layouts)
+	if err != nil {
+		return errors.Wrapf(err, "[fisher] %d rows are not synced to shadow layout", remain)
+	}
+	if remain != 0 {
+		return errors.Errorf("[fisher] %d rows are not synced to shadow layout", remain)
+	}
+	return nil
+}
+
+// eachTable 依次处理layout布局中的每张表
+func (m *Migrator) eachTable(layout *basic.Layout, fn func(dbIdx int64, table *basic.Table) (*dao.ReshardResult, error)) (*Report, error) {
+	report := &Report{}
+	for _, spec := range []*basic.TableSpec{basic.StateTableSpec, basic.RecordTableSpec, basic.RecordChainTableSpec, basic.AccountTableSpec, basic.AccountSnapshotTableSpec, basic.OutboxTableSpec} {
+		tables := basic.GetPrefixedSplitTables(layout.GetTablePrefix(), spec, layout.GetShardTableSplitNum(spec.Kind))
+		for i := int64(0); i < layout.GetShardDBNum(spec.Kind); i++ {
+			for _, table := range tables {
+				result, err := fn(i, table)
+				if result != nil {
+					report.Results = append(report.Results, result)
+				}
+				if err != nil {
+					return report, err
+				}
+			}
+		}
+	}
+	return report, nil
+}
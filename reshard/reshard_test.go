@@ -0,0 +1,245 @@
+package reshard
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/dao"
+	"github.com/zjn-zjn/fisher/model"
+	"github.com/zjn-zjn/fisher/schema"
+	"github.com/zjn-zjn/fisher/service"
+)
+
+const (
+	itemTypeGold  basic.ItemType      = 1
+	transferScene basic.TransferScene = 1
+	changeType    basic.ChangeType    = 1
+	bankAccount                       = int64(10000000)
+	userAccount                       = int64(100000000000)
+)
+
+func openSQLite(t *testing.T, name string) *gorm.DB {
+	dsn := filepath.Join(t.TempDir(), name) + "?_busy_timeout=5000&_txlock=immediate"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	return db
+}
+
+func transfer(t *testing.T, transferId, from, to, amount int64) {
+	t.Helper()
+	err := service.Transfer(context.Background(), &model.TransferReq{
+		TransferId:    transferId,
+		TransferScene: transferScene,
+		FromAccounts:  []*model.TransferItem{{AccountId: from, ItemType: itemTypeGold, Amount: amount, ChangeType: changeType}},
+		ToAccounts:    []*model.TransferItem{{AccountId: to, ItemType: itemTypeGold, Amount: amount, ChangeType: changeType}},
+	})
+	if err != nil {
+		t.Fatalf("failed to transfer %d: %v", transferId, err)
+	}
+}
+
+func assertAmount(t *testing.T, accountId, want int64) {
+	t.Helper()
+	for _, read := range []func(context.Context, int64, basic.ItemType) (int64, error){
+		service.GetAccountAmountByItemTypeWrite, service.GetAccountAmountByItemTypeRead,
+	} {
+		amount, err := read(context.Background(), accountId, itemTypeGold)
+		if err != nil {
+			t.Fatalf("failed to get amount of %d: %v", accountId, err)
+		}
+		if amount != want {
+			t.Fatalf("account %d amount got %d want %d", accountId, amount, want)
+		}
+	}
+}
+
+func count(t *testing.T, db *gorm.DB, table string, conds ...interface{}) int64 {
+	t.Helper()
+	var n int64
+	tx := db.Table(table)
+	if len(conds) != 0 {
+		tx = tx.Where(conds[0], conds[1:]...)
+	}
+	if err := tx.Count(&n).Error; err != nil {
+		t.Fatalf("failed to count %s: %v", table, err)
+	}
+	return n
+}
+
+// publishAll 接收全部事件
+type publishAll struct{}
+
+func (publishAll) Publish(ctx context.Context, event *model.OutboxEvent) error {
+	return nil
+}
+
+func TestReshard(t *testing.T) {
+	ctx := context.Background()
+	db0, db1 := openSQLite(t, "fisher0.db"), openSQLite(t, "fisher1.db")
+	conf := &basic.TransferConf{DBs: []*gorm.DB{db0}}
+	if err := schema.Apply(ctx, conf); err != nil {
+		t.Fatalf("failed to create tables: %v", err)
+	}
+	dao.SetStore(dao.NewGormStore())
+	if err := basic.InitWithConf(conf); err != nil {
+		t.Fatalf("failed to init conf: %v", err)
+	}
+	for i := int64(1); i <= 6; i++ {
+		transfer(t, i, bankAccount, userAccount+i, 1000)
+	}
+
+	//单库单表迁移到两库两表
+	m, err := NewMigrator(&basic.TransferConf{DBs: []*gorm.DB{db0, db1}, StateSplitNum: 2, RecordSplitNum: 2, AccountSplitNum: 2})
+	if err != nil {
+		t.Fatalf("failed to create migrator: %v", err)
+	}
+	m.BatchSize = 4
+	if err = m.Prepare(ctx); err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+	m.StartDualWrite()
+	transfer(t, 101, userAccount+1, userAccount+2, 100)
+	if _, err = m.Backfill(ctx); err != nil {
+		t.Fatalf("failed to backfill: %v", err)
+	}
+	transfer(t, 102, userAccount+3, userAccount+4, 50)
+	report, err := m.Verify(ctx, false)
+	if err != nil {
+		t.Fatalf("failed to verify: %v", err)
+	}
+	if report.Mismatched() != 0 {
+		t.Fatalf("expect no mismatch after backfill, got %d", report.Mismatched())
+	}
+	//双写期间分页查询只使用当前布局的游标，翻到最后一页后不再返回影子布局的行
+	page, err := service.ListAccountRecords(ctx, &model.ListRecordReq{AccountId: userAccount + 1, Limit: 2})
+	if err != nil || len(page.Records) != 2 || page.HasMore {
+		t.Fatalf("expect 2 records of account during dual write, got %+v %v", page, err)
+	}
+	if page, err = service.ListAccountRecords(ctx, &model.ListRecordReq{AccountId: userAccount + 1, Cursor: page.NextCursor, Limit: 2}); err != nil || len(page.Records) != 0 {
+		t.Fatalf("expect no record after last page during dual write, got %+v %v", page, err)
+	}
+	//双写期间删除的行同步删除
+	if _, err = service.RelayOutbox(ctx, publishAll{}); err != nil {
+		t.Fatalf("failed to relay outbox: %v", err)
+	}
+	if n, err := service.PurgeOutboxEvents(ctx, time.Now().UnixMilli()+1); err != nil || n == 0 {
+		t.Fatalf("failed to purge outbox events: %d %v", n, err)
+	}
+	for _, db := range []*gorm.DB{db0, db1} {
+		for _, table := range []string{"outbox_0", "outbox_1"} {
+			if n := count(t, db, table); n != 0 {
+				t.Fatalf("expect purged events deleted from target %s, got %d rows", table, n)
+			}
+		}
+	}
+	//目标布局中多出的行计为不一致，修复时删除
+	if err = db1.Exec("INSERT INTO outbox_1 (transfer_id, transfer_scene, from_status, to_status, status, attempts, last_error, created_at, updated_at) VALUES (999, 1, 0, 4, 1, 0, '', 0, 0)").Error; err != nil {
+		t.Fatalf("failed to insert extra row: %v", err)
+	}
+	if report, err = m.Verify(ctx, true); err != nil || report.Mismatched() != 1 {
+		t.Fatalf("expect 1 extra row, got %d %v", report.Mismatched(), err)
+	}
+	if n := count(t, db1, "outbox_1"); n != 0 {
+		t.Fatalf("expect extra row deleted, got %d rows", n)
+	}
+	//未冻结校验时拒绝切换
+	if err = m.Cutover(ctx); err == nil {
+		t.Fatalf("expect cutover refused without freeze")
+	}
+	//模拟实例重启丢失了同步失败的行：源布局上的变更未同步到目标布局
+	if err = db0.Exec("UPDATE account SET amount = amount + 7 WHERE account_id = ?", userAccount+5).Error; err != nil {
+		t.Fatalf("failed to update source account: %v", err)
+	}
+	m.Freeze()
+	if err = m.Cutover(ctx); err == nil {
+		t.Fatalf("expect cutover refused without verify after freeze")
+	}
+	if report, err = m.Verify(ctx, false); err != nil || report.Mismatched() != 1 {
+		t.Fatalf("expect 1 mismatch for lost row, got %v %v", report.Mismatched(), err)
+	}
+	if err = m.Cutover(ctx); err == nil {
+		t.Fatalf("expect cutover refused with mismatch")
+	}
+	if _, err = m.Verify(ctx, true); err != nil {
+		t.Fatalf("failed to verify and repair: %v", err)
+	}
+	if err = m.Cutover(ctx); err != nil {
+		t.Fatalf("failed to cutover: %v", err)
+	}
+	m.Unfreeze()
+	//双写期间的记录先于回填的旧记录写入目标布局，主键更小，最新记录仍按创建时间返回
+	last, err := service.GetAccountLastRecordWrite(ctx, userAccount+1, nil, nil, nil)
+	if err != nil || last == nil || last.TransferId != 101 {
+		t.Fatalf("expect last record of transfer 101 after cutover, got %+v %v", last, err)
+	}
+	page, err = service.ListAccountRecords(ctx, &model.ListRecordReq{AccountId: userAccount + 1, Limit: 1})
+	if err != nil || len(page.Records) != 1 || page.Records[0].TransferId != 101 {
+		t.Fatalf("expect newest listed record of transfer 101, got %+v %v", page, err)
+	}
+	if page, err = service.ListAccountRecords(ctx, &model.ListRecordReq{AccountId: userAccount + 1, Cursor: page.NextCursor, Limit: 1}); err != nil ||
+		len(page.Records) != 1 || page.Records[0].TransferId != 1 || page.HasMore {
+		t.Fatalf("expect second listed record of transfer 1, got %+v %v", page, err)
+	}
+	transfer(t, 103, userAccount+5, userAccount+6, 30)
+	if err = service.Rollback(ctx, &model.RollbackReq{TransferId: 101, TransferScene: transferScene}); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+	if _, err = m.Finish(ctx); err != nil {
+		t.Fatalf("failed to finish: %v", err)
+	}
+
+	for _, table := range []string{"state", "record", "account"} {
+		if n := count(t, db0, table); n != 0 {
+			t.Fatalf("expect old table %s purged, got %d rows", table, n)
+		}
+	}
+	//奇数账户路由到第二个库的account_1
+	if n := count(t, db1, "account_1", "account_id > ?", userAccount); n != 3 {
+		t.Fatalf("expect 3 odd user accounts on db 1, got %d", n)
+	}
+	if n := count(t, db0, "account_1"); n != 0 {
+		t.Fatalf("expect no account_1 rows on db 0, got %d", n)
+	}
+	assertAmount(t, userAccount+1, 1000)
+	assertAmount(t, userAccount+2, 1000)
+	assertAmount(t, userAccount+3, 950)
+	assertAmount(t, userAccount+4, 1050)
+	//包含修复到目标布局的源布局变更
+	assertAmount(t, userAccount+5, 977)
+	assertAmount(t, userAccount+6, 1030)
+	transfer(t, 104, userAccount+6, userAccount+1, 30)
+	assertAmount(t, userAccount+1, 1030)
+}
+
+func TestNewMigratorRouterOutOfRange(t *testing.T) {
+	db0, db1 := openSQLite(t, "fisher0.db"), openSQLite(t, "fisher1.db")
+	router, err := basic.NewDirectoryRouter([]basic.DirectoryEntry{
+		{Kind: basic.ShardKindAccount, MinId: userAccount, MaxId: userAccount, DB: 1, Table: 1},
+	}, nil)
+	if err != nil {
+		t.Fatalf("failed to create directory router: %v", err)
+	}
+	client, err := service.New(&basic.TransferConf{DBs: []*gorm.DB{db0, db1}, AccountSplitNum: 2, Router: router})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	//目标布局的库和分表少于目录条目，创建迁移时报错，不在双写时panic
+	if _, err = NewMigratorWithLayouts(client.LayoutManager(), &basic.TransferConf{DBs: []*gorm.DB{db0}, AccountSplitNum: 2, Router: router}); err == nil {
+		t.Fatalf("expect db out of range error")
+	}
+	if _, err = NewMigratorWithLayouts(client.LayoutManager(), &basic.TransferConf{DBs: []*gorm.DB{db0, db1}, AccountSplitNum: 1, Router: router}); err == nil {
+		t.Fatalf("expect table out of range error")
+	}
+	if _, err = service.New(&basic.TransferConf{DBs: []*gorm.DB{db0}, AccountSplitNum: 2, Router: router}); err == nil {
+		t.Fatalf("expect out of range error on new client")
+	}
+}
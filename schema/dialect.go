@@ -0,0 +1,170 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zjn-zjn/fisher/basic"
+)
+
+type Dialect string //数据库方言
+
+const (
+	DialectMySQL    Dialect = "mysql"
+	DialectPostgres Dialect = "postgres"
+	DialectSQLite   Dialect = "sqlite"
+)
+
+// createTableDDL 生成建表语句，索引名在PostgreSQL和SQLite下全库唯一，需带上命名空间前缀和分表后缀
+func createTableDDL(dialect Dialect, table *basic.Table) ([]string, error) {
+	switch dialect {
+	case DialectMySQL:
+		return mysqlDDL(table), nil
+	case DialectPostgres:
+		return postgresDDL(table), nil
+	case DialectSQLite:
+		return sqliteDDL(table), nil
+	}
+	return nil, fmt.Errorf("unsupported dialect: %s", dialect)
+}
+
+func mysqlDDL(table *basic.Table) []string {
+	var lines []string
+	for _, column := range table.Spec.Columns {
+		lines = append(lines, fmt.Sprintf("    `%s` %s COMMENT '%s'", column.Name, mysqlColumnType(column), column.Comment))
+	}
+	lines = append(lines, "    PRIMARY KEY (`id`)")
+	for _, index := range table.Spec.Indexes {
+		if index.Unique {
+			lines = append(lines, fmt.Sprintf("    UNIQUE KEY `%s` (%s)", index.Name, quoteColumns(index.Columns, "`")))
+		} else {
+			lines = append(lines, fmt.Sprintf("    KEY `%s` (%s)", index.Name, quoteColumns(index.Columns, "`")))
+		}
+	}
+	return []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s`\n(\n%s\n) COMMENT '%s'", table.Name, strings.Join(lines, ",\n"), table.Spec.Comment)}
+}
+
+func postgresDDL(table *basic.Table) []string {
+	var lines []string
+	for _, column := range table.Spec.Columns {
+		lines = append(lines, fmt.Sprintf("    %s %s", column.Name, postgresColumnType(column)))
+	}
+	lines = append(lines, "    PRIMARY KEY (id)")
+	var indexes []string
+	for _, index := range table.Spec.Indexes {
+		if index.Unique {
+			lines = append(lines, fmt.Sprintf("    CONSTRAINT %s UNIQUE (%s)", table.IndexName(index), quoteColumns(index.Columns, "")))
+			continue
+		}
+		indexes = append(indexes, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", table.IndexName(index), table.Name, quoteColumns(index.Columns, "")))
+	}
+	stmts := []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s\n(\n%s\n)", table.Name, strings.Join(lines, ",\n"))}
+	stmts = append(stmts, indexes...)
+	stmts = append(stmts, fmt.Sprintf("COMMENT ON TABLE %s IS '%s'", table.Name, table.Spec.Comment))
+	return stmts
+}
+
+func sqliteDDL(table *basic.Table) []string {
+	var lines []string
+	for _, column := range table.Spec.Columns {
+		lines = append(lines, fmt.Sprintf("    %s %s", column.Name, sqliteColumnType(column)))
+	}
+	stmts := []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s\n(\n%s\n)", table.Name, strings.Join(lines, ",\n"))}
+	//SQLite的表内唯一约束不保留名称，统一使用独立的索引语句
+	for _, index := range table.Spec.Indexes {
+		unique := ""
+		if index.Unique {
+			unique = "UNIQUE "
+		}
+		stmts = append(stmts, fmt.Sprintf("CREATE %sINDEX IF NOT EXISTS %s ON %s (%s)", unique, table.IndexName(index), table.Name, quoteColumns(index.Columns, "")))
+	}
+	return stmts
+}
+
+func mysqlColumnType(column basic.ColumnSpec) string {
+	switch column.Type {
+	case basic.ColumnTypeID:
+		return "bigint unsigned NOT NULL AUTO_INCREMENT"
+	case basic.ColumnTypeBigInt:
+		return "bigint NOT NULL"
+	case basic.ColumnTypeInt:
+		return "int NOT NULL"
+	case basic.ColumnTypeString, basic.ColumnTypeJSON:
+		return fmt.Sprintf("varchar(%d) NOT NULL", column.Size)
+	}
+	return ""
+}
+
+func postgresColumnType(column basic.ColumnSpec) string {
+	switch column.Type {
+	case basic.ColumnTypeID:
+		return "bigserial NOT NULL"
+	case basic.ColumnTypeBigInt:
+		return "bigint NOT NULL"
+	case basic.ColumnTypeInt:
+		return "int NOT NULL"
+	case basic.ColumnTypeString:
+		return fmt.Sprintf("varchar(%d) NOT NULL", column.Size)
+	case basic.ColumnTypeJSON:
+		return "jsonb NOT NULL"
+	}
+	return ""
+}
+
+func sqliteColumnType(column basic.ColumnSpec) string {
+	switch column.Type {
+	case basic.ColumnTypeID:
+		return "integer PRIMARY KEY AUTOINCREMENT"
+	case basic.ColumnTypeBigInt:
+		return "bigint NOT NULL"
+	case basic.ColumnTypeInt:
+		return "int NOT NULL"
+	case basic.ColumnTypeString, basic.ColumnTypeJSON:
+		return "text NOT NULL"
+	}
+	return ""
+}
+
+// addColumnDDL 为已存在的表增加列，已有的行按默认值填充：数字为0，字符串为空串，JSON为空数组
+func addColumnDDL(dialect Dialect, table *basic.Table, column basic.ColumnSpec) (string, error) {
+	var def string
+	switch column.Type {
+	case basic.ColumnTypeBigInt, basic.ColumnTypeInt:
+		def = "0"
+	case basic.ColumnTypeString:
+		def = "''"
+	case basic.ColumnTypeJSON:
+		def = "'[]'"
+	default:
+		return "", fmt.Errorf("table %s: can not add column %s to an existing table", table.Name, column.Name)
+	}
+	switch dialect {
+	case DialectMySQL:
+		return fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s DEFAULT %s COMMENT '%s'", table.Name, column.Name, mysqlColumnType(column), def, column.Comment), nil
+	case DialectPostgres:
+		return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s DEFAULT %s", table.Name, column.Name, postgresColumnType(column), def), nil
+	case DialectSQLite:
+		return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s DEFAULT %s", table.Name, column.Name, sqliteColumnType(column), def), nil
+	}
+	return "", fmt.Errorf("unsupported dialect: %s", dialect)
+}
+
+// addIndexDDL 为已存在的表增加索引，增加唯一索引前需确认已有数据不重复
+func addIndexDDL(dialect Dialect, table *basic.Table, index basic.IndexSpec) string {
+	unique := ""
+	if index.Unique {
+		unique = "UNIQUE "
+	}
+	if dialect == DialectMySQL {
+		return fmt.Sprintf("CREATE %sINDEX `%s` ON `%s` (%s)", unique, index.Name, table.Name, quoteColumns(index.Columns, "`"))
+	}
+	return fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)", unique, table.IndexName(index), table.Name, quoteColumns(index.Columns, ""))
+}
+
+func quoteColumns(columns []string, quote string) string {
+	quoted := make([]string, 0, len(columns))
+	for _, column := range columns {
+		quoted = append(quoted, quote+column+quote)
+	}
+	return strings.Join(quoted, ", ")
+}
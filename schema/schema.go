@@ -0,0 +1,118 @@
+// Package schema 根据分库分表配置生成并执行建表语句，升级时为已存在的表补齐新增的列和索引
+package schema
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+
+	"github.com/zjn-zjn/fisher/basic"
+)
+
+// GetDialect 获取gorm连接对应的方言
+func GetDialect(db *gorm.DB) Dialect {
+	return Dialect(db.Dialector.Name())
+}
+
+// Generate 生成配置下全部表的建表语句，转移状态使用单独的库时需在对应库上分别执行
+func Generate(conf *basic.TransferConf, dialect Dialect) ([]string, error) {
+	if conf == nil {
+		return nil, errors.New("conf is nil")
+	}
+	return generateTables(basic.GetTables(conf), dialect)
+}
+
+func generateTables(tables []*basic.Table, dialect Dialect) ([]string, error) {
+	var stmts []string
+	for _, table := range tables {
+		tableStmts, err := createTableDDL(dialect, table)
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, tableStmts...)
+	}
+	return stmts, nil
+}
+
+// Apply 在配置的每个库上执行该库所需的建表语句，可重复执行
+// 已存在的表会补齐缺失的列和索引，用于升级后新增的列，已有的行按默认值填充，见addColumnDDL
+func Apply(ctx context.Context, conf *basic.TransferConf) error {
+	if conf == nil {
+		return errors.New("conf is nil")
+	}
+	if len(conf.DBs) == 0 {
+		return errors.New("db is nil")
+	}
+	for i, dt := range basic.GetDBTables(conf) {
+		stmts, err := applyTables(dt.DB, dt.Tables, GetDialect(dt.DB))
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("[fisher] inspect schema on db %d failed", i))
+		}
+		for _, stmt := range stmts {
+			if err = dt.DB.WithContext(ctx).Exec(stmt).Error; err != nil {
+				return errors.Wrap(err, fmt.Sprintf("[fisher] apply schema on db %d failed", i))
+			}
+		}
+	}
+	return nil
+}
+
+// applyTables 生成库上需要执行的语句，不存在的表直接建表，已存在的表补齐缺失的列和索引
+func applyTables(db *gorm.DB, tables []*basic.Table, dialect Dialect) ([]string, error) {
+	var stmts []string
+	migrator := db.Migrator()
+	for _, table := range tables {
+		if !migrator.HasTable(table.Name) {
+			tableStmts, err := createTableDDL(dialect, table)
+			if err != nil {
+				return nil, err
+			}
+			stmts = append(stmts, tableStmts...)
+			continue
+		}
+		columnTypes, err := migrator.ColumnTypes(table.Name)
+		if err != nil {
+			return nil, err
+		}
+		columns := make(map[string]struct{}, len(columnTypes))
+		for _, columnType := range columnTypes {
+			columns[columnType.Name()] = struct{}{}
+		}
+		for _, column := range table.Spec.Columns {
+			if _, ok := columns[column.Name]; ok {
+				continue
+			}
+			stmt, err := addColumnDDL(dialect, table, column)
+			if err != nil {
+				return nil, err
+			}
+			stmts = append(stmts, stmt)
+		}
+		indexes, err := migrator.GetIndexes(table.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, index := range table.Spec.Indexes {
+			if !hasIndex(indexes, index) {
+				stmts = append(stmts, addIndexDDL(dialect, table, index))
+			}
+		}
+	}
+	return stmts, nil
+}
+
+// hasIndex 按列判断索引是否存在，手动建表时索引名可能与定义不同
+func hasIndex(indexes []gorm.Index, index basic.IndexSpec) bool {
+	for _, exist := range indexes {
+		if unique, _ := exist.Unique(); index.Unique && !unique {
+			continue
+		}
+		if strings.Join(exist.Columns(), ",") == strings.Join(index.Columns, ",") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/zjn-zjn/fisher/basic"
+)
+
+func TestApply(t *testing.T) {
+	var dbs []*gorm.DB
+	for _, name := range []string{"db0.db", "db1.db"} {
+		db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), name)), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		if err != nil {
+			t.Fatalf("failed to open sqlite: %v", err)
+		}
+		dbs = append(dbs, db)
+	}
+	conf := &basic.TransferConf{
+		DBs:             dbs,
+		StateSplitNum:   2,
+		RecordSplitNum:  3,
+		AccountSplitNum: 1,
+	}
+	//重复执行不报错
+	for i := 0; i < 2; i++ {
+		if err := Apply(context.Background(), conf); err != nil {
+			t.Fatalf("failed to apply schema: %v", err)
+		}
+	}
+	want := []string{"state_0", "state_1", "record_0", "record_1", "record_2", "account"}
+	for i, db := range dbs {
+		for _, table := range want {
+			if !db.Migrator().HasTable(table) {
+				t.Fatalf("db %d missing table %s", i, table)
+			}
+		}
+		if !db.Migrator().HasIndex("record_2", "uk_record_2") {
+			t.Fatalf("db %d missing unique index uk_record_2", i)
+		}
+	}
+}
+
+func TestApplyStateDBs(t *testing.T) {
+	open := func(name string) *gorm.DB {
+		db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), name)), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		if err != nil {
+			t.Fatalf("failed to open sqlite: %v", err)
+		}
+		return db
+	}
+	db, stateDB := open("db.db"), open("state.db")
+	conf := &basic.TransferConf{DBs: []*gorm.DB{db}, StateDBs: []*gorm.DB{stateDB}, StateSplitNum: 2}
+	if err := Apply(context.Background(), conf); err != nil {
+		t.Fatalf("failed to apply schema: %v", err)
+	}
+	//转移状态表只在状态库上创建
+	if db.Migrator().HasTable("state_0") || !stateDB.Migrator().HasTable("state_1") {
+		t.Fatalf("state tables should only exist on state db")
+	}
+	if stateDB.Migrator().HasTable("account") || !db.Migrator().HasTable("record") {
+		t.Fatalf("record and account tables should only exist on db")
+	}
+	if err := basic.VerifySchema(conf); err != nil {
+		t.Fatalf("failed to verify schema: %v", err)
+	}
+}
+
+func TestGenerateUnsupportedDialect(t *testing.T) {
+	if _, err := Generate(&basic.TransferConf{}, "oracle"); err == nil {
+		t.Fatalf("expect unsupported dialect error")
+	}
+}
+
+func TestVerifySchema(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "db.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	conf := &basic.TransferConf{
+		DBs:             []*gorm.DB{db},
+		StateSplitNum:   2,
+		RecordSplitNum:  2,
+		AccountSplitNum: 2,
+		VerifySchema:    true,
+	}
+	if err = Apply(context.Background(), conf); err != nil {
+		t.Fatalf("failed to apply schema: %v", err)
+	}
+	if err = basic.InitWithConf(conf); err != nil {
+		t.Fatalf("expect verify passed, got %v", err)
+	}
+
+	//分表数量配置错误
+	conf.AccountSplitNum = 3
+	var schemaErr *basic.SchemaError
+	if err = basic.InitWithConf(conf); !errors.As(err, &schemaErr) {
+		t.Fatalf("expect schema error, got %v", err)
+	}
+	//账户快照表与账户表使用相同的分表数量
+	if len(schemaErr.Problems) != 2 || !strings.Contains(schemaErr.Problems[0], "account_2: table not exists") ||
+		!strings.Contains(schemaErr.Problems[1], "account_snapshot_2: table not exists") {
+		t.Fatalf("unexpected problems: %v", schemaErr.Problems)
+	}
+
+	//缺少唯一索引
+	conf.AccountSplitNum = 2
+	if err = db.Exec("DROP INDEX uk_record_1").Error; err != nil {
+		t.Fatalf("failed to drop index: %v", err)
+	}
+	if err = basic.InitWithConf(conf); !errors.As(err, &schemaErr) {
+		t.Fatalf("expect schema error, got %v", err)
+	}
+	if len(schemaErr.Problems) != 1 || !strings.Contains(schemaErr.Problems[0], "record_1: missing unique index uk_record") {
+		t.Fatalf("unexpected problems: %v", schemaErr.Problems)
+	}
+}
+
+func TestApplyUpgrade(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "db.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	//旧版本的记录表和账户表，缺少之后新增的列和索引，唯一索引名也与定义不同
+	for _, stmt := range []string{
+		`CREATE TABLE record (id integer PRIMARY KEY AUTOINCREMENT, account_id bigint NOT NULL, transfer_id bigint NOT NULL,
+			transfer_scene int NOT NULL, transfer_type int NOT NULL, transfer_status int NOT NULL, amount bigint NOT NULL,
+			item_type int NOT NULL, change_type int NOT NULL, comment text NOT NULL, created_at bigint NOT NULL, updated_at bigint NOT NULL)`,
+		`CREATE UNIQUE INDEX uk_record_old ON record (account_id, transfer_id, item_type, transfer_scene, transfer_type, change_type)`,
+		`CREATE TABLE account (id integer PRIMARY KEY AUTOINCREMENT, account_id bigint NOT NULL, amount bigint NOT NULL,
+			item_type int NOT NULL, created_at bigint NOT NULL, updated_at bigint NOT NULL)`,
+		`CREATE UNIQUE INDEX uk_account ON account (account_id, item_type)`,
+		`INSERT INTO account (account_id, amount, item_type, created_at, updated_at) VALUES (1, 100, 1, 0, 0)`,
+	} {
+		if err = db.Exec(stmt).Error; err != nil {
+			t.Fatalf("failed to create old schema: %v", err)
+		}
+	}
+	conf := &basic.TransferConf{DBs: []*gorm.DB{db}, StateSplitNum: 1, RecordSplitNum: 1, AccountSplitNum: 1}
+	for i := 0; i < 2; i++ {
+		if err = Apply(context.Background(), conf); err != nil {
+			t.Fatalf("failed to apply schema: %v", err)
+		}
+	}
+	if err = basic.VerifySchema(conf); err != nil {
+		t.Fatalf("failed to verify schema: %v", err)
+	}
+	if !db.Migrator().HasIndex("record", "idx_expire") || db.Migrator().HasIndex("record", "uk_record") {
+		t.Fatalf("expect missing index added and existing unique index kept")
+	}
+	var row struct {
+		Amount       int64
+		FrozenAmount int64
+		Sequence     int64
+	}
+	if err = db.Table("account").Where("account_id = 1").Take(&row).Error; err != nil {
+		t.Fatalf("failed to get account: %v", err)
+	}
+	if row.Amount != 100 || row.FrozenAmount != 0 || row.Sequence != 0 {
+		t.Fatalf("unexpected account after upgrade: %+v", row)
+	}
+}
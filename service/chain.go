@@ -0,0 +1,28 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// ChainBatchSize 校验哈希链每批读取的记录数
+const ChainBatchSize = 500
+
+// VerifyRecordChain 校验账户指定物品的记录哈希链，返回第一处断裂
+// 记录的每次写入(包括回滚、扣款、解冻和退款累计等原地变更)都在同一本地事务内向链追加一环，环中保存写入后记录全部内容的摘要
+// 绕过应用删除、插入或修改记录，或改动链本身都会使校验失败
+// 链尾的环被删除或整条链被重新计算无法通过链本身发现，可定期将ChainReport.Head保存到外部，下次校验时对比
+func VerifyRecordChain(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.ChainReport, error) {
+	return defaultClient().VerifyRecordChain(ctx, accountId, itemType)
+}
+
+// VerifyRecordChain 校验账户物品的记录哈希链，见包级函数VerifyRecordChain
+func (c *Client) VerifyRecordChain(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.ChainReport, error) {
+	if accountId == 0 {
+		return nil, basic.NewParamsError(errors.New("[fisher] verify record chain params error"))
+	}
+	return c.ledger.VerifyRecordChain(ctx, accountId, itemType, ChainBatchSize)
+}
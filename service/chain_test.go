@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/dao"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+func TestVerifyRecordChain(t *testing.T) {
+	forEachStore(t, testVerifyRecordChain)
+}
+
+func verifyChain(t *testing.T, accountId int64) *model.ChainReport {
+	t.Helper()
+	report, err := VerifyRecordChain(context.Background(), accountId, ItemTypeGold)
+	if err != nil {
+		t.Fatalf("failed to verify chain: %v", err)
+	}
+	return report
+}
+
+func testVerifyRecordChain(t *testing.T) {
+	ctx := context.Background()
+	recharge(t, 1, userAccountA, 300)
+	if err := Transfer(ctx, buyReq(2)); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	if err := Transfer(ctx, buyReq(3)); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	if err := Rollback(ctx, &model.RollbackReq{TransferId: 3, TransferScene: TransferSceneBuyGoods}); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+	//回滚早到，记录空回滚
+	if err := defaultClient().ledger.IncreaseAccount(ctx, userAccountA, 4, 100, ItemTypeGold, TransferSceneBuyGoods, basic.RecordStatusRollback, ChangeTypeSpend, ""); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+	//转移3的回滚在原记录上变更状态，追加一环
+	report := verifyChain(t, userAccountA)
+	if report.Verified != 5 || report.Records != 4 || report.Unchained != 0 || report.Broken != nil || report.Head == "" {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	chains, err := dao.GetStore().ListRecordChain(ctx, userAccountA, ItemTypeGold, 0, 10)
+	if err != nil {
+		t.Fatalf("failed to list chain: %v", err)
+	}
+	if len(chains) != 5 || chains[0].PrevHash != "" || chains[1].PrevHash != chains[0].Hash || chains[4].Hash != report.Head ||
+		chains[3].TransferId != 3 || chains[2].TransferId != 3 {
+		t.Fatalf("unexpected chain: %+v", chains)
+	}
+
+	//其他账户的链不受影响
+	report = verifyChain(t, userAccountB)
+	if report.Verified != 3 || report.Records != 2 || report.Broken != nil {
+		t.Fatalf("unexpected report of other account: %+v", report)
+	}
+
+	//绕过应用将转移2的记录改为已回滚，回放和对账会不再计入这笔扣减
+	affect, err := dao.GetStore().UpdateRecord(ctx, userAccountA, 2, ItemTypeGold, TransferSceneBuyGoods, basic.RecordTypeDeduct, basic.RecordStatusRollback, basic.RecordStatusNormal, ChangeTypeSpend)
+	if err != nil || !affect {
+		t.Fatalf("failed to update record: %v", err)
+	}
+	report = verifyChain(t, userAccountA)
+	if report.Broken == nil || report.Broken.Reason != basic.ChainBreakReasonRecord || report.Broken.Record.TransferId != 2 || report.Broken.ChainSeq != 2 {
+		t.Fatalf("expect record mismatch, got %+v %+v", report, report.Broken)
+	}
+
+	//绕过应用修改已退款金额
+	if _, err = dao.GetStore().UpdateRecordRefundedAmount(ctx, userAccountB, 2, ItemTypeGold, TransferSceneBuyGoods, basic.RecordTypeAdd, ChangeTypeSellGoodsIncome, 10); err != nil {
+		t.Fatalf("failed to update refunded amount: %v", err)
+	}
+	report = verifyChain(t, userAccountB)
+	if report.Broken == nil || report.Broken.Reason != basic.ChainBreakReasonRecord || report.Broken.Record.RefundedAmount != 10 {
+		t.Fatalf("expect record mismatch, got %+v %+v", report, report.Broken)
+	}
+
+	//在链中间插入一环
+	chains, err = dao.GetStore().ListRecordChain(ctx, userAccountC, ItemTypeGold, 0, 10)
+	if err != nil || len(chains) == 0 {
+		t.Fatalf("failed to list chain: %v", err)
+	}
+	forged := *chains[len(chains)-1]
+	forged.ID, forged.ChainSeq = 0, forged.ChainSeq+5
+	if err = dao.GetStore().CreateRecordChain(ctx, &forged); err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	report = verifyChain(t, userAccountC)
+	if report.Broken == nil || report.Broken.ChainSeq != int64(len(chains))+1 || report.Broken.Reason != basic.ChainBreakReasonSeqGap {
+		t.Fatalf("expect sequence gap, got %+v %+v", report, report.Broken)
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/dao"
+)
+
+// Client 物品转移客户端，配置、路由和存储都保存在实例上，同一进程可以创建多个互不影响的客户端
+type Client struct {
+	ledger  *dao.Ledger
+	layouts *basic.LayoutManager
+}
+
+// Option 客户端选项
+type Option func(o *options)
+
+type options struct {
+	store dao.Store
+}
+
+// WithStore 使用指定的存储，例如内存存储，此时配置中的库只用于布局，可以为空
+func WithStore(store dao.Store) Option {
+	return func(o *options) {
+		o.store = store
+	}
+}
+
+// New 按配置创建客户端，不修改basic包级配置，配置了命名空间时需使用NewLedgers
+func New(conf *basic.TransferConf, opts ...Option) (*Client, error) {
+	if conf == nil {
+		return nil, errors.New("conf is nil")
+	}
+	if len(conf.Namespaces) != 0 {
+		//命名空间的表均带有前缀，按根配置创建会使用不存在的无前缀表
+		return nil, errors.New("conf with namespaces must be created by NewLedgers")
+	}
+	if err := conf.CheckNamespaces(); err != nil {
+		return nil, err
+	}
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	official, err := basic.NewOfficialAccount(conf.OfficialAccountStep, conf.OfficialAccountMin, conf.OfficialAccountMax)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := basic.NewLayout(conf)
+	if err != nil {
+		return nil, err
+	}
+	layouts := basic.NewLayoutManager(layout)
+	store := o.store
+	if store == nil {
+		if len(conf.DBs) == 0 {
+			return nil, errors.New("db is nil")
+		}
+		if conf.VerifySchema {
+			if err = basic.VerifySchema(conf); err != nil {
+				return nil, err
+			}
+		}
+		store = dao.NewGormStoreWithLayouts(layouts)
+	}
+	return &Client{ledger: dao.NewLedger(store, official), layouts: layouts}, nil
+}
+
+// defaultClient 包级函数使用的客户端，按dao.SetStore和basic包级初始化的配置创建
+func defaultClient() *Client {
+	return &Client{
+		ledger:  dao.NewLedger(dao.GetStore(), basic.GetDefaultOfficialAccount()),
+		layouts: basic.GetDefaultLayoutManager(),
+	}
+}
+
+// Store 获取客户端使用的存储
+func (c *Client) Store() dao.Store {
+	return c.ledger.Store()
+}
+
+// LayoutManager 获取客户端的布局管理，用于在线重新分片
+func (c *Client) LayoutManager() *basic.LayoutManager {
+	return c.layouts
+}
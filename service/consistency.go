@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// CheckConsistency 检查创建时间在[start, end)(毫秒)内的转移，转移状态与各账户分片上的操作记录是否一致
+// 例如已成功的转移缺少收款记录、已回滚的转移仍有未回滚的记录，只返回不一致的转移及其原因和修复时将执行的动作
+// 只读不修复，需扫描全部状态表，建议按时间窗口分段执行
+func CheckConsistency(ctx context.Context, start, end int64) (*model.ConsistencyReport, error) {
+	return defaultClient().CheckConsistency(ctx, start, end)
+}
+
+// CheckConsistency 检查时间窗口内转移的一致性，见包级函数CheckConsistency
+func (c *Client) CheckConsistency(ctx context.Context, start, end int64) (*model.ConsistencyReport, error) {
+	if start < 0 || end <= start {
+		return nil, basic.NewParamsError(errors.New("[fisher] check consistency params error"))
+	}
+	return c.ledger.CheckConsistency(ctx, start, end)
+}
+
+// CheckTransfer 检查单个转移的一致性，转移不存在返回nil
+func CheckTransfer(ctx context.Context, transferId int64, transferScene basic.TransferScene) (*model.TransferCheck, error) {
+	return defaultClient().CheckTransfer(ctx, transferId, transferScene)
+}
+
+// CheckTransfer 检查单个转移的一致性，见包级函数CheckTransfer
+func (c *Client) CheckTransfer(ctx context.Context, transferId int64, transferScene basic.TransferScene) (*model.TransferCheck, error) {
+	state, err := c.ledger.Store().GetState(ctx, transferId, transferScene)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, nil
+	}
+	return c.ledger.CheckTransfer(ctx, state)
+}
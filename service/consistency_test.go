@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/dao"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+func TestCheckConsistency(t *testing.T) {
+	forEachStore(t, testCheckConsistency)
+}
+
+func assertIssues(t *testing.T, check *model.TransferCheck, want map[int64][2]int) {
+	t.Helper()
+	if check.Consistent || len(check.Issues) != len(want) {
+		t.Fatalf("unexpected issues: %+v", check.Issues)
+	}
+	for _, issue := range check.Issues {
+		w, ok := want[issue.Leg.Item.AccountId]
+		if !ok || int(issue.Reason) != w[0] || int(issue.Repair) != w[1] {
+			t.Fatalf("unexpected issue of account %d: reason %d repair %d", issue.Leg.Item.AccountId, issue.Reason, issue.Repair)
+		}
+	}
+}
+
+func testCheckConsistency(t *testing.T) {
+	ctx := context.Background()
+	recharge(t, 1, userAccountA, 300)
+	if err := Transfer(ctx, buyReq(2)); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	//进行中的转移只完成了扣款
+	ledger := defaultClient().ledger
+	if _, err := ledger.GetOrCreateState(ctx, buyReq(3)); err != nil {
+		t.Fatalf("failed to create state: %v", err)
+	}
+	if err := ledger.DeductionAccount(ctx, userAccountA, 3, 100, ItemTypeGold, TransferSceneBuyGoods, basic.RecordStatusNormal, ChangeTypeSpend, ""); err != nil {
+		t.Fatalf("failed to deduct: %v", err)
+	}
+	report, err := CheckConsistency(ctx, 0, math.MaxInt64)
+	if err != nil {
+		t.Fatalf("failed to check: %v", err)
+	}
+	if report.Checked != 3 || len(report.Inconsistent) != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	//直接修改状态，成功的转移缺少收款记录
+	if _, err = dao.GetStore().UpdateStateStatus(ctx, 3, TransferSceneBuyGoods, basic.StateStatusDoing, basic.StateStatusSuccess); err != nil {
+		t.Fatalf("failed to update state: %v", err)
+	}
+	check, err := CheckTransfer(ctx, 3, TransferSceneBuyGoods)
+	if err != nil {
+		t.Fatalf("failed to check: %v", err)
+	}
+	missing := [2]int{int(basic.InconsistentReasonLegMissing), int(basic.RepairTypeForward)}
+	assertIssues(t, check, map[int64][2]int{userAccountB: missing, userAccountC: missing})
+
+	//已回滚的转移扣款未回滚，收款没有空回滚
+	if _, err = dao.GetStore().UpdateStateStatus(ctx, 3, TransferSceneBuyGoods, basic.StateStatusSuccess, basic.StateStatusRollbackDone); err != nil {
+		t.Fatalf("failed to update state: %v", err)
+	}
+	report, err = CheckConsistency(ctx, 0, math.MaxInt64)
+	if err != nil {
+		t.Fatalf("failed to check: %v", err)
+	}
+	if report.Checked != 3 || len(report.Inconsistent) != 1 || report.Inconsistent[0].Detail.State.TransferId != 3 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	noEmpty := [2]int{int(basic.InconsistentReasonNoEmptyRollback), int(basic.RepairTypeRollback)}
+	assertIssues(t, report.Inconsistent[0], map[int64][2]int{
+		userAccountA: {int(basic.InconsistentReasonNotCompensated), int(basic.RepairTypeRollback)},
+		userAccountB: noEmpty,
+		userAccountC: noEmpty,
+	})
+
+	if _, err = CheckConsistency(ctx, 10, 10); !basic.Is(err, basic.ParamsErr) {
+		t.Fatalf("expect params error, got %v", err)
+	}
+	if check, err = CheckTransfer(ctx, 100, TransferSceneBuyGoods); err != nil || check != nil {
+		t.Fatalf("expect nil check, got %+v %v", check, err)
+	}
+}
@@ -2,14 +2,20 @@ package service
 
 import (
 	"context"
+	"os"
 	"testing"
 	"time"
 
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
 	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/dao"
+	"github.com/zjn-zjn/fisher/dao/memory"
 	"github.com/zjn-zjn/fisher/model"
+	"github.com/zjn-zjn/fisher/schema"
 )
 
 const (
@@ -25,29 +31,56 @@ const (
 	ChangeTypeSellGoodsCopyright basic.ChangeType    = 3
 )
 
+// Init 初始化测试环境
+// 配置了环境变量FISHER_TEST_DSN1和FISHER_TEST_DSN2时使用数据库，否则使用内存存储
+// 数据库类型由FISHER_TEST_DIALECT指定，支持mysql(默认)、postgres和sqlite
 func Init(t *testing.T) {
-	dsn1 := "root:ERcxF3&72#32q@tcp(127.0.0.1:3306)/test?charset=utf8mb4&parseTime=True&loc=Local"
-	dsn2 := "root:ERcxF3&72#32q@tcp(127.0.0.1:3306)/test2?charset=utf8mb4&parseTime=True&loc=Local"
+	conf := &basic.TransferConf{
+		StateSplitNum:   3,
+		RecordSplitNum:  3,
+		AccountSplitNum: 3,
+	}
+	if !useDB() {
+		if _, err := memory.Init(conf); err != nil {
+			t.Fatalf("failed to init memory store: %v", err)
+		}
+		return
+	}
 	// 连接数据库
-	db1, err := gorm.Open(mysql.Open(dsn1), &gorm.Config{})
+	db1, err := gorm.Open(openDialector(os.Getenv("FISHER_TEST_DSN1")), &gorm.Config{})
 	if err != nil {
 		t.Fatalf("failed to connect database: %v", err)
 	}
-	db2, err := gorm.Open(mysql.Open(dsn2), &gorm.Config{})
+	db2, err := gorm.Open(openDialector(os.Getenv("FISHER_TEST_DSN2")), &gorm.Config{})
 	if err != nil {
 		t.Fatalf("failed to connect database: %v", err)
 	}
-	err = basic.InitWithConf(&basic.TransferConf{
-		DBs:             []*gorm.DB{db1, db2},
-		StateSplitNum:   3,
-		RecordSplitNum:  3,
-		AccountSplitNum: 3,
-	})
+	conf.DBs = []*gorm.DB{db1, db2}
+	if err = schema.Apply(context.Background(), conf); err != nil {
+		t.Fatalf("failed to apply schema: %v", err)
+	}
+	dao.SetStore(dao.NewGormStore())
+	err = basic.InitWithConf(conf)
 	if err != nil {
 		t.Fatalf("failed to init conf: %v", err)
 	}
 }
 
+func useDB() bool {
+	return os.Getenv("FISHER_TEST_DSN1") != "" && os.Getenv("FISHER_TEST_DSN2") != ""
+}
+
+func openDialector(dsn string) gorm.Dialector {
+	switch os.Getenv("FISHER_TEST_DIALECT") {
+	case "postgres":
+		return postgres.Open(dsn)
+	case "sqlite":
+		return sqlite.Open(dsn)
+	default:
+		return mysql.Open(dsn)
+	}
+}
+
 func TestTransfer(t *testing.T) {
 	Init(t)
 	ctx := context.Background()
@@ -23,6 +23,9 @@ const (
 )
 
 func TestExtreme(t *testing.T) {
+	if !useDB() {
+		t.Skip("extreme test requires FISHER_TEST_DSN1 and FISHER_TEST_DSN2")
+	}
 	Init(t)
 	ctx := context.Background()
 	var wg sync.WaitGroup
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// Freeze 冻结账户物品，用于订单、竞拍等先占用后结算的场景
+// 冻结的部分计入账户数量但不可扣减，可用数量不足时返回InsufficientAmountErr，按转移ID幂等
+func Freeze(ctx context.Context, req *model.FreezeReq) error {
+	return defaultClient().Freeze(ctx, req)
+}
+
+// Unfreeze 解冻，释放冻结的全部金额，冻结不存在时记录空回滚，已扣款时返回StateMutationErr
+func Unfreeze(ctx context.Context, req *model.UnfreezeReq) error {
+	return defaultClient().Unfreeze(ctx, req)
+}
+
+// Capture 扣款，将冻结的金额转给ToAccounts，与Transfer一样可以Rollback，回滚后冻结恢复，需要时再解冻
+func Capture(ctx context.Context, req *model.CaptureReq) error {
+	return defaultClient().Capture(ctx, req)
+}
+
+// Freeze 冻结账户物品，见包级函数Freeze
+func (c *Client) Freeze(ctx context.Context, req *model.FreezeReq) error {
+	if req == nil || req.TransferId <= 0 || req.TransferScene <= 0 || req.AccountId <= 0 || req.Amount <= 0 {
+		return basic.NewParamsError(errors.New("[fisher] freeze params error"))
+	}
+	if c.ledger.Official().IsOfficialAccount(req.AccountId) {
+		return basic.NewParamsError(fmt.Errorf("official account %d can not be frozen", req.AccountId))
+	}
+	if req.ExpireAt < 0 {
+		return basic.NewParamsError(fmt.Errorf("invalid expire at: %d", req.ExpireAt))
+	}
+	return c.ledger.FreezeAccount(ctx, req.AccountId, req.TransferId, req.Amount, req.ItemType, req.TransferScene, req.ChangeType, req.Comment, req.ExpireAt)
+}
+
+// Unfreeze 解冻，见包级函数Unfreeze
+func (c *Client) Unfreeze(ctx context.Context, req *model.UnfreezeReq) error {
+	if req == nil || req.TransferId <= 0 || req.TransferScene <= 0 || req.AccountId <= 0 {
+		return basic.NewParamsError(errors.New("[fisher] unfreeze params error"))
+	}
+	return c.ledger.UnfreezeAccount(ctx, req.AccountId, req.TransferId, req.ItemType, req.TransferScene, req.ChangeType, "unfreeze")
+}
+
+// Capture 扣款，见包级函数Capture
+func (c *Client) Capture(ctx context.Context, req *model.CaptureReq) error {
+	if req == nil || req.TransferId <= 0 || req.TransferScene <= 0 || req.AccountId <= 0 {
+		return basic.NewParamsError(errors.New("[fisher] capture params error"))
+	}
+	freezeRecord, err := c.ledger.Store().GetRecord(ctx, req.AccountId, req.TransferId, req.ItemType, req.TransferScene, basic.RecordTypeFreeze, req.ChangeType)
+	if err != nil {
+		return err
+	}
+	if freezeRecord == nil {
+		return basic.NewParamsError(fmt.Errorf("freeze of transfer %d not found", req.TransferId))
+	}
+	if freezeRecord.TransferStatus == basic.RecordStatusRollback || freezeRecord.TransferStatus == basic.RecordStatusEmptyRollback {
+		return basic.AlreadyRolledBackErr
+	}
+	if freezeRecord.TransferStatus == basic.RecordStatusNormal && freezeRecord.IsExpired(time.Now().UnixMilli()) {
+		return basic.ExpiredErr
+	}
+	for _, account := range req.ToAccounts {
+		if account.ItemType != req.ItemType {
+			return basic.NewParamsError(fmt.Errorf("capture item type %d differs from freeze item type %d", account.ItemType, req.ItemType))
+		}
+	}
+	//扣款金额为冻结金额，转给ToAccounts的合计需与之相等，由转移校验保证
+	return c.transfer(ctx, &model.TransferReq{
+		TransferId:     req.TransferId,
+		TransferScene:  req.TransferScene,
+		UseHalfSuccess: req.UseHalfSuccess,
+		Comment:        req.Comment,
+		FromAccounts: []*model.TransferItem{{
+			AccountId:  req.AccountId,
+			ItemType:   req.ItemType,
+			Amount:     freezeRecord.Amount,
+			ChangeType: req.ChangeType,
+			Frozen:     true,
+		}},
+		ToAccounts: req.ToAccounts,
+	})
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+func assertFrozen(t *testing.T, accountId, wantAmount, wantFrozen int64) {
+	t.Helper()
+	account, err := GetAccountByItemTypeWrite(context.Background(), accountId, ItemTypeGold)
+	if err != nil {
+		t.Fatalf("failed to get account %d: %v", accountId, err)
+	}
+	if account.Amount != wantAmount || account.FrozenAmount != wantFrozen {
+		t.Fatalf("account %d amount/frozen got %d/%d want %d/%d", accountId, account.Amount, account.FrozenAmount, wantAmount, wantFrozen)
+	}
+}
+
+func freezeReq(transferId, amount int64) *model.FreezeReq {
+	return &model.FreezeReq{TransferId: transferId, TransferScene: TransferSceneBuyGoods, AccountId: userAccountA, ItemType: ItemTypeGold, Amount: amount, ChangeType: ChangeTypeSpend}
+}
+
+func unfreezeReq(transferId int64) *model.UnfreezeReq {
+	return &model.UnfreezeReq{TransferId: transferId, TransferScene: TransferSceneBuyGoods, AccountId: userAccountA, ItemType: ItemTypeGold, ChangeType: ChangeTypeSpend}
+}
+
+func captureReq(transferId int64) *model.CaptureReq {
+	return &model.CaptureReq{
+		TransferId:    transferId,
+		TransferScene: TransferSceneBuyGoods,
+		AccountId:     userAccountA,
+		ItemType:      ItemTypeGold,
+		ChangeType:    ChangeTypeSpend,
+		ToAccounts: []*model.TransferItem{
+			{AccountId: userAccountB, ItemType: ItemTypeGold, Amount: 90, ChangeType: ChangeTypeSellGoodsIncome},
+			{AccountId: userAccountC, ItemType: ItemTypeGold, Amount: 10, ChangeType: ChangeTypeSellGoodsCopyright},
+		},
+	}
+}
+
+func TestFreezeCaptureUnfreeze(t *testing.T) {
+	forEachStore(t, testFreezeCaptureUnfreeze)
+}
+
+func testFreezeCaptureUnfreeze(t *testing.T) {
+	ctx := context.Background()
+	recharge(t, 1, userAccountA, 150)
+
+	if err := Freeze(ctx, freezeReq(2, 100)); err != nil {
+		t.Fatalf("failed to freeze: %v", err)
+	}
+	//幂等
+	if err := Freeze(ctx, freezeReq(2, 100)); err != nil {
+		t.Fatalf("failed to freeze again: %v", err)
+	}
+	assertFrozen(t, userAccountA, 150, 100)
+	//可用数量只剩50
+	if err := Freeze(ctx, freezeReq(3, 60)); !basic.Is(err, basic.InsufficientAmountErr) {
+		t.Fatalf("expect insufficient amount for freeze, got %v", err)
+	}
+	if err := Transfer(ctx, &model.TransferReq{
+		TransferId:    4,
+		TransferScene: TransferSceneBuyGoods,
+		FromAccounts:  []*model.TransferItem{{AccountId: userAccountA, ItemType: ItemTypeGold, Amount: 60, ChangeType: ChangeTypeSpend}},
+		ToAccounts:    []*model.TransferItem{{AccountId: userAccountB, ItemType: ItemTypeGold, Amount: 60, ChangeType: ChangeTypeSellGoodsIncome}},
+	}); !basic.Is(err, basic.InsufficientAmountErr) {
+		t.Fatalf("expect insufficient amount for transfer, got %v", err)
+	}
+
+	if err := Capture(ctx, captureReq(2)); err != nil {
+		t.Fatalf("failed to capture: %v", err)
+	}
+	if err := Capture(ctx, captureReq(2)); err != nil {
+		t.Fatalf("failed to capture again: %v", err)
+	}
+	assertFrozen(t, userAccountA, 50, 0)
+	assertAmount(t, userAccountB, 90)
+	assertAmount(t, userAccountC, 10)
+	if err := Unfreeze(ctx, unfreezeReq(2)); !basic.Is(err, basic.StateMutationErr) {
+		t.Fatalf("expect state mutation for unfreeze after capture, got %v", err)
+	}
+
+	//回滚扣款后冻结恢复，再解冻
+	if err := Rollback(ctx, &model.RollbackReq{TransferId: 2, TransferScene: TransferSceneBuyGoods}); err != nil {
+		t.Fatalf("failed to rollback capture: %v", err)
+	}
+	assertFrozen(t, userAccountA, 150, 100)
+	assertAmount(t, userAccountB, 0)
+	if err := Unfreeze(ctx, unfreezeReq(2)); err != nil {
+		t.Fatalf("failed to unfreeze: %v", err)
+	}
+	if err := Unfreeze(ctx, unfreezeReq(2)); err != nil {
+		t.Fatalf("failed to unfreeze again: %v", err)
+	}
+	assertFrozen(t, userAccountA, 150, 0)
+	if err := Freeze(ctx, freezeReq(2, 100)); !basic.Is(err, basic.AlreadyRolledBackErr) {
+		t.Fatalf("expect already rolled back for freeze after unfreeze, got %v", err)
+	}
+
+	//解冻早于冻结到达
+	if err := Unfreeze(ctx, unfreezeReq(5)); err != nil {
+		t.Fatalf("failed to empty unfreeze: %v", err)
+	}
+	if err := Freeze(ctx, freezeReq(5, 10)); !basic.Is(err, basic.AlreadyRolledBackErr) {
+		t.Fatalf("expect already rolled back for late freeze, got %v", err)
+	}
+	assertFrozen(t, userAccountA, 150, 0)
+}
+
+func TestPreAuthorizationExpiry(t *testing.T) {
+	forEachStore(t, testPreAuthorizationExpiry)
+}
+
+func testPreAuthorizationExpiry(t *testing.T) {
+	ctx := context.Background()
+	recharge(t, 1, userAccountA, 300)
+
+	expiring := freezeReq(2, 100)
+	expiring.ExpireAt = time.Now().Add(20 * time.Millisecond).UnixMilli()
+	if err := Freeze(ctx, expiring); err != nil {
+		t.Fatalf("failed to pre-authorize: %v", err)
+	}
+	lasting := freezeReq(3, 100)
+	lasting.ExpireAt = time.Now().Add(time.Hour).UnixMilli()
+	if err := Freeze(ctx, lasting); err != nil {
+		t.Fatalf("failed to pre-authorize: %v", err)
+	}
+	assertFrozen(t, userAccountA, 300, 200)
+
+	time.Sleep(30 * time.Millisecond)
+	if err := Capture(ctx, captureReq(2)); !basic.Is(err, basic.ExpiredErr) {
+		t.Fatalf("expect expired for capture, got %v", err)
+	}
+	report, errs := InspectionWithReport(ctx, time.Now().UnixMilli())
+	if len(errs) != 0 {
+		t.Fatalf("failed to inspection: %v", errs)
+	}
+	if len(report.Released) != 1 || report.Released[0].TransferId != 2 || report.Released[0].Amount != 100 {
+		t.Fatalf("released got %+v want transfer 2", report.Released)
+	}
+	assertFrozen(t, userAccountA, 300, 100)
+	//再次检查不会重复解冻
+	if report, _ = InspectionWithReport(ctx, time.Now().UnixMilli()); len(report.Released) != 0 {
+		t.Fatalf("released again: %+v", report.Released)
+	}
+
+	if err := Capture(ctx, captureReq(3)); err != nil {
+		t.Fatalf("failed to capture: %v", err)
+	}
+	assertFrozen(t, userAccountA, 200, 0)
+	assertAmount(t, userAccountB, 90)
+}
@@ -2,22 +2,88 @@ package service
 
 import (
 	"context"
+	"errors"
+
 	"github.com/zjn-zjn/fisher/basic"
-	"github.com/zjn-zjn/fisher/dao"
+	"github.com/zjn-zjn/fisher/model"
 )
 
 func GetAccountAmountRead(ctx context.Context, accountId int64) (map[basic.ItemType]int64, error) {
-	return dao.GetAccountAmount(ctx, accountId, basic.GetAccountReadDB(ctx, accountId))
+	return defaultClient().GetAccountAmountRead(ctx, accountId)
 }
 
 func GetAccountAmountWrite(ctx context.Context, accountId int64) (map[basic.ItemType]int64, error) {
-	return dao.GetAccountAmount(ctx, accountId, basic.GetAccountWriteDB(ctx, accountId))
+	return defaultClient().GetAccountAmountWrite(ctx, accountId)
 }
 
 func GetAccountAmountByItemTypeRead(ctx context.Context, accountId int64, itemType basic.ItemType) (int64, error) {
-	return dao.GetAccountAmountByItemType(ctx, accountId, itemType, basic.GetAccountReadDB(ctx, accountId))
+	return defaultClient().GetAccountAmountByItemTypeRead(ctx, accountId, itemType)
 }
 
 func GetAccountAmountByItemTypeWrite(ctx context.Context, accountId int64, itemType basic.ItemType) (int64, error) {
-	return dao.GetAccountAmountByItemType(ctx, accountId, itemType, basic.GetRecordAndAccountWriteDB(ctx, accountId))
+	return defaultClient().GetAccountAmountByItemTypeWrite(ctx, accountId, itemType)
+}
+
+// GetAccountByItemTypeRead 获取账户指定物品的数量和冻结数量，可用数量为Account.GetAvailableAmount()
+func GetAccountByItemTypeRead(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.Account, error) {
+	return defaultClient().GetAccountByItemTypeRead(ctx, accountId, itemType)
+}
+
+func GetAccountByItemTypeWrite(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.Account, error) {
+	return defaultClient().GetAccountByItemTypeWrite(ctx, accountId, itemType)
+}
+
+func (c *Client) GetAccountAmountRead(ctx context.Context, accountId int64) (map[basic.ItemType]int64, error) {
+	return c.ledger.Store().GetAccountAmount(ctx, accountId, true)
+}
+
+func (c *Client) GetAccountAmountWrite(ctx context.Context, accountId int64) (map[basic.ItemType]int64, error) {
+	return c.ledger.Store().GetAccountAmount(ctx, accountId, false)
+}
+
+func (c *Client) GetAccountAmountByItemTypeRead(ctx context.Context, accountId int64, itemType basic.ItemType) (int64, error) {
+	return c.ledger.Store().GetAccountAmountByItemType(ctx, accountId, itemType, true)
+}
+
+func (c *Client) GetAccountAmountByItemTypeWrite(ctx context.Context, accountId int64, itemType basic.ItemType) (int64, error) {
+	return c.ledger.Store().GetAccountAmountByItemType(ctx, accountId, itemType, false)
+}
+
+func (c *Client) GetAccountByItemTypeRead(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.Account, error) {
+	return c.getAccountByItemType(ctx, accountId, itemType, true)
+}
+
+func (c *Client) GetAccountByItemTypeWrite(ctx context.Context, accountId int64, itemType basic.ItemType) (*model.Account, error) {
+	return c.getAccountByItemType(ctx, accountId, itemType, false)
+}
+
+// getAccountByItemType 账户不存在时返回数量为0的账户
+func (c *Client) getAccountByItemType(ctx context.Context, accountId int64, itemType basic.ItemType, readOnly bool) (*model.Account, error) {
+	account, err := c.ledger.Store().GetAccount(ctx, accountId, itemType, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		account = &model.Account{AccountId: accountId, ItemType: itemType}
+	}
+	return account, nil
+}
+
+// GetAccountAmountAt 获取账户指定物品在timestamp(毫秒，包含)时的数量，读主库
+// 有不晚于timestamp的快照时从快照开始加上之后的变更，否则由当前数量减去之后生效的变更得到
+// 之后创建的记录扣除其变动，之后回滚的记录加回其变动，空回滚没有变动
+func GetAccountAmountAt(ctx context.Context, accountId int64, itemType basic.ItemType, timestamp int64) (int64, error) {
+	return defaultClient().GetAccountAmountAt(ctx, accountId, itemType, timestamp)
+}
+
+// GetAccountAmountAt 获取账户指定物品在某一时刻的数量，见包级函数GetAccountAmountAt
+func (c *Client) GetAccountAmountAt(ctx context.Context, accountId int64, itemType basic.ItemType, timestamp int64) (int64, error) {
+	if accountId <= 0 || timestamp <= 0 {
+		return 0, basic.NewParamsError(errors.New("[fisher] get account amount at params error"))
+	}
+	result, err := c.ledger.GetAccountAmountAt(ctx, accountId, itemType, timestamp)
+	if err != nil {
+		return 0, err
+	}
+	return result.Amount, nil
 }
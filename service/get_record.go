@@ -2,15 +2,62 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+
 	"github.com/zjn-zjn/fisher/basic"
-	"github.com/zjn-zjn/fisher/dao"
 	"github.com/zjn-zjn/fisher/model"
 )
 
 func GetAccountLastRecordRead(ctx context.Context, accountId int64, itemType *basic.ItemType, transferScene *basic.TransferScene, transferType *basic.TransferType) (*model.Record, error) {
-	return dao.GetAccountLastRecord(ctx, accountId, itemType, transferScene, transferType, basic.GetRecordAndAccountReadDB(ctx, accountId))
+	return defaultClient().GetAccountLastRecordRead(ctx, accountId, itemType, transferScene, transferType)
 }
 
 func GetAccountLastRecordWrite(ctx context.Context, accountId int64, itemType *basic.ItemType, transferScene *basic.TransferScene, transferType *basic.TransferType) (*model.Record, error) {
-	return dao.GetAccountLastRecord(ctx, accountId, itemType, transferScene, transferType, basic.GetRecordAndAccountWriteDB(ctx, accountId))
+	return defaultClient().GetAccountLastRecordWrite(ctx, accountId, itemType, transferScene, transferType)
+}
+
+func (c *Client) GetAccountLastRecordRead(ctx context.Context, accountId int64, itemType *basic.ItemType, transferScene *basic.TransferScene, transferType *basic.TransferType) (*model.Record, error) {
+	return c.ledger.Store().GetAccountLastRecord(ctx, accountId, itemType, transferScene, transferType, true)
+}
+
+func (c *Client) GetAccountLastRecordWrite(ctx context.Context, accountId int64, itemType *basic.ItemType, transferScene *basic.TransferScene, transferType *basic.TransferType) (*model.Record, error) {
+	return c.ledger.Store().GetAccountLastRecord(ctx, accountId, itemType, transferScene, transferType, false)
+}
+
+const (
+	DefaultListRecordLimit = 20  //分页查询默认每页数量
+	MaxListRecordLimit     = 200 //分页查询每页最大数量
+)
+
+// ListAccountRecords 分页查询账户记录，读从库，按创建时间向新或向旧翻页，游标为上一页最后一条记录的ID
+func ListAccountRecords(ctx context.Context, req *model.ListRecordReq) (*model.RecordPage, error) {
+	return defaultClient().ListAccountRecords(ctx, req)
+}
+
+// ListAccountRecords 分页查询账户记录，见包级函数ListAccountRecords
+func (c *Client) ListAccountRecords(ctx context.Context, req *model.ListRecordReq) (*model.RecordPage, error) {
+	if req == nil || req.AccountId <= 0 || req.Cursor < 0 || req.Limit < 0 || req.Limit > MaxListRecordLimit {
+		return nil, basic.NewParamsError(errors.New("[fisher] list account records params error"))
+	}
+	if req.EndTime > 0 && req.StartTime >= req.EndTime {
+		return nil, basic.NewParamsError(fmt.Errorf("invalid time range: %d-%d", req.StartTime, req.EndTime))
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = DefaultListRecordLimit
+	}
+	//多查一条判断是否还有下一页
+	records, err := c.ledger.Store().ListAccountRecords(ctx, req, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	page := &model.RecordPage{Records: records, NextCursor: req.Cursor}
+	if len(records) > limit {
+		page.Records, page.HasMore = records[:limit], true
+	}
+	if len(page.Records) > 0 {
+		page.NextCursor = page.Records[len(page.Records)-1].ID
+	}
+	return page, nil
 }
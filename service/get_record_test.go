@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+func TestListAccountRecords(t *testing.T) {
+	forEachStore(t, testListAccountRecords)
+}
+
+// listTransferIds 按游标翻完全部页，返回记录的转移ID
+func listTransferIds(t *testing.T, req *model.ListRecordReq) []int64 {
+	t.Helper()
+	var ids []int64
+	for {
+		page, err := ListAccountRecords(context.Background(), req)
+		if err != nil {
+			t.Fatalf("failed to list records: %v", err)
+		}
+		for _, record := range page.Records {
+			ids = append(ids, record.TransferId)
+		}
+		if !page.HasMore {
+			return ids
+		}
+		req.Cursor = page.NextCursor
+	}
+}
+
+func assertIds(t *testing.T, got []int64, want ...int64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("transfer ids got %v want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("transfer ids got %v want %v", got, want)
+		}
+	}
+}
+
+func testListAccountRecords(t *testing.T) {
+	ctx := context.Background()
+	recharge(t, 1, userAccountA, 1000)
+	for transferId := int64(2); transferId <= 5; transferId++ {
+		if err := Transfer(ctx, buyReq(transferId)); err != nil {
+			t.Fatalf("failed to transfer: %v", err)
+		}
+	}
+	if err := Rollback(ctx, &model.RollbackReq{TransferId: 3, TransferScene: TransferSceneBuyGoods}); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+
+	page, err := ListAccountRecords(ctx, &model.ListRecordReq{AccountId: userAccountA, Limit: 2})
+	if err != nil {
+		t.Fatalf("failed to list records: %v", err)
+	}
+	if len(page.Records) != 2 || !page.HasMore || page.NextCursor != page.Records[1].ID {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	assertIds(t, listTransferIds(t, &model.ListRecordReq{AccountId: userAccountA, Limit: 2}), 5, 4, 3, 2, 1)
+	assertIds(t, listTransferIds(t, &model.ListRecordReq{AccountId: userAccountA, Limit: 2, HideRolledBack: true}), 5, 4, 2, 1)
+	deduct := basic.RecordTypeDeduct
+	assertIds(t, listTransferIds(t, &model.ListRecordReq{AccountId: userAccountA, Limit: 3, Asc: true, TransferType: &deduct}), 2, 3, 4, 5)
+	rolledBack := basic.RecordStatusRollback
+	assertIds(t, listTransferIds(t, &model.ListRecordReq{AccountId: userAccountA, TransferStatus: &rolledBack}), 3)
+
+	if _, err = ListAccountRecords(ctx, &model.ListRecordReq{AccountId: userAccountA, Limit: MaxListRecordLimit + 1}); !basic.Is(err, basic.ParamsErr) {
+		t.Fatalf("expect params error, got %v", err)
+	}
+}
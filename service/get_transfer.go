@@ -0,0 +1,25 @@
+package service
+
+import (
+	"context"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// GetTransfer 查询转移详情，包括转移状态和每个账户操作所在分片上的记录，转移不存在返回nil
+func GetTransfer(ctx context.Context, transferId int64, transferScene basic.TransferScene) (*model.TransferDetail, error) {
+	return defaultClient().GetTransfer(ctx, transferId, transferScene)
+}
+
+// GetTransfer 查询转移详情，见包级函数GetTransfer
+func (c *Client) GetTransfer(ctx context.Context, transferId int64, transferScene basic.TransferScene) (*model.TransferDetail, error) {
+	state, err := c.ledger.Store().GetState(ctx, transferId, transferScene)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, nil
+	}
+	return c.ledger.GetTransferDetail(ctx, state)
+}
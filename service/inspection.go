@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/zjn-zjn/fisher/basic"
 	"github.com/zjn-zjn/fisher/dao"
@@ -9,9 +10,55 @@ import (
 )
 
 // Inspection 拿到截止lastTime还在进行中(doing、rollback doing 和 half success)的转移，进行推进
+// 同时解冻已过期的预授权
 func Inspection(ctx context.Context, lastTime int64) []error {
+	return defaultClient().Inspection(ctx, lastTime)
+}
+
+// InspectionWithReport 同Inspection，返回自动解冻的预授权
+func InspectionWithReport(ctx context.Context, lastTime int64) (*model.InspectionReport, []error) {
+	return defaultClient().InspectionWithReport(ctx, lastTime)
+}
+
+// Inspection 推进截止lastTime还在进行中的转移，见包级函数Inspection
+func (c *Client) Inspection(ctx context.Context, lastTime int64) []error {
+	_, errs := c.InspectionWithReport(ctx, lastTime)
+	return errs
+}
+
+// InspectionWithReport 推进截止lastTime还在进行中的转移并解冻已过期的预授权，见包级函数InspectionWithReport
+func (c *Client) InspectionWithReport(ctx context.Context, lastTime int64) (*model.InspectionReport, []error) {
+	errs := c.inspectStates(ctx, lastTime)
+	//预授权按当前时间判断过期，与lastTime无关
+	released, releaseErrs := c.releaseExpiredFreezes(ctx, time.Now().UnixMilli())
+	return &model.InspectionReport{Released: released}, append(errs, releaseErrs...)
+}
+
+// releaseExpiredFreezes 解冻截止now已过期的预授权，已被扣款的跳过
+func (c *Client) releaseExpiredFreezes(ctx context.Context, now int64) ([]*model.Record, []error) {
+	records, err := c.ledger.Store().GetExpiredFreezeRecordList(ctx, now)
+	if err != nil {
+		return nil, []error{err}
+	}
+	var released []*model.Record
+	var errs []error
+	for _, record := range records {
+		ok, err := c.ledger.ReleaseExpiredFreeze(ctx, record.AccountId, record.TransferId, record.ItemType, record.TransferScene, record.ChangeType)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			record.TransferStatus = basic.RecordStatusRollback
+			released = append(released, record)
+		}
+	}
+	return released, errs
+}
+
+func (c *Client) inspectStates(ctx context.Context, lastTime int64) []error {
 	//获取需要推进的转移
-	stateList, err := dao.GetNeedInspectionStateList(ctx, lastTime)
+	stateList, err := c.ledger.Store().GetNeedInspectionStateList(ctx, lastTime)
 	if err != nil {
 		return []error{err}
 	}
@@ -24,7 +71,7 @@ func Inspection(ctx context.Context, lastTime int64) []error {
 		state := state
 		if state.Status == basic.StateStatusHalfSuccess {
 			//推进成功
-			err = processHalfSuccessState(ctx, state)
+			err = c.processHalfSuccessState(ctx, state)
 			if err != nil {
 				errs = append(errs, err)
 				continue
@@ -34,7 +81,7 @@ func Inspection(ctx context.Context, lastTime int64) []error {
 		//不存在需要推进doing的情况，doing没有变成success就是失败了
 		if state.Status == basic.StateStatusRollbackDoing || state.Status == basic.StateStatusDoing {
 			//推进回滚
-			err = Rollback(ctx, &model.RollbackReq{
+			err = c.Rollback(ctx, &model.RollbackReq{
 				TransferId:    state.TransferId,
 				TransferScene: state.TransferScene,
 			})
@@ -48,8 +95,8 @@ func Inspection(ctx context.Context, lastTime int64) []error {
 }
 
 // processHalfSuccessState HalfSuccess的推进应该极力保证成功,所以没有回滚操作
-func processHalfSuccessState(ctx context.Context, state *model.State) error {
-	txs, err := processHalfSuccessTxSequences(state)
+func (c *Client) processHalfSuccessState(ctx context.Context, state *model.State) error {
+	txs, err := processHalfSuccessTxSequences(c.ledger, state)
 	if err != nil {
 		return err
 	}
@@ -59,24 +106,28 @@ func processHalfSuccessState(ctx context.Context, state *model.State) error {
 			return err
 		}
 	}
-	err = dao.UpdateStateStatus(ctx, state.TransferId, state.TransferScene, basic.StateStatusHalfSuccess, basic.StateStatusSuccess)
+	_, err = c.ledger.Store().UpdateStateStatus(ctx, state.TransferId, state.TransferScene, basic.StateStatusHalfSuccess, basic.StateStatusSuccess)
 	return err
 }
 
 // HalfSuccess的推进应该极力保证成功,所以没有回滚操作
-func processHalfSuccessTxSequences(state *model.State) ([]dao.TransferTxItem, error) {
+func processHalfSuccessTxSequences(ledger *dao.Ledger, state *model.State) ([]dao.TransferTxItem, error) {
 	//扣除金额一定是已经成功，所以这里不会再有扣除动作
 	//增加金额
 	var txs = make([]dao.TransferTxItem, 0)
 	for _, toAccountInfo := range state.ToAccounts {
 		txs = append(txs, dao.TransferTxItem{
 			Exec: func(ctx context.Context) error {
+				if toAccountInfo.Refund != nil {
+					//退款，退还原转移付款方的物品，同时累加原记录的已退款金额
+					return ledger.RefundIncreaseAccount(ctx, toAccountInfo.Refund, toAccountInfo.AccountId, state.TransferId, toAccountInfo.Amount, toAccountInfo.ItemType, state.TransferScene, basic.RecordStatusNormal, toAccountInfo.ChangeType, state.Comment)
+				}
 				// 增加金额
 				comment := state.Comment
 				if toAccountInfo.Comment != "" {
 					comment = toAccountInfo.Comment
 				}
-				err := dao.IncreaseAccount(ctx, toAccountInfo.AccountId, state.TransferId, toAccountInfo.Amount, toAccountInfo.ItemType, state.TransferScene, basic.RecordStatusNormal, toAccountInfo.ChangeType, comment)
+				err := ledger.IncreaseAccount(ctx, toAccountInfo.AccountId, state.TransferId, toAccountInfo.Amount, toAccountInfo.ItemType, state.TransferScene, basic.RecordStatusNormal, toAccountInfo.ChangeType, comment)
 				if err != nil {
 					return err
 				}
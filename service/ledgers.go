@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// Ledgers 多账本客户端，配置中的每个命名空间对应一个独立的客户端
+// 各命名空间使用各自前缀的表和官方账户区间，按命名空间转移，不同命名空间的账户互不相通
+// 除转移和回滚外，单个命名空间内的查询和操作通过Namespace获取客户端后调用，Ledgers只提供依次处理全部命名空间的任务
+type Ledgers struct {
+	names   []string
+	clients map[string]*Client
+}
+
+// NewLedgers 按配置中的命名空间创建多账本客户端，各命名空间共用配置中的库、路由和分表数量
+// 多个命名空间不能共用同一个存储，因此不支持WithStore，内存存储需按命名空间分别通过New创建
+func NewLedgers(conf *basic.TransferConf, opts ...Option) (*Ledgers, error) {
+	if conf == nil {
+		return nil, errors.New("conf is nil")
+	}
+	if len(conf.Namespaces) == 0 {
+		return nil, errors.New("namespace is empty")
+	}
+	if err := conf.CheckNamespaces(); err != nil {
+		return nil, err
+	}
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.store != nil {
+		return nil, errors.New("store can not be shared by namespaces")
+	}
+	l := &Ledgers{clients: make(map[string]*Client, len(conf.Namespaces))}
+	for _, ns := range conf.Namespaces {
+		nsConf, err := conf.GetNamespaceConf(ns.Name)
+		if err != nil {
+			return nil, err
+		}
+		client, err := New(nsConf, opts...)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("[fisher] init namespace %s failed", ns.Name))
+		}
+		l.names = append(l.names, ns.Name)
+		l.clients[ns.Name] = client
+	}
+	return l, nil
+}
+
+// Namespace 获取命名空间的客户端
+func (l *Ledgers) Namespace(name string) (*Client, error) {
+	client, ok := l.clients[name]
+	if !ok {
+		return nil, basic.NewParamsError(errors.Errorf("namespace %s not found", name))
+	}
+	return client, nil
+}
+
+// Names 全部命名空间的名称，按配置顺序
+func (l *Ledgers) Names() []string {
+	return append([]string(nil), l.names...)
+}
+
+// Transfer 在命名空间内转移物品
+func (l *Ledgers) Transfer(ctx context.Context, namespace string, req *model.TransferReq) error {
+	client, err := l.Namespace(namespace)
+	if err != nil {
+		return err
+	}
+	return client.Transfer(ctx, req)
+}
+
+// Rollback 回滚命名空间内的转移
+func (l *Ledgers) Rollback(ctx context.Context, namespace string, req *model.RollbackReq) error {
+	client, err := l.Namespace(namespace)
+	if err != nil {
+		return err
+	}
+	return client.Rollback(ctx, req)
+}
+
+// Inspection 依次推进每个命名空间中截止lastTime还在进行中的转移
+func (l *Ledgers) Inspection(ctx context.Context, lastTime int64) []error {
+	_, errs := l.InspectionWithReport(ctx, lastTime)
+	return errs
+}
+
+// InspectionWithReport 同Inspection，按命名空间返回自动解冻的预授权
+func (l *Ledgers) InspectionWithReport(ctx context.Context, lastTime int64) (map[string]*model.InspectionReport, []error) {
+	reports := make(map[string]*model.InspectionReport, len(l.names))
+	var errs []error
+	for _, name := range l.names {
+		report, nsErrs := l.clients[name].InspectionWithReport(ctx, lastTime)
+		reports[name] = report
+		errs = append(errs, nsErrs...)
+	}
+	return reports, errs
+}
+
+// SnapshotAccounts 依次为每个命名空间写入账户数量快照，按命名空间返回结果
+func (l *Ledgers) SnapshotAccounts(ctx context.Context, cutOff int64) (map[string]*model.SnapshotReport, error) {
+	reports := make(map[string]*model.SnapshotReport, len(l.names))
+	for _, name := range l.names {
+		report, err := l.clients[name].SnapshotAccounts(ctx, cutOff)
+		if err != nil {
+			return reports, errors.Wrap(err, fmt.Sprintf("[fisher] snapshot namespace %s failed", name))
+		}
+		reports[name] = report
+	}
+	return reports, nil
+}
+
+// Reconcile 依次对每个命名空间零和对账，按命名空间返回结果
+func (l *Ledgers) Reconcile(ctx context.Context) (map[string]*model.ReconcileReport, error) {
+	reports := make(map[string]*model.ReconcileReport, len(l.names))
+	for _, name := range l.names {
+		report, err := l.clients[name].Reconcile(ctx)
+		if err != nil {
+			return reports, errors.Wrap(err, fmt.Sprintf("[fisher] reconcile namespace %s failed", name))
+		}
+		reports[name] = report
+	}
+	return reports, nil
+}
+
+// CheckConsistency 依次检查每个命名空间时间窗口内转移的一致性，按命名空间返回结果
+func (l *Ledgers) CheckConsistency(ctx context.Context, start, end int64) (map[string]*model.ConsistencyReport, error) {
+	reports := make(map[string]*model.ConsistencyReport, len(l.names))
+	for _, name := range l.names {
+		report, err := l.clients[name].CheckConsistency(ctx, start, end)
+		if err != nil {
+			return reports, errors.Wrap(err, fmt.Sprintf("[fisher] check consistency namespace %s failed", name))
+		}
+		reports[name] = report
+	}
+	return reports, nil
+}
+
+// ReplayAccounts 依次按记录回放重建每个命名空间的账户数量，按命名空间返回结果
+func (l *Ledgers) ReplayAccounts(ctx context.Context, apply bool) (map[string]*model.ReplayReport, error) {
+	reports := make(map[string]*model.ReplayReport, len(l.names))
+	for _, name := range l.names {
+		report, err := l.clients[name].ReplayAccounts(ctx, apply)
+		if err != nil {
+			return reports, errors.Wrap(err, fmt.Sprintf("[fisher] replay namespace %s failed", name))
+		}
+		reports[name] = report
+	}
+	return reports, nil
+}
+
+// PurgeOutboxEvents 依次删除每个命名空间中过期的已投递事件，按命名空间返回删除的数量
+func (l *Ledgers) PurgeOutboxEvents(ctx context.Context, before int64) (map[string]int64, error) {
+	purged := make(map[string]int64, len(l.names))
+	for _, name := range l.names {
+		n, err := l.clients[name].PurgeOutboxEvents(ctx, before)
+		if err != nil {
+			return purged, errors.Wrap(err, fmt.Sprintf("[fisher] purge outbox namespace %s failed", name))
+		}
+		purged[name] = n
+	}
+	return purged, nil
+}
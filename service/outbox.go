@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+
+	"github.com/zjn-zjn/fisher/dao"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// OutboxBatchSize 投递事件每批读取的事件数
+const OutboxBatchSize = 500
+
+// Publisher 事件投递方，见dao.Publisher
+type Publisher = dao.Publisher
+
+// RelayOutbox 将转移变为半成功、成功、回滚完成时写入的事件投递给publisher，返回本轮投递结果
+// 事件与状态变更在同一本地事务内写入，状态变更提交则事件一定存在，包括Transfer中异步推进的半成功转移
+// 至少投递一次，投递成功但标记失败或进程中断时会重复投递，下游需按(转移ID, 转移场景, 变更后状态)去重
+// 同一转移的事件按写入顺序投递，多实例同时执行可能打乱顺序，需保证同一时间只有一个实例执行，可定时调用
+func RelayOutbox(ctx context.Context, publisher Publisher) (*model.RelayReport, error) {
+	return defaultClient().RelayOutbox(ctx, publisher)
+}
+
+// RelayOutbox 投递转移状态变更事件，见包级函数RelayOutbox
+func (c *Client) RelayOutbox(ctx context.Context, publisher Publisher) (*model.RelayReport, error) {
+	return c.ledger.RelayOutbox(ctx, publisher, OutboxBatchSize)
+}
+
+// PurgeOutboxEvents 删除更新时间早于before(毫秒)的已投递事件，返回删除的数量，待投递的事件不删除
+func PurgeOutboxEvents(ctx context.Context, before int64) (int64, error) {
+	return defaultClient().PurgeOutboxEvents(ctx, before)
+}
+
+// PurgeOutboxEvents 删除已投递的事件，见包级函数PurgeOutboxEvents
+func (c *Client) PurgeOutboxEvents(ctx context.Context, before int64) (int64, error) {
+	return c.ledger.Store().PurgeOutboxEvents(ctx, before)
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// testPublisher 记录收到的事件，fail返回true的事件投递失败
+type testPublisher struct {
+	events []*model.OutboxEvent
+	fail   func(event *model.OutboxEvent) bool
+}
+
+func (p *testPublisher) Publish(ctx context.Context, event *model.OutboxEvent) error {
+	if p.fail != nil && p.fail(event) {
+		return errors.New("downstream unavailable")
+	}
+	p.events = append(p.events, event)
+	return nil
+}
+
+func TestRelayOutbox(t *testing.T) {
+	forEachStore(t, testRelayOutbox)
+}
+
+func testRelayOutbox(t *testing.T) {
+	ctx := context.Background()
+	recharge(t, 1, userAccountA, 300)
+	if err := Transfer(ctx, buyReq(2)); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	if err := Rollback(ctx, &model.RollbackReq{TransferId: 2, TransferScene: TransferSceneBuyGoods}); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+	//空回滚直接创建为回滚完成
+	if err := Rollback(ctx, &model.RollbackReq{TransferId: 3, TransferScene: TransferSceneBuyGoods}); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+
+	//转移2的第一个事件投递失败，之后的事件推迟
+	publisher := &testPublisher{fail: func(event *model.OutboxEvent) bool {
+		return event.TransferId == 2
+	}}
+	report, err := RelayOutbox(ctx, publisher)
+	if err != nil {
+		t.Fatalf("failed to relay: %v", err)
+	}
+	if report.Published != 2 || report.Failed != 1 || report.Deferred != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	for _, event := range publisher.events {
+		if event.TransferId == 1 && (event.FromStatus != basic.StateStatusDoing || event.ToStatus != basic.StateStatusSuccess) ||
+			event.TransferId == 3 && (event.FromStatus != 0 || event.ToStatus != basic.StateStatusRollbackDone) {
+			t.Fatalf("unexpected event: %+v", event)
+		}
+	}
+
+	//恢复后按写入顺序重试
+	publisher = &testPublisher{}
+	if report, err = RelayOutbox(ctx, publisher); err != nil {
+		t.Fatalf("failed to relay: %v", err)
+	}
+	if report.Published != 2 || report.Failed != 0 || report.Deferred != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if publisher.events[0].ToStatus != basic.StateStatusSuccess || publisher.events[0].Attempts != 1 || publisher.events[0].LastError == "" ||
+		publisher.events[1].FromStatus != basic.StateStatusRollbackDoing || publisher.events[1].ToStatus != basic.StateStatusRollbackDone {
+		t.Fatalf("unexpected events: %+v %+v", publisher.events[0], publisher.events[1])
+	}
+
+	//已投递的事件不再投递
+	publisher = &testPublisher{}
+	if report, err = RelayOutbox(ctx, publisher); err != nil {
+		t.Fatalf("failed to relay: %v", err)
+	}
+	if report.Published != 0 || len(publisher.events) != 0 {
+		t.Fatalf("expect nothing to relay, got %+v", report)
+	}
+
+	purged, err := PurgeOutboxEvents(ctx, time.Now().UnixMilli()+1)
+	if err != nil {
+		t.Fatalf("failed to purge: %v", err)
+	}
+	if purged != 4 {
+		t.Fatalf("purged got %d want 4", purged)
+	}
+}
@@ -0,0 +1,19 @@
+package service
+
+import (
+	"context"
+
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// Reconcile 零和对账，汇总全部库和分表中每种物品的账户数量之和与生效记录的变动之和
+// 进行中的转移已生效的变动单独列出，扣除后仍不为0或账户与记录不一致时为真实差异，见ReconcileReport.HasDiscrepancy
+// 全表扫描，建议在业务低峰定期执行，出现差异时可重新执行排除扫描期间完成的转移造成的暂时差异
+func Reconcile(ctx context.Context) (*model.ReconcileReport, error) {
+	return defaultClient().Reconcile(ctx)
+}
+
+// Reconcile 零和对账，见包级函数Reconcile
+func (c *Client) Reconcile(ctx context.Context) (*model.ReconcileReport, error) {
+	return c.ledger.Reconcile(ctx)
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/dao"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+func TestReconcile(t *testing.T) {
+	forEachStore(t, testReconcile)
+}
+
+func reconcileGold(t *testing.T) (*model.ReconcileReport, *model.ReconcileItem) {
+	t.Helper()
+	report, err := Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("failed to reconcile: %v", err)
+	}
+	if len(report.Items) != 1 || report.Items[0].ItemType != ItemTypeGold {
+		t.Fatalf("unexpected items: %+v", report.Items)
+	}
+	return report, report.Items[0]
+}
+
+func testReconcile(t *testing.T) {
+	ctx := context.Background()
+	recharge(t, 1, userAccountA, 300)
+	if err := Transfer(ctx, buyReq(2)); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	report, item := reconcileGold(t)
+	if item.AccountTotal != 0 || item.RecordTotal != 0 || len(report.InFlight) != 0 || report.HasDiscrepancy() {
+		t.Fatalf("unexpected reconcile: %+v %+v", report, item)
+	}
+
+	//转移只完成了扣款
+	ledger := defaultClient().ledger
+	if _, err := ledger.GetOrCreateState(ctx, buyReq(3)); err != nil {
+		t.Fatalf("failed to create state: %v", err)
+	}
+	if err := ledger.DeductionAccount(ctx, userAccountA, 3, 100, ItemTypeGold, TransferSceneBuyGoods, basic.RecordStatusNormal, ChangeTypeSpend, ""); err != nil {
+		t.Fatalf("failed to deduct: %v", err)
+	}
+	report, item = reconcileGold(t)
+	if item.AccountTotal != -100 || item.InFlight != -100 || len(report.InFlight) != 1 || report.HasDiscrepancy() {
+		t.Fatalf("unexpected reconcile with transfer in flight: %+v %+v", report, item)
+	}
+
+	//绕过记录直接修改账户
+	if _, err := dao.GetStore().IncreaseAccountAmount(ctx, userAccountB, 5, ItemTypeGold); err != nil {
+		t.Fatalf("failed to increase: %v", err)
+	}
+	report, item = reconcileGold(t)
+	if item.Discrepancy != 5 || item.Mismatch != 5 || !report.HasDiscrepancy() {
+		t.Fatalf("expect discrepancy, got %+v", item)
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// Refund 部分退款
+// 对已成功的转移按记录退还指定金额，从原收款方扣回，退还给原付款方，每条记录的累计退款不超过转移金额
+// 退款是一次以RefundId为转移ID的转移，按RefundId幂等，同样可以Rollback，回滚后已退款金额恢复
+// 已有退款的转移不能再整体Rollback
+func Refund(ctx context.Context, req *model.RefundReq) error {
+	return defaultClient().Refund(ctx, req)
+}
+
+// Refund 部分退款，见包级函数Refund
+func (c *Client) Refund(ctx context.Context, req *model.RefundReq) error {
+	if req == nil || req.RefundId <= 0 || req.TransferId <= 0 || req.TransferScene <= 0 || len(req.Items) == 0 {
+		return basic.NewParamsError(errors.New("[fisher] refund params error"))
+	}
+	refundScene := req.RefundScene
+	if refundScene == 0 {
+		refundScene = req.TransferScene
+	}
+	if req.RefundId == req.TransferId && refundScene == req.TransferScene {
+		return basic.NewParamsError(errors.New("refund id is the same as transfer id"))
+	}
+	state, err := c.ledger.Store().GetState(ctx, req.TransferId, req.TransferScene)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return basic.NewParamsError(fmt.Errorf("transfer %d not found", req.TransferId))
+	}
+	switch state.Status {
+	case basic.StateStatusSuccess:
+	case basic.StateStatusRollbackDoing, basic.StateStatusRollbackDone:
+		return basic.AlreadyRolledBackErr
+	default:
+		//转移未完成，不能退款
+		return basic.StateMutationErr
+	}
+	transferReq, err := assembleRefundTransfer(c.ledger.Official(), state, req, refundScene)
+	if err != nil {
+		return basic.NewParamsError(err)
+	}
+	return c.executeTransfer(ctx, transferReq)
+}
+
+// assembleRefundTransfer 将退款转为反向转移，原收款方为付款方，原付款方为收款方
+func assembleRefundTransfer(official *basic.OfficialAccount, state *model.State, req *model.RefundReq, refundScene basic.TransferScene) (*model.TransferReq, error) {
+	musk := findFirstNonOfficialAccountMusk(official, &model.TransferReq{FromAccounts: state.FromAccounts, ToAccounts: state.ToAccounts})
+	//官方账户在原转移中使用的是子账户
+	match := func(leg *model.TransferItem, item *model.RefundItem) bool {
+		if leg.ItemType != item.ItemType || leg.ChangeType != item.ChangeType {
+			return false
+		}
+		if leg.AccountId == item.AccountId {
+			return true
+		}
+		return musk != nil && official.IsOfficialAccount(item.AccountId) && official.GetMixOfficialAccountId(item.AccountId, *musk) == leg.AccountId
+	}
+	find := func(legs model.AccountList, item *model.RefundItem) *model.TransferItem {
+		for _, leg := range legs {
+			if match(leg, item) {
+				return leg
+			}
+		}
+		return nil
+	}
+	transferReq := &model.TransferReq{TransferId: req.RefundId, TransferScene: refundScene, Comment: req.Comment}
+	refunded := make(map[*model.TransferItem]bool)
+	totalMap := make(map[basic.ItemType]int64)
+	for _, item := range req.Items {
+		leg, transferType := find(state.ToAccounts, item), basic.RecordTypeAdd
+		if leg == nil {
+			leg, transferType = find(state.FromAccounts, item), basic.RecordTypeDeduct
+		}
+		if leg == nil {
+			return nil, fmt.Errorf("account %d item type %d change type %d not found in transfer %d", item.AccountId, item.ItemType, item.ChangeType, req.TransferId)
+		}
+		if refunded[leg] {
+			return nil, fmt.Errorf("duplicate refund item of account %d", item.AccountId)
+		}
+		refunded[leg] = true
+		if item.Amount <= 0 || item.Amount > leg.Amount {
+			return nil, fmt.Errorf("invalid refund amount %d of account %d, transferred %d", item.Amount, item.AccountId, leg.Amount)
+		}
+		refundItem := &model.TransferItem{
+			AccountId:  leg.AccountId,
+			ItemType:   leg.ItemType,
+			Amount:     item.Amount,
+			ChangeType: leg.ChangeType,
+			Comment:    req.Comment,
+			Refund:     &model.RefundOf{TransferId: state.TransferId, TransferScene: state.TransferScene, TransferType: transferType},
+		}
+		if transferType == basic.RecordTypeAdd {
+			transferReq.FromAccounts = append(transferReq.FromAccounts, refundItem)
+			totalMap[item.ItemType] -= item.Amount
+		} else {
+			transferReq.ToAccounts = append(transferReq.ToAccounts, refundItem)
+			totalMap[item.ItemType] += item.Amount
+		}
+	}
+	if len(transferReq.FromAccounts) == 0 || len(transferReq.ToAccounts) == 0 {
+		return nil, errors.New("refund needs both payer and payee items")
+	}
+	for itemType, total := range totalMap {
+		if total != 0 {
+			return nil, fmt.Errorf("unbalanced refund amounts item type:%d", itemType)
+		}
+	}
+	return transferReq, nil
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+func refundReq(refundId, payer, seller, copyright int64) *model.RefundReq {
+	return &model.RefundReq{
+		RefundId:      refundId,
+		TransferId:    2,
+		TransferScene: TransferSceneBuyGoods,
+		Items: []*model.RefundItem{
+			{AccountId: userAccountA, ItemType: ItemTypeGold, ChangeType: ChangeTypeSpend, Amount: payer},
+			{AccountId: userAccountB, ItemType: ItemTypeGold, ChangeType: ChangeTypeSellGoodsIncome, Amount: seller},
+			{AccountId: userAccountC, ItemType: ItemTypeGold, ChangeType: ChangeTypeSellGoodsCopyright, Amount: copyright},
+		},
+	}
+}
+
+func TestPartialRefund(t *testing.T) {
+	forEachStore(t, testPartialRefund)
+}
+
+func testPartialRefund(t *testing.T) {
+	ctx := context.Background()
+	recharge(t, 1, userAccountA, 100)
+	if err := Transfer(ctx, buyReq(2)); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+
+	if err := Refund(ctx, refundReq(3, 30, 27, 3)); err != nil {
+		t.Fatalf("failed to refund: %v", err)
+	}
+	//幂等
+	if err := Refund(ctx, refundReq(3, 30, 27, 3)); err != nil {
+		t.Fatalf("failed to refund again: %v", err)
+	}
+	assertAmount(t, userAccountA, 30)
+	assertAmount(t, userAccountB, 63)
+	assertAmount(t, userAccountC, 7)
+
+	if err := Refund(ctx, refundReq(4, 70, 63, 7)); err != nil {
+		t.Fatalf("failed to refund the rest: %v", err)
+	}
+	assertAmount(t, userAccountA, 100)
+	assertAmount(t, userAccountB, 0)
+
+	//累计退款超过转移金额
+	recharge(t, 5, userAccountB, 10)
+	if err := Refund(ctx, refundReq(6, 1, 1, 0)); !basic.Is(err, basic.ParamsErr) {
+		t.Fatalf("expect params error for zero amount item, got %v", err)
+	}
+	exceeded := refundReq(6, 1, 1, 0)
+	exceeded.Items = exceeded.Items[:2]
+	if err := Refund(ctx, exceeded); !basic.Is(err, basic.RefundExceededErr) {
+		t.Fatalf("expect refund exceeded, got %v", err)
+	}
+	assertAmount(t, userAccountA, 100)
+	assertAmount(t, userAccountB, 10)
+
+	if err := Rollback(ctx, &model.RollbackReq{TransferId: 2, TransferScene: TransferSceneBuyGoods}); !basic.Is(err, basic.StateMutationErr) {
+		t.Fatalf("expect state mutation for rollback of refunded transfer, got %v", err)
+	}
+	//回滚退款后可以再次退款
+	if err := Rollback(ctx, &model.RollbackReq{TransferId: 4, TransferScene: TransferSceneBuyGoods}); err != nil {
+		t.Fatalf("failed to rollback refund: %v", err)
+	}
+	assertAmount(t, userAccountA, 30)
+	assertAmount(t, userAccountB, 73)
+	exceeded.RefundId = 7
+	if err := Refund(ctx, exceeded); err != nil {
+		t.Fatalf("failed to refund after rollback: %v", err)
+	}
+	assertAmount(t, userAccountA, 31)
+	assertAmount(t, userAccountB, 72)
+}
+
+func TestRefundRollbackInterleave(t *testing.T) {
+	forEachStore(t, testRefundRollbackInterleave)
+}
+
+func testRefundRollbackInterleave(t *testing.T) {
+	ctx := context.Background()
+	recharge(t, 1, userAccountA, 100)
+	if err := Transfer(ctx, buyReq(2)); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	store := defaultClient().ledger.Store()
+
+	//回滚检查退款后、更新为回滚中之前，退款完成
+	if _, err := store.UpdateStateToRollbackDoing(ctx, 2, TransferSceneBuyGoods); err != nil {
+		t.Fatalf("failed to update state: %v", err)
+	}
+	state, err := store.GetState(ctx, 2, TransferSceneBuyGoods)
+	if err != nil {
+		t.Fatalf("failed to get state: %v", err)
+	}
+	state.Status = basic.StateStatusSuccess
+	refund, err := assembleRefundTransfer(defaultClient().ledger.Official(), state, refundReq(3, 30, 27, 3), TransferSceneBuyGoods)
+	if err != nil {
+		t.Fatalf("failed to assemble refund: %v", err)
+	}
+	if err = defaultClient().executeTransfer(ctx, refund); err != nil {
+		t.Fatalf("failed to refund: %v", err)
+	}
+	if err = Rollback(ctx, &model.RollbackReq{TransferId: 2, TransferScene: TransferSceneBuyGoods}); !basic.Is(err, basic.StateMutationErr) {
+		t.Fatalf("expect state mutation for rollback after refund, got %v", err)
+	}
+	//退款只退还一次
+	assertAmount(t, userAccountA, 30)
+	assertAmount(t, userAccountB, 63)
+	assertAmount(t, userAccountC, 7)
+
+	//回滚退款后原转移的回滚可以继续
+	if err = Rollback(ctx, &model.RollbackReq{TransferId: 3, TransferScene: TransferSceneBuyGoods}); err != nil {
+		t.Fatalf("failed to rollback refund: %v", err)
+	}
+	if err = Rollback(ctx, &model.RollbackReq{TransferId: 2, TransferScene: TransferSceneBuyGoods}); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+	assertAmount(t, userAccountA, 100)
+	assertAmount(t, userAccountB, 0)
+	assertAmount(t, userAccountC, 0)
+
+	//退款读取到成功状态后，回滚先完成，退款失败并回滚
+	recharge(t, 4, userAccountB, 50)
+	recharge(t, 5, userAccountC, 50)
+	refund.TransferId = 6
+	if err = defaultClient().executeTransfer(ctx, refund); !basic.Is(err, basic.RefundExceededErr) {
+		t.Fatalf("expect refund exceeded after rollback, got %v", err)
+	}
+	assertAmount(t, userAccountA, 100)
+	assertAmount(t, userAccountB, 50)
+	assertAmount(t, userAccountC, 50)
+}
+
+func TestRefundHalfSuccessInspection(t *testing.T) {
+	forEachStore(t, testRefundHalfSuccessInspection)
+}
+
+func testRefundHalfSuccessInspection(t *testing.T) {
+	ctx := context.Background()
+	recharge(t, 1, userAccountA, 100)
+	if err := Transfer(ctx, buyReq(2)); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	//模拟退款扣回收款方后进程退出，状态停留在半成功，退还付款方由Inspection推进
+	ledger := defaultClient().ledger
+	state, err := ledger.Store().GetState(ctx, 2, TransferSceneBuyGoods)
+	if err != nil {
+		t.Fatalf("failed to get state: %v", err)
+	}
+	req, err := assembleRefundTransfer(ledger.Official(), state, refundReq(3, 30, 27, 3), TransferSceneBuyGoods)
+	if err != nil {
+		t.Fatalf("failed to assemble refund: %v", err)
+	}
+	if _, err = ledger.GetOrCreateState(ctx, req); err != nil {
+		t.Fatalf("failed to create state: %v", err)
+	}
+	for _, account := range req.FromAccounts {
+		if err = createDeductionTx(ledger, req, account).Exec(ctx); err != nil {
+			t.Fatalf("failed to deduct: %v", err)
+		}
+	}
+	if _, err = ledger.Store().UpdateStateStatus(ctx, 3, TransferSceneBuyGoods, basic.StateStatusDoing, basic.StateStatusHalfSuccess); err != nil {
+		t.Fatalf("failed to update state: %v", err)
+	}
+	if errs := Inspection(ctx, time.Now().UnixMilli()); len(errs) > 0 {
+		t.Fatalf("failed to inspection: %v", errs)
+	}
+	assertAmount(t, userAccountA, 30)
+	assertAmount(t, userAccountB, 63)
+	origin, err := ledger.Store().GetRecord(ctx, userAccountA, 2, ItemTypeGold, TransferSceneBuyGoods, basic.RecordTypeDeduct, ChangeTypeSpend)
+	if err != nil {
+		t.Fatalf("failed to get record: %v", err)
+	}
+	if origin.RefundedAmount != 30 {
+		t.Fatalf("refunded amount got %d want 30", origin.RefundedAmount)
+	}
+	if err = Rollback(ctx, &model.RollbackReq{TransferId: 2, TransferScene: TransferSceneBuyGoods}); !basic.Is(err, basic.StateMutationErr) {
+		t.Fatalf("expect state mutation for rollback of refunded transfer, got %v", err)
+	}
+	if err = Refund(ctx, refundReq(4, 70, 63, 7)); err != nil {
+		t.Fatalf("failed to refund the rest: %v", err)
+	}
+	assertAmount(t, userAccountA, 100)
+}
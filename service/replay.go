@@ -0,0 +1,23 @@
+package service
+
+import (
+	"context"
+
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// ReplayBatchSize 回放每批遍历的账户物品数
+const ReplayBatchSize = 500
+
+// ReplayAccounts 按记录回放重建每个账户物品的数量，用于账户表损坏或从旧备份恢复后的修复
+// 只有正常状态的增减记录生效，已回滚和空回滚的记录不计入，与DeductionAccount、IncreaseAccount的处理一致，冻结数量不重建
+// apply为false时只对比并返回不一致的账户，为true时在账户所在实例的本地事务内锁定账户后修正数量和数量变更序号，可在线执行
+// 只对比时不加锁，执行期间仍有转移的账户可能出现暂时差异，可对差异账户重新执行确认
+func ReplayAccounts(ctx context.Context, apply bool) (*model.ReplayReport, error) {
+	return defaultClient().ReplayAccounts(ctx, apply)
+}
+
+// ReplayAccounts 按记录回放重建账户数量，见包级函数ReplayAccounts
+func (c *Client) ReplayAccounts(ctx context.Context, apply bool) (*model.ReplayReport, error) {
+	return c.ledger.ReplayAccounts(ctx, apply, ReplayBatchSize)
+}
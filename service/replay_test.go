@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/dao"
+	"github.com/zjn-zjn/fisher/dao/memory"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+func TestReplayAccounts(t *testing.T) {
+	forEachStore(t, testReplayAccounts)
+}
+
+func replay(t *testing.T, apply bool) *model.ReplayReport {
+	t.Helper()
+	report, err := ReplayAccounts(context.Background(), apply)
+	if err != nil {
+		t.Fatalf("failed to replay: %v", err)
+	}
+	return report
+}
+
+func testReplayAccounts(t *testing.T) {
+	ctx := context.Background()
+	recharge(t, 1, userAccountA, 300)
+	if err := Transfer(ctx, buyReq(2)); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	if err := Transfer(ctx, buyReq(3)); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	if err := Rollback(ctx, &model.RollbackReq{TransferId: 3, TransferScene: TransferSceneBuyGoods}); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+	report := replay(t, false)
+	if report.Checked != 4 || len(report.Diffs) != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	//绕过记录直接修改账户，以及没有任何记录的账户
+	store := dao.GetStore()
+	if _, err := store.IncreaseAccountAmount(ctx, userAccountB, 5, ItemTypeGold); err != nil {
+		t.Fatalf("failed to increase: %v", err)
+	}
+	userAccountD := userAccountC + 1
+	if _, err := store.GetOrCreateAccount(ctx, userAccountD, ItemTypeGold); err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	if _, err := store.IncreaseAccountAmount(ctx, userAccountD, 7, ItemTypeGold); err != nil {
+		t.Fatalf("failed to increase: %v", err)
+	}
+	report = replay(t, false)
+	if report.Checked != 5 || len(report.Diffs) != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	for _, diff := range report.Diffs {
+		if diff.AccountId == userAccountB && (diff.LiveAmount != 95 || diff.ReplayAmount != 90) ||
+			diff.AccountId == userAccountD && (diff.LiveAmount != 7 || diff.ReplayAmount != 0) {
+			t.Fatalf("unexpected diff: %+v", diff)
+		}
+	}
+	if amount, _ := GetAccountAmountByItemTypeWrite(ctx, userAccountB, ItemTypeGold); amount != 95 {
+		t.Fatalf("dry run should not change account, got %d", amount)
+	}
+
+	report = replay(t, true)
+	if !report.Applied || len(report.Diffs) != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	for accountId, want := range map[int64]int64{userAccountA: 200, userAccountB: 90, userAccountC: 10, userAccountD: 0} {
+		if amount, _ := GetAccountAmountByItemTypeWrite(ctx, accountId, ItemTypeGold); amount != want {
+			t.Fatalf("account %d expect %d, got %d", accountId, want, amount)
+		}
+	}
+	if report = replay(t, false); len(report.Diffs) != 0 {
+		t.Fatalf("expect no diff after apply, got %+v", report.Diffs)
+	}
+}
+
+func TestReplayFrozenAccount(t *testing.T) {
+	forEachStore(t, testReplayFrozenAccount)
+}
+
+func testReplayFrozenAccount(t *testing.T) {
+	if _, ok := dao.GetStore().(*memory.Store); ok {
+		t.Skip("内存存储不能直接删除账户行")
+	}
+	ctx := context.Background()
+	recharge(t, 1, userAccountA, 300)
+	//冻结中、已扣款、已解冻各一笔，只有冻结中的计入冻结数量
+	if err := Freeze(ctx, freezeReq(2, 40)); err != nil {
+		t.Fatalf("failed to freeze: %v", err)
+	}
+	if err := Freeze(ctx, freezeReq(3, 100)); err != nil {
+		t.Fatalf("failed to freeze: %v", err)
+	}
+	if err := Capture(ctx, captureReq(3)); err != nil {
+		t.Fatalf("failed to capture: %v", err)
+	}
+	if err := Freeze(ctx, freezeReq(4, 20)); err != nil {
+		t.Fatalf("failed to freeze: %v", err)
+	}
+	if err := Unfreeze(ctx, unfreezeReq(4)); err != nil {
+		t.Fatalf("failed to unfreeze: %v", err)
+	}
+	assertFrozen(t, userAccountA, 200, 40)
+	if report := replay(t, false); len(report.Diffs) != 0 {
+		t.Fatalf("unexpected diffs: %+v", report.Diffs)
+	}
+
+	//冻结中的账户行丢失
+	layout := basic.GetLayout()
+	err := layout.GetRecordAndAccountWriteDB(ctx, userAccountA).Table(layout.GetAccountTableName(userAccountA)).
+		Where("account_id = ? and item_type = ?", userAccountA, ItemTypeGold).Delete(&model.Account{}).Error
+	if err != nil {
+		t.Fatalf("failed to delete account: %v", err)
+	}
+	report := replay(t, false)
+	if len(report.Diffs) != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if diff := report.Diffs[0]; !diff.Missing || diff.ReplayAmount != 200 || diff.ReplayFrozen != 40 {
+		t.Fatalf("unexpected diff: %+v", diff)
+	}
+
+	report = replay(t, true)
+	if len(report.Diffs) != 1 || !report.Diffs[0].Missing {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	assertFrozen(t, userAccountA, 200, 40)
+	if report = replay(t, false); len(report.Diffs) != 0 {
+		t.Fatalf("expect no diff after apply, got %+v", report.Diffs)
+	}
+	//冻结的部分仍不可用
+	if err = Freeze(ctx, freezeReq(5, 161)); !basic.Is(err, basic.InsufficientAmountErr) {
+		t.Fatalf("expect insufficient amount, got %v", err)
+	}
+	if err = Unfreeze(ctx, unfreezeReq(2)); err != nil {
+		t.Fatalf("failed to unfreeze: %v", err)
+	}
+	assertFrozen(t, userAccountA, 200, 0)
+}
@@ -8,8 +8,6 @@ import (
 
 	"github.com/zjn-zjn/fisher/dao"
 
-	"gorm.io/gorm"
-
 	"github.com/zjn-zjn/fisher/basic"
 	"github.com/zjn-zjn/fisher/model"
 )
@@ -19,13 +17,19 @@ import (
 // 1. 当前已回滚成功，直接返回
 // 2. 将非回滚成功状态转化成回滚中，执行回滚操作
 func Rollback(ctx context.Context, req *model.RollbackReq) error {
+	return defaultClient().Rollback(ctx, req)
+}
+
+// Rollback 回滚转移，见包级函数Rollback
+func (c *Client) Rollback(ctx context.Context, req *model.RollbackReq) error {
 	if req == nil || req.TransferId == 0 || req.TransferScene == 0 {
 		return basic.NewParamsError(errors.New("[fisher] rollback transfer params error"))
 	}
+	store := c.ledger.Store()
 	var state *model.State
-	err := dao.StateInstanceTX(ctx, req.TransferId, func(ctx context.Context, db *gorm.DB) error {
+	err := store.StateInstanceTX(ctx, req.TransferId, func(ctx context.Context, tx dao.Store) error {
 		var err error
-		state, err = dao.GetState(ctx, req.TransferId, req.TransferScene, db)
+		state, err = tx.GetState(ctx, req.TransferId, req.TransferScene)
 		if err != nil {
 			return err
 		}
@@ -36,7 +40,7 @@ func Rollback(ctx context.Context, req *model.RollbackReq) error {
 			//如果回滚成功，不做记录，A认为回滚成功，那么转移到达B时可能会触发正常转移
 			//那为什么找不到事务就直接返回报错呢？
 			//因为如果A调用B的转移，不能正常触达B，B无法生成转移记录，那么这次回滚就一直不能够成功
-			if err = dao.CreateState(ctx, state, db); err != nil {
+			if err = tx.CreateState(ctx, state); err != nil {
 				return err
 			}
 		}
@@ -49,8 +53,19 @@ func Rollback(ctx context.Context, req *model.RollbackReq) error {
 		//已成功回滚，直接return
 		return nil
 	}
+	if state.Status == basic.StateStatusSuccess || state.Status == basic.StateStatusHalfSuccess {
+		//已有退款的转移不能整体回滚，否则会重复退还，剩余部分需使用Refund
+		//检查后仍可能有退款并发完成，回滚原记录时按已退款金额条件更新，冲突的回滚停在回滚中并返回StateMutationErr，回滚退款后由Inspection继续
+		refunded, err := c.hasRefund(ctx, state)
+		if err != nil {
+			return err
+		}
+		if refunded {
+			return basic.StateMutationErr
+		}
+	}
 	if state.Status != basic.StateStatusRollbackDoing {
-		affect, err := dao.UpdateStateToRollbackDoing(ctx, req.TransferId, req.TransferScene)
+		affect, err := store.UpdateStateToRollbackDoing(ctx, req.TransferId, req.TransferScene)
 		if err != nil {
 			return err
 		}
@@ -62,7 +77,14 @@ func Rollback(ctx context.Context, req *model.RollbackReq) error {
 	//对加的账户进行扣减
 	for _, v := range state.ToAccounts {
 		v := v
-		err = dao.DeductionAccount(ctx, v.AccountId, state.TransferId, v.Amount, v.ItemType, req.TransferScene, basic.RecordStatusRollback, v.ChangeType, fmt.Sprintf("rollback %s", v.Comment))
+		if v.Refund != nil {
+			err = c.ledger.RefundDeductionAccount(ctx, v.Refund, v.AccountId, state.TransferId, v.Amount, v.ItemType, req.TransferScene, basic.RecordStatusRollback, v.ChangeType, fmt.Sprintf("rollback %s", v.Comment))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err = c.ledger.DeductionAccount(ctx, v.AccountId, state.TransferId, v.Amount, v.ItemType, req.TransferScene, basic.RecordStatusRollback, v.ChangeType, fmt.Sprintf("rollback %s", v.Comment))
 		if err != nil {
 			return err
 		}
@@ -70,14 +92,49 @@ func Rollback(ctx context.Context, req *model.RollbackReq) error {
 	//对加的账户进行扣减
 	for _, v := range state.FromAccounts {
 		v := v
-		err = dao.IncreaseAccount(ctx, v.AccountId, state.TransferId, v.Amount, v.ItemType, req.TransferScene, basic.RecordStatusRollback, v.ChangeType, fmt.Sprintf("rollback %s", v.Comment))
+		if v.Frozen {
+			//扣款回滚，恢复冻结
+			err = c.ledger.RollbackCaptureAccount(ctx, v.AccountId, state.TransferId, v.ItemType, req.TransferScene, v.ChangeType, fmt.Sprintf("rollback %s", v.Comment))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if v.Refund != nil {
+			err = c.ledger.RefundIncreaseAccount(ctx, v.Refund, v.AccountId, state.TransferId, v.Amount, v.ItemType, req.TransferScene, basic.RecordStatusRollback, v.ChangeType, fmt.Sprintf("rollback %s", v.Comment))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err = c.ledger.IncreaseAccount(ctx, v.AccountId, state.TransferId, v.Amount, v.ItemType, req.TransferScene, basic.RecordStatusRollback, v.ChangeType, fmt.Sprintf("rollback %s", v.Comment))
 		if err != nil {
 			return err
 		}
 	}
-	err = dao.UpdateStateStatus(ctx, req.TransferId, req.TransferScene, basic.StateStatusRollbackDoing, basic.StateStatusRollbackDone)
+	_, err = store.UpdateStateStatus(ctx, req.TransferId, req.TransferScene, basic.StateStatusRollbackDoing, basic.StateStatusRollbackDone)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// hasRefund 转移的记录是否已有退款
+func (c *Client) hasRefund(ctx context.Context, state *model.State) (bool, error) {
+	legs := []struct {
+		accounts     model.AccountList
+		transferType basic.TransferType
+	}{{state.FromAccounts, basic.RecordTypeDeduct}, {state.ToAccounts, basic.RecordTypeAdd}}
+	for _, leg := range legs {
+		for _, v := range leg.accounts {
+			record, err := c.ledger.Store().GetRecord(ctx, v.AccountId, state.TransferId, v.ItemType, state.TransferScene, leg.transferType, v.ChangeType)
+			if err != nil {
+				return false, err
+			}
+			if record != nil && record.RefundedAmount > 0 {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+// SnapshotBatchSize 快照任务每批遍历的账户数
+const SnapshotBatchSize = 500
+
+// SnapshotAccounts 为全部账户写入截止cutOff(毫秒，包含)时每种物品的数量快照，通常每天在零点后执行一次
+// 遍历全部库和账户分表，快照写入账户所在库的account_snapshot表，之后的时间点查询从快照开始计算
+// 按截止时间幂等，任务中断后使用相同的cutOff重新执行即可，已写入的快照会被跳过
+// 截止时间需早于当前时间，建议留出几分钟，避免截止前开始的本地事务在快照之后才提交
+func SnapshotAccounts(ctx context.Context, cutOff int64) (*model.SnapshotReport, error) {
+	return defaultClient().SnapshotAccounts(ctx, cutOff)
+}
+
+// SnapshotAccounts 写入账户数量快照，见包级函数SnapshotAccounts
+func (c *Client) SnapshotAccounts(ctx context.Context, cutOff int64) (*model.SnapshotReport, error) {
+	if cutOff <= 0 {
+		return nil, basic.NewParamsError(errors.New("[fisher] snapshot params error"))
+	}
+	if cutOff >= time.Now().UnixMilli() {
+		return nil, basic.NewParamsError(fmt.Errorf("snapshot cut off %d is not in the past", cutOff))
+	}
+	return c.ledger.SnapshotAccounts(ctx, cutOff, SnapshotBatchSize)
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/dao"
+	"github.com/zjn-zjn/fisher/model"
+)
+
+func TestSnapshotAccounts(t *testing.T) {
+	forEachStore(t, testSnapshotAccounts)
+}
+
+func testSnapshotAccounts(t *testing.T) {
+	ctx := context.Background()
+	mark := func() int64 {
+		time.Sleep(5 * time.Millisecond)
+		ts := time.Now().UnixMilli()
+		time.Sleep(5 * time.Millisecond)
+		return ts
+	}
+	recharge(t, 1, userAccountA, 300)
+	if err := Transfer(ctx, buyReq(2)); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	cutOff := mark()
+	if err := Transfer(ctx, buyReq(3)); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	afterTransfer := mark()
+
+	if _, err := SnapshotAccounts(ctx, time.Now().Add(time.Minute).UnixMilli()); !basic.Is(err, basic.ParamsErr) {
+		t.Fatalf("expect params error for future cut off, got %v", err)
+	}
+	//官方账户、A、B、C
+	report, err := SnapshotAccounts(ctx, cutOff)
+	if err != nil {
+		t.Fatalf("failed to snapshot: %v", err)
+	}
+	if report.Created != 4 || report.Skipped != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	//中断后重新执行，跳过已写入的快照
+	if report, err = SnapshotAccounts(ctx, cutOff); err != nil {
+		t.Fatalf("failed to snapshot again: %v", err)
+	}
+	if report.Created != 0 || report.Skipped != 4 {
+		t.Fatalf("unexpected report of rerun: %+v", report)
+	}
+	snapshot, err := dao.GetStore().GetAccountSnapshot(ctx, userAccountA, ItemTypeGold, cutOff)
+	if err != nil {
+		t.Fatalf("failed to get snapshot: %v", err)
+	}
+	if snapshot == nil || snapshot.Amount != 200 || snapshot.Sequence != 2 {
+		t.Fatalf("unexpected snapshot: %+v", snapshot)
+	}
+
+	if err = Rollback(ctx, &model.RollbackReq{TransferId: 3, TransferScene: TransferSceneBuyGoods}); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+	afterRollback := mark()
+	//从快照开始计算
+	for _, c := range []struct {
+		timestamp, want int64
+	}{
+		{cutOff, 200},
+		{afterTransfer, 100},
+		{afterRollback, 200},
+	} {
+		amount, err := GetAccountAmountAt(ctx, userAccountA, ItemTypeGold, c.timestamp)
+		if err != nil {
+			t.Fatalf("failed to get amount at %d: %v", c.timestamp, err)
+		}
+		if amount != c.want {
+			t.Fatalf("amount at %d got %d want %d", c.timestamp, amount, c.want)
+		}
+	}
+}
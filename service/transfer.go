@@ -12,13 +12,37 @@ import (
 
 // Transfer 物品转移
 func Transfer(ctx context.Context, req *model.TransferReq) error {
-	if err := validateTransferRequest(req); err != nil {
+	return defaultClient().Transfer(ctx, req)
+}
+
+// Transfer 物品转移
+func (c *Client) Transfer(ctx context.Context, req *model.TransferReq) error {
+	for _, accounts := range [][]*model.TransferItem{req.FromAccounts, req.ToAccounts} {
+		for _, account := range accounts {
+			if account.Frozen {
+				return basic.NewParamsError(errors.New("frozen account is only allowed in capture"))
+			}
+			if account.Refund != nil {
+				return basic.NewParamsError(errors.New("refund account is only allowed in refund"))
+			}
+		}
+	}
+	return c.transfer(ctx, req)
+}
+
+func (c *Client) transfer(ctx context.Context, req *model.TransferReq) error {
+	official := c.ledger.Official()
+	if err := validateTransferRequest(official, req); err != nil {
 		return basic.NewParamsError(err)
 	}
 
-	handleOfficialAccounts(req)
+	handleOfficialAccounts(official, req)
+	return c.executeTransfer(ctx, req)
+}
 
-	state, err := dao.GetOrCreateState(ctx, req)
+// executeTransfer 创建转移状态并执行转移，req需已校验并完成官方账户的处理
+func (c *Client) executeTransfer(ctx context.Context, req *model.TransferReq) error {
+	state, err := c.ledger.GetOrCreateState(ctx, req)
 	if err != nil {
 		return err
 	}
@@ -34,15 +58,15 @@ func Transfer(ctx context.Context, req *model.TransferReq) error {
 		return basic.StateMutationErr
 	}
 
-	deductionTxs, increaseTxs, err := prepareTransferTransactions(req)
+	deductionTxs, increaseTxs, err := prepareTransferTransactions(c.ledger, req)
 	if err != nil {
 		return err
 	}
 
-	return dao.ExecuteTransfer(ctx, state, deductionTxs, increaseTxs, req.UseHalfSuccess)
+	return c.ledger.ExecuteTransfer(ctx, state, deductionTxs, increaseTxs, req.UseHalfSuccess)
 }
 
-func validateTransferRequest(req *model.TransferReq) error {
+func validateTransferRequest(official *basic.OfficialAccount, req *model.TransferReq) error {
 	if req.TransferId <= 0 || req.TransferScene <= 0 {
 		return errors.New("invalid transfer parameters")
 	}
@@ -56,7 +80,7 @@ func validateTransferRequest(req *model.TransferReq) error {
 	toTotalMap := make(map[basic.ItemType]int64)
 
 	for _, account := range req.FromAccounts {
-		if err := validateAccount(account, "from", uniqueAccounts); err != nil {
+		if err := validateAccount(official, account, "from", uniqueAccounts); err != nil {
 			return err
 		}
 		fromTotal := fromTotalMap[account.ItemType]
@@ -64,7 +88,7 @@ func validateTransferRequest(req *model.TransferReq) error {
 	}
 
 	for _, account := range req.ToAccounts {
-		if err := validateAccount(account, "to", uniqueAccounts); err != nil {
+		if err := validateAccount(official, account, "to", uniqueAccounts); err != nil {
 			return err
 		}
 		toTotal := toTotalMap[account.ItemType]
@@ -84,13 +108,13 @@ func validateTransferRequest(req *model.TransferReq) error {
 	return nil
 }
 
-func validateAccount(account *model.TransferItem, accountType string, uniqueAccounts map[string]struct{}) error {
+func validateAccount(official *basic.OfficialAccount, account *model.TransferItem, accountType string, uniqueAccounts map[string]struct{}) error {
 	if account.AccountId <= 0 {
 		return fmt.Errorf("invalid %s account ID: %d", accountType, account.AccountId)
 	}
 
-	if basic.IsOfficialAccount(account.AccountId) {
-		if !basic.CheckTransferOfficialAccount(account.AccountId) {
+	if official.IsOfficialAccount(account.AccountId) {
+		if !official.CheckTransferOfficialAccount(account.AccountId) {
 			return fmt.Errorf("invalid official %s account: %d", accountType, account.AccountId)
 		}
 	} else if account.Amount <= 0 {
@@ -106,16 +130,16 @@ func validateAccount(account *model.TransferItem, accountType string, uniqueAcco
 	return nil
 }
 
-func handleOfficialAccounts(req *model.TransferReq) {
-	musk := findFirstNonOfficialAccountMusk(req)
+func handleOfficialAccounts(official *basic.OfficialAccount, req *model.TransferReq) {
+	musk := findFirstNonOfficialAccountMusk(official, req)
 	if musk == nil {
 		return
 	}
 
 	updateAccountIds := func(accounts []*model.TransferItem) {
 		for i := range accounts {
-			if basic.IsOfficialAccount(accounts[i].AccountId) {
-				accounts[i].AccountId = basic.GetMixOfficialAccountId(accounts[i].AccountId, *musk)
+			if official.IsOfficialAccount(accounts[i].AccountId) {
+				accounts[i].AccountId = official.GetMixOfficialAccountId(accounts[i].AccountId, *musk)
 			}
 		}
 	}
@@ -124,11 +148,11 @@ func handleOfficialAccounts(req *model.TransferReq) {
 	updateAccountIds(req.ToAccounts)
 }
 
-func findFirstNonOfficialAccountMusk(req *model.TransferReq) *int64 {
+func findFirstNonOfficialAccountMusk(official *basic.OfficialAccount, req *model.TransferReq) *int64 {
 	findMusk := func(accounts []*model.TransferItem) *int64 {
 		for _, account := range accounts {
-			if !basic.IsOfficialAccount(account.AccountId) {
-				musk := basic.GetRemain(account.AccountId)
+			if !official.IsOfficialAccount(account.AccountId) {
+				musk := official.GetRemain(account.AccountId)
 				return &musk
 			}
 		}
@@ -141,43 +165,76 @@ func findFirstNonOfficialAccountMusk(req *model.TransferReq) *int64 {
 	return findMusk(req.ToAccounts)
 }
 
-func prepareTransferTransactions(req *model.TransferReq) ([]*dao.TransferTxItem, []*dao.TransferTxItem, error) {
+func prepareTransferTransactions(ledger *dao.Ledger, req *model.TransferReq) ([]*dao.TransferTxItem, []*dao.TransferTxItem, error) {
 	fromTxs := make([]*dao.TransferTxItem, 0, len(req.FromAccounts))
 	toTxs := make([]*dao.TransferTxItem, 0, len(req.ToAccounts))
 
 	for _, fromAccount := range req.FromAccounts {
-		fromTxs = append(fromTxs, createDeductionTx(req, fromAccount))
+		fromTxs = append(fromTxs, createDeductionTx(ledger, req, fromAccount))
 	}
 
 	for _, toAccount := range req.ToAccounts {
-		toTxs = append(toTxs, createIncreaseTx(req, toAccount))
+		toTxs = append(toTxs, createIncreaseTx(ledger, req, toAccount))
 	}
 
 	return fromTxs, toTxs, nil
 }
 
-func createDeductionTx(req *model.TransferReq, account *model.TransferItem) *dao.TransferTxItem {
+func createDeductionTx(ledger *dao.Ledger, req *model.TransferReq, account *model.TransferItem) *dao.TransferTxItem {
+	if account.Frozen {
+		//扣款，从冻结中扣减
+		return &dao.TransferTxItem{
+			Exec: func(ctx context.Context) error {
+				return ledger.CaptureAccount(ctx, account.AccountId, req.TransferId, account.ItemType, req.TransferScene, account.ChangeType, req.Comment)
+			},
+			Rollback: func(ctx context.Context) error {
+				return ledger.RollbackCaptureAccount(ctx, account.AccountId, req.TransferId, account.ItemType, req.TransferScene, account.ChangeType, req.Comment)
+			},
+		}
+	}
+	if account.Refund != nil {
+		//退款，扣回原转移收款方的物品
+		return &dao.TransferTxItem{
+			Exec: func(ctx context.Context) error {
+				return ledger.RefundDeductionAccount(ctx, account.Refund, account.AccountId, req.TransferId, account.Amount, account.ItemType, req.TransferScene, basic.RecordStatusNormal, account.ChangeType, req.Comment)
+			},
+			Rollback: func(ctx context.Context) error {
+				return ledger.RefundIncreaseAccount(ctx, account.Refund, account.AccountId, req.TransferId, account.Amount, account.ItemType, req.TransferScene, basic.RecordStatusRollback, account.ChangeType, req.Comment)
+			},
+		}
+	}
 	return &dao.TransferTxItem{
 		Exec: func(ctx context.Context) error {
-			return dao.DeductionAccount(ctx, account.AccountId, req.TransferId, account.Amount, account.ItemType, req.TransferScene, basic.RecordStatusNormal, account.ChangeType, req.Comment)
+			return ledger.DeductionAccount(ctx, account.AccountId, req.TransferId, account.Amount, account.ItemType, req.TransferScene, basic.RecordStatusNormal, account.ChangeType, req.Comment)
 		},
 		Rollback: func(ctx context.Context) error {
-			return dao.IncreaseAccount(ctx, account.AccountId, req.TransferId, account.Amount, account.ItemType, req.TransferScene, basic.RecordStatusRollback, account.ChangeType, req.Comment)
+			return ledger.IncreaseAccount(ctx, account.AccountId, req.TransferId, account.Amount, account.ItemType, req.TransferScene, basic.RecordStatusRollback, account.ChangeType, req.Comment)
 		},
 	}
 }
 
-func createIncreaseTx(req *model.TransferReq, account *model.TransferItem) *dao.TransferTxItem {
+func createIncreaseTx(ledger *dao.Ledger, req *model.TransferReq, account *model.TransferItem) *dao.TransferTxItem {
+	if account.Refund != nil {
+		//退款，退还原转移付款方的物品
+		return &dao.TransferTxItem{
+			Exec: func(ctx context.Context) error {
+				return ledger.RefundIncreaseAccount(ctx, account.Refund, account.AccountId, req.TransferId, account.Amount, account.ItemType, req.TransferScene, basic.RecordStatusNormal, account.ChangeType, req.Comment)
+			},
+			Rollback: func(ctx context.Context) error {
+				return ledger.RefundDeductionAccount(ctx, account.Refund, account.AccountId, req.TransferId, account.Amount, account.ItemType, req.TransferScene, basic.RecordStatusRollback, account.ChangeType, req.Comment)
+			},
+		}
+	}
 	return &dao.TransferTxItem{
 		Exec: func(ctx context.Context) error {
 			comment := req.Comment
 			if account.Comment != "" {
 				comment = account.Comment
 			}
-			return dao.IncreaseAccount(ctx, account.AccountId, req.TransferId, account.Amount, account.ItemType, req.TransferScene, basic.RecordStatusNormal, account.ChangeType, comment)
+			return ledger.IncreaseAccount(ctx, account.AccountId, req.TransferId, account.Amount, account.ItemType, req.TransferScene, basic.RecordStatusNormal, account.ChangeType, comment)
 		},
 		Rollback: func(ctx context.Context) error {
-			return dao.DeductionAccount(ctx, account.AccountId, req.TransferId, account.Amount, account.ItemType, req.TransferScene, basic.RecordStatusRollback, account.ChangeType, req.Comment)
+			return ledger.DeductionAccount(ctx, account.AccountId, req.TransferId, account.Amount, account.ItemType, req.TransferScene, basic.RecordStatusRollback, account.ChangeType, req.Comment)
 		},
 	}
 }
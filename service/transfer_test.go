@@ -0,0 +1,394 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/zjn-zjn/fisher/basic"
+	"github.com/zjn-zjn/fisher/dao"
+	"github.com/zjn-zjn/fisher/dao/memory"
+	"github.com/zjn-zjn/fisher/model"
+	"github.com/zjn-zjn/fisher/schema"
+)
+
+const (
+	userAccountA = int64(100000000001)
+	userAccountB = int64(100000000002)
+	userAccountC = int64(100000000003)
+)
+
+func initMemory(t *testing.T) {
+	if _, err := memory.Init(&basic.TransferConf{}); err != nil {
+		t.Fatalf("failed to init memory store: %v", err)
+	}
+}
+
+func openSQLite(t *testing.T, name string) *gorm.DB {
+	dsn := filepath.Join(t.TempDir(), name) + "?_busy_timeout=5000&_txlock=immediate"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	return db
+}
+
+func initSQLite(t *testing.T) {
+	initSQLiteConf(t, &basic.TransferConf{DBs: []*gorm.DB{openSQLite(t, "fisher.db")}})
+}
+
+// initSQLiteStateDB 转移状态使用单独的库，记录和账户分两个库
+func initSQLiteStateDB(t *testing.T) {
+	initSQLiteConf(t, &basic.TransferConf{
+		DBs:      []*gorm.DB{openSQLite(t, "fisher0.db"), openSQLite(t, "fisher1.db")},
+		StateDBs: []*gorm.DB{openSQLite(t, "state.db")},
+	})
+}
+
+func initSQLiteConf(t *testing.T, conf *basic.TransferConf) {
+	if err := schema.Apply(context.Background(), conf); err != nil {
+		t.Fatalf("failed to create tables: %v", err)
+	}
+	dao.SetStore(dao.NewGormStore())
+	if err := basic.InitWithConf(conf); err != nil {
+		t.Fatalf("failed to init conf: %v", err)
+	}
+}
+
+// forEachStore 分别使用内存存储和SQLite执行用例
+func forEachStore(t *testing.T, fn func(t *testing.T)) {
+	t.Run("memory", func(t *testing.T) {
+		initMemory(t)
+		fn(t)
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		initSQLite(t)
+		fn(t)
+	})
+	t.Run("sqlite_state_db", func(t *testing.T) {
+		initSQLiteStateDB(t)
+		fn(t)
+	})
+}
+
+func assertAmount(t *testing.T, accountId int64, want int64) {
+	t.Helper()
+	amount, err := GetAccountAmountByItemTypeWrite(context.Background(), accountId, ItemTypeGold)
+	if err != nil {
+		t.Fatalf("failed to get amount of %d: %v", accountId, err)
+	}
+	if amount != want {
+		t.Fatalf("account %d amount got %d want %d", accountId, amount, want)
+	}
+}
+
+func recharge(t *testing.T, transferId, accountId, amount int64) {
+	t.Helper()
+	err := Transfer(context.Background(), &model.TransferReq{
+		TransferId:    transferId,
+		TransferScene: TransferSceneBuyGoods,
+		FromAccounts: []*model.TransferItem{
+			{AccountId: int64(OfficialAccountTypeBank), ItemType: ItemTypeGold, Amount: amount, ChangeType: ChangeTypeSpend},
+		},
+		ToAccounts: []*model.TransferItem{
+			{AccountId: accountId, ItemType: ItemTypeGold, Amount: amount, ChangeType: ChangeTypeSellGoodsIncome},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to recharge: %v", err)
+	}
+}
+
+func buyReq(transferId int64) *model.TransferReq {
+	return &model.TransferReq{
+		TransferId:    transferId,
+		TransferScene: TransferSceneBuyGoods,
+		FromAccounts: []*model.TransferItem{
+			{AccountId: userAccountA, ItemType: ItemTypeGold, Amount: 100, ChangeType: ChangeTypeSpend},
+		},
+		ToAccounts: []*model.TransferItem{
+			{AccountId: userAccountB, ItemType: ItemTypeGold, Amount: 90, ChangeType: ChangeTypeSellGoodsIncome},
+			{AccountId: userAccountC, ItemType: ItemTypeGold, Amount: 10, ChangeType: ChangeTypeSellGoodsCopyright},
+		},
+	}
+}
+
+func TestTransferAndRollback(t *testing.T) {
+	forEachStore(t, testTransferAndRollback)
+}
+
+func testTransferAndRollback(t *testing.T) {
+	ctx := context.Background()
+	recharge(t, 1, userAccountA, 150)
+
+	if err := Transfer(ctx, buyReq(2)); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	//幂等
+	if err := Transfer(ctx, buyReq(2)); err != nil {
+		t.Fatalf("failed to transfer again: %v", err)
+	}
+	assertAmount(t, userAccountA, 50)
+	assertAmount(t, userAccountB, 90)
+	assertAmount(t, userAccountC, 10)
+
+	if err := Transfer(ctx, buyReq(3)); !basic.Is(err, basic.InsufficientAmountErr) {
+		t.Fatalf("expect insufficient amount, got %v", err)
+	}
+	assertAmount(t, userAccountA, 50)
+
+	if err := Rollback(ctx, &model.RollbackReq{TransferId: 2, TransferScene: TransferSceneBuyGoods}); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+	assertAmount(t, userAccountA, 150)
+	assertAmount(t, userAccountB, 0)
+	assertAmount(t, userAccountC, 0)
+
+	if err := Transfer(ctx, buyReq(2)); !basic.Is(err, basic.AlreadyRolledBackErr) {
+		t.Fatalf("expect already rolled back, got %v", err)
+	}
+}
+
+func TestEmptyRollback(t *testing.T) {
+	forEachStore(t, testEmptyRollback)
+}
+
+func testEmptyRollback(t *testing.T) {
+	ctx := context.Background()
+	recharge(t, 1, userAccountA, 100)
+
+	//回滚早于转移到达
+	if err := Rollback(ctx, &model.RollbackReq{TransferId: 2, TransferScene: TransferSceneBuyGoods}); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+	if err := Transfer(ctx, buyReq(2)); !basic.Is(err, basic.AlreadyRolledBackErr) {
+		t.Fatalf("expect already rolled back, got %v", err)
+	}
+	assertAmount(t, userAccountA, 100)
+}
+
+func TestHalfSuccessInspection(t *testing.T) {
+	forEachStore(t, testHalfSuccessInspection)
+}
+
+func testHalfSuccessInspection(t *testing.T) {
+	s := dao.GetStore()
+	ctx := context.Background()
+	recharge(t, 1, userAccountA, 100)
+
+	if err := Transfer(ctx, buyReq(2)); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	//模拟半成功后进程退出，状态停留在半成功
+	if _, err := s.UpdateStateStatus(ctx, 2, TransferSceneBuyGoods, basic.StateStatusSuccess, basic.StateStatusHalfSuccess); err != nil {
+		t.Fatalf("failed to update state: %v", err)
+	}
+	if errs := Inspection(ctx, time.Now().UnixMilli()); len(errs) > 0 {
+		t.Fatalf("failed to inspection: %v", errs)
+	}
+	state, err := s.GetState(ctx, 2, TransferSceneBuyGoods)
+	if err != nil {
+		t.Fatalf("failed to get state: %v", err)
+	}
+	if state.Status != basic.StateStatusSuccess {
+		t.Fatalf("state status got %d want %d", state.Status, basic.StateStatusSuccess)
+	}
+	assertAmount(t, userAccountB, 90)
+}
+
+func TestIdempotencyConflict(t *testing.T) {
+	forEachStore(t, testIdempotencyConflict)
+}
+
+func testIdempotencyConflict(t *testing.T) {
+	ctx := context.Background()
+	recharge(t, 1, userAccountA, 200)
+	if err := Transfer(ctx, buyReq(2)); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	//顺序和备注不同不算冲突
+	same := buyReq(2)
+	same.ToAccounts[0], same.ToAccounts[1] = same.ToAccounts[1], same.ToAccounts[0]
+	same.Comment = "retry"
+	if err := Transfer(ctx, same); err != nil {
+		t.Fatalf("failed to transfer again: %v", err)
+	}
+	conflict := buyReq(2)
+	conflict.FromAccounts[0].Amount = 110
+	conflict.ToAccounts[0].Amount = 100
+	err := Transfer(ctx, conflict)
+	if !basic.Is(err, basic.IdempotencyConflictErr) {
+		t.Fatalf("expect idempotency conflict, got %v", err)
+	}
+	var conflictErr *basic.IdempotencyConflictError
+	if !errors.As(err, &conflictErr) || len(conflictErr.Diff) != 2 {
+		t.Fatalf("expect diff of 2 legs, got %v", err)
+	}
+	assertAmount(t, userAccountA, 100)
+	assertAmount(t, userAccountB, 90)
+}
+
+func TestGetTransfer(t *testing.T) {
+	forEachStore(t, testGetTransfer)
+}
+
+func assertLegs(t *testing.T, legs []*model.TransferLeg, want basic.LegStatus) {
+	t.Helper()
+	for _, leg := range legs {
+		if leg.Status != want {
+			t.Fatalf("account %d leg status got %d want %d", leg.Item.AccountId, leg.Status, want)
+		}
+	}
+}
+
+func testGetTransfer(t *testing.T) {
+	ctx := context.Background()
+	recharge(t, 1, userAccountA, 200)
+
+	detail, err := GetTransfer(ctx, 2, TransferSceneBuyGoods)
+	if err != nil || detail != nil {
+		t.Fatalf("expect nil detail for missing transfer, got %+v %v", detail, err)
+	}
+	if err = Transfer(ctx, buyReq(2)); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	if detail, err = GetTransfer(ctx, 2, TransferSceneBuyGoods); err != nil {
+		t.Fatalf("failed to get transfer: %v", err)
+	}
+	if detail.State.Status != basic.StateStatusSuccess || len(detail.FromAccounts) != 1 || len(detail.ToAccounts) != 2 {
+		t.Fatalf("unexpected detail: %+v", detail)
+	}
+	assertLegs(t, detail.FromAccounts, basic.LegStatusDone)
+	assertLegs(t, detail.ToAccounts, basic.LegStatusDone)
+	if record := detail.ToAccounts[0].Record; record.AccountId != userAccountB || record.Amount != 90 {
+		t.Fatalf("unexpected record: %+v", record)
+	}
+
+	if err = Rollback(ctx, &model.RollbackReq{TransferId: 2, TransferScene: TransferSceneBuyGoods}); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+	if detail, err = GetTransfer(ctx, 2, TransferSceneBuyGoods); err != nil {
+		t.Fatalf("failed to get transfer: %v", err)
+	}
+	assertLegs(t, detail.FromAccounts, basic.LegStatusRolledBack)
+	assertLegs(t, detail.ToAccounts, basic.LegStatusRolledBack)
+
+	//转移状态已创建但还未执行，回滚时记录空回滚
+	if _, err = defaultClient().ledger.GetOrCreateState(ctx, buyReq(3)); err != nil {
+		t.Fatalf("failed to create state: %v", err)
+	}
+	if detail, err = GetTransfer(ctx, 3, TransferSceneBuyGoods); err != nil {
+		t.Fatalf("failed to get transfer: %v", err)
+	}
+	assertLegs(t, detail.FromAccounts, basic.LegStatusPending)
+	assertLegs(t, detail.ToAccounts, basic.LegStatusPending)
+	if err = Rollback(ctx, &model.RollbackReq{TransferId: 3, TransferScene: TransferSceneBuyGoods}); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+	if detail, err = GetTransfer(ctx, 3, TransferSceneBuyGoods); err != nil {
+		t.Fatalf("failed to get transfer: %v", err)
+	}
+	assertLegs(t, detail.FromAccounts, basic.LegStatusEmptyRollback)
+	assertLegs(t, detail.ToAccounts, basic.LegStatusEmptyRollback)
+}
+
+func TestRecordBalanceAfter(t *testing.T) {
+	forEachStore(t, testRecordBalanceAfter)
+}
+
+func testRecordBalanceAfter(t *testing.T) {
+	ctx := context.Background()
+	recharge(t, 1, userAccountA, 300)
+	for _, transferId := range []int64{2, 3} {
+		if err := Transfer(ctx, buyReq(transferId)); err != nil {
+			t.Fatalf("failed to transfer: %v", err)
+		}
+	}
+	if err := Rollback(ctx, &model.RollbackReq{TransferId: 3, TransferScene: TransferSceneBuyGoods}); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+
+	page, err := ListAccountRecords(ctx, &model.ListRecordReq{AccountId: userAccountA, Asc: true})
+	if err != nil {
+		t.Fatalf("failed to list records: %v", err)
+	}
+	want := []struct{ balance, sequence, rollbackBalance, rollbackSequence int64 }{
+		{300, 1, 0, 0},
+		{200, 2, 0, 0},
+		{100, 3, 200, 4},
+	}
+	if len(page.Records) != len(want) {
+		t.Fatalf("records got %d want %d", len(page.Records), len(want))
+	}
+	for i, record := range page.Records {
+		if record.BalanceAfter != want[i].balance || record.Sequence != want[i].sequence ||
+			record.RollbackBalanceAfter != want[i].rollbackBalance || record.RollbackSequence != want[i].rollbackSequence {
+			t.Fatalf("record of transfer %d got %+v want %+v", record.TransferId, record, want[i])
+		}
+	}
+	account, err := GetAccountByItemTypeWrite(ctx, userAccountA, ItemTypeGold)
+	if err != nil {
+		t.Fatalf("failed to get account: %v", err)
+	}
+	if account.Amount != 200 || account.Sequence != 4 {
+		t.Fatalf("account amount/sequence got %d/%d want 200/4", account.Amount, account.Sequence)
+	}
+}
+
+func TestGetAccountAmountAt(t *testing.T) {
+	forEachStore(t, testGetAccountAmountAt)
+}
+
+func testGetAccountAmountAt(t *testing.T) {
+	ctx := context.Background()
+	//每步之间留出间隔，取间隔中的时间点
+	mark := func() int64 {
+		time.Sleep(5 * time.Millisecond)
+		ts := time.Now().UnixMilli()
+		time.Sleep(5 * time.Millisecond)
+		return ts
+	}
+	beforeRecharge := mark()
+	recharge(t, 1, userAccountA, 300)
+	afterRecharge := mark()
+	if err := Transfer(ctx, buyReq(2)); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	afterTransfer := mark()
+	if err := Transfer(ctx, buyReq(3)); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	beforeRollback := mark()
+	if err := Rollback(ctx, &model.RollbackReq{TransferId: 3, TransferScene: TransferSceneBuyGoods}); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+	//空回滚没有变动
+	if err := Rollback(ctx, &model.RollbackReq{TransferId: 4, TransferScene: TransferSceneBuyGoods}); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+	afterRollback := mark()
+
+	for _, c := range []struct {
+		timestamp, want int64
+	}{
+		{beforeRecharge, 0},
+		{afterRecharge, 300},
+		{afterTransfer, 200},
+		{beforeRollback, 100},
+		{afterRollback, 200},
+	} {
+		amount, err := GetAccountAmountAt(ctx, userAccountA, ItemTypeGold, c.timestamp)
+		if err != nil {
+			t.Fatalf("failed to get amount at %d: %v", c.timestamp, err)
+		}
+		if amount != c.want {
+			t.Fatalf("amount at %d got %d want %d", c.timestamp, amount, c.want)
+		}
+	}
+}